@@ -1,9 +1,17 @@
 package bootstrap
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
 
+	"go-skeleton/lib/jwtkey"
 	"go-skeleton/lib/logger"
+	"go-skeleton/lib/storage"
+	"go-skeleton/lib/tracing"
 	"go-skeleton/lib/utils"
 
 	"github.com/go-chi/chi/v5"
@@ -13,8 +21,10 @@ import (
 	validator "github.com/go-playground/validator/v10"
 	enTranslations "github.com/go-playground/validator/v10/translations/en"
 	idTranslations "github.com/go-playground/validator/v10/translations/id"
+	"github.com/go-redis/redis/extra/redisotel/v8"
 	"github.com/go-redis/redis/v8"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 )
 
@@ -28,6 +38,13 @@ type App struct {
 	Validator  *Validator
 	Log        logger.Contract
 	Redis      *redis.Client
+	JWTKeys    *jwtkey.KeySet
+	Storage    storage.Storage
+
+	// readiness probes and the graceful shutdown flag, see health.go
+	healthMu     sync.RWMutex
+	healthChecks []HealthCheck
+	draining     int32
 }
 
 type Service interface {
@@ -76,22 +93,122 @@ func SetupValidator(config utils.Config) *Validator {
 	return &Validator{Driver: validatorDriver, Uni: uni, Translator: trans}
 }
 
-// SetupLogger create new instance of logger pacakge
+// SetupLogger create new instance of logger pacakge with the sinks of log.sinks, e.g.
+// "stdout,file,sentry,syslog", each one with log.<sink>.level and log.<sink>.format.
+// Without log.sinks, log.stdout, log.file.enabled and log.sentry.enabled are used and
+// log.default still enables the file or sentry sink alone.
 func SetupLogger(config utils.Config) logger.Contract {
-	def := config.GetString("log.default")
-	source := fmt.Sprintf("log.%s.source", def)
-	return logger.NewLogger(
-		def, config.GetString(source),
-	)
+	var sinks []string
+	for _, sink := range strings.Split(config.GetString("log.sinks"), ",") {
+		if sink = strings.TrimSpace(sink); len(sink) > 0 {
+			sinks = append(sinks, sink)
+		}
+	}
+
+	if len(sinks) == 0 {
+		def := config.GetString("log.default")
+		if config.GetBool("log.stdout") {
+			sinks = append(sinks, logger.SinkStdout)
+		}
+		if def == logger.SinkFile || config.GetBool("log.file.enabled") {
+			sinks = append(sinks, logger.SinkFile)
+		}
+		if def == logger.SinkSentry || config.GetBool("log.sentry.enabled") {
+			sinks = append(sinks, logger.SinkSentry)
+		}
+	}
+
+	opts := logger.Options{}
+	for _, sink := range sinks {
+		defaultLevel := logrus.InfoLevel
+		if sink == logger.SinkSentry {
+			defaultLevel = logrus.ErrorLevel
+		}
+
+		opts.Sinks = append(opts.Sinks, logger.SinkOptions{
+			Type:   sink,
+			Level:  logLevel(config.GetString(fmt.Sprintf("log.%s.level", sink)), defaultLevel),
+			Format: config.GetString(fmt.Sprintf("log.%s.format", sink)),
+			File: logger.RotateOptions{
+				Path:       config.GetString("log.file.source"),
+				MaxSize:    int64(config.GetInt("log.file.max_size")) * 1024 * 1024,
+				Interval:   rotateInterval(config.GetString("log.file.rotate")),
+				MaxBackups: config.GetInt("log.file.max_backups"),
+				MaxAge:     time.Duration(config.GetInt("log.file.max_age")) * 24 * time.Hour,
+				Compress:   config.GetBool("log.file.compress"),
+			},
+			SentryDSN: config.GetString("log.sentry.source"),
+			Syslog: logger.SyslogOptions{
+				Network:  config.GetString("log.syslog.network"),
+				Address:  config.GetString("log.syslog.address"),
+				Tag:      config.GetString("log.syslog.tag"),
+				Facility: config.GetInt("log.syslog.facility"),
+			},
+		})
+	}
+
+	cLog := logger.NewLogger(opts)
+	logger.SetDefault(cLog)
+
+	return cLog
+}
+
+// logLevel parse the level of a sink, def when it's empty or invalid
+func logLevel(level string, def logrus.Level) logrus.Level {
+	if len(level) == 0 {
+		return def
+	}
+
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		log.Printf("invalid log level %q, using %s", level, def)
+		return def
+	}
+
+	return lvl
 }
 
-// SetupRedis ...
+// rotateInterval the time rotation of the log file, hourly or daily
+func rotateInterval(rotate string) time.Duration {
+	switch rotate {
+	case "hourly":
+		return time.Hour
+	case "daily":
+		return 24 * time.Hour
+	}
+
+	return 0
+}
+
+// SetupJWTKeys load the keys to sign and verify JWT. When jwt.keys_path isn't set
+// the tokens are signed with HS256 using app.key.
+func SetupJWTKeys(config utils.Config) (*jwtkey.KeySet, error) {
+	path := config.GetString("jwt.keys_path")
+	if len(path) == 0 {
+		return jwtkey.NewHMAC(config.GetString("app.key")), nil
+	}
+
+	return jwtkey.Load(path, config.GetString("jwt.kid"))
+}
+
+// SetupRedis create the client and ping the server. The client is returned even when
+// the ping fails, it reconnects by itself once redis is reachable.
 func SetupRedis(addr string, pass string, db int) (*redis.Client, error) {
 	rdb := redis.NewClient(&redis.Options{
 		Addr:     addr,
 		Password: pass,
 		DB:       db,
 	})
+	if tracing.Enabled() {
+		rdb.AddHook(redisotel.NewTracingHook())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		return rdb, fmt.Errorf("can't connect to redis %s: %v", addr, err)
+	}
 
 	return rdb, nil
 }
@@ -4,15 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"go-skeleton/lib/apperr"
 	"go-skeleton/lib/utils"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	validator "github.com/go-playground/validator/v10"
 	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -22,17 +26,21 @@ const (
 	XPlayer        = "X-PLAYER"    // Token obtained from OneSignal Push notification
 	XChannelHeader = "X-CHANNEL"   // Custom header to determine the channel
 
+	// StatusClientClosedRequest non standard status (nginx) of a request cancelled by the client
+	StatusClientClosedRequest = 499
+
 	// Success and error messages
-	MsgSuccess          = "APP:SUCCESS"         // Success message
-	MsgErrValidation    = "ERR:VALIDATION"      // Error due to validation
-	MsgEmptyData        = "ERR:EMPTY_DATA"      // Data not found error
-	MsgErrParam         = "ERR:INVALID_PARAM"   // Error due to invalid parameter in the query string
-	MsgBadReq           = "ERR:BAD_REQUEST"     // General bad request error
-	MsgNotFound         = "ERR:NOT_FOUND"       // 404 Not Found error
-	MsgAuthErr          = "ERR:AUTHENTICATION"  // Authentication error
-	MsgAuthorizedErr    = "ERR:AUTHORIZED"      // Authorization error
-	MsgForbiddenErr     = "ERR:FORBIDDEN"       // Forbidden error
-	MsgEmailNotFoundErr = "ERR:EMAIL_NOT_FOUND" // Error indicating email not found
+	MsgSuccess          = "APP:SUCCESS"           // Success message
+	MsgErrValidation    = "ERR:VALIDATION"        // Error due to validation
+	MsgEmptyData        = "ERR:EMPTY_DATA"        // Data not found error
+	MsgErrParam         = "ERR:INVALID_PARAM"     // Error due to invalid parameter in the query string
+	MsgBadReq           = "ERR:BAD_REQUEST"       // General bad request error
+	MsgNotFound         = "ERR:NOT_FOUND"         // 404 Not Found error
+	MsgAuthErr          = "ERR:AUTHENTICATION"    // Authentication error
+	MsgAuthorizedErr    = "ERR:AUTHORIZED"        // Authorization error
+	MsgForbiddenErr     = "ERR:FORBIDDEN"         // Forbidden error
+	MsgEmailNotFoundErr = "ERR:EMAIL_NOT_FOUND"   // Error indicating email not found
+	MsgTooManyRequests  = "ERR:TOO_MANY_REQUESTS" // Error due to rate limit or account lockout
 
 	Success          = "Success"
 	Forbidden        = "Forbidden"
@@ -148,11 +156,60 @@ func (h *App) SendForbidden(w http.ResponseWriter, msg string) {
 	h.RespondWithJSON(w, 403, MsgForbiddenErr, msg, h.EmptyJSONArr(), h.EmptyJSONArr())
 }
 
+// SendTooManyRequests send too many requests into response with 429 http code and the Retry-After header.
+func (h *App) SendTooManyRequests(w http.ResponseWriter, message string, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	h.RespondWithJSON(w, 429, MsgTooManyRequests, message, h.EmptyJSONArr(), h.EmptyJSONArr())
+}
+
 // SendAuthError send bad request into response with 400 http code.
 func (h *App) SendInternalServerErr(w http.ResponseWriter, message string) {
 	h.RespondWithJSON(w, 502, MsgAuthErr, message, h.EmptyJSONArr(), h.EmptyJSONArr())
 }
 
+// SendError send the error with the http status of its kind and "ERR:<code>" as stat_code.
+// An error that isn't an *apperr.Error is logged and sent as a 500 with a generic message.
+func (h *App) SendError(w http.ResponseWriter, err error) {
+	appErr, ok := apperr.As(err)
+	if !ok {
+		appErr, ok = apperr.FromContext(err)
+	}
+	if !ok {
+		h.Log.FromDefault().WithFields(logrus.Fields{
+			"functionName": "bootstrap.SendError",
+			"error":        err,
+		}).Errorf("Error message : %s", err.Error())
+
+		appErr = apperr.Wrap(err, apperr.Internal, apperr.CodeInternal, utils.ErrSystemError)
+	}
+
+	h.RespondWithJSON(w, errorStatus(appErr.Kind), "ERR:"+appErr.Code, appErr.Message, h.EmptyJSONArr(), h.EmptyJSONArr())
+}
+
+// errorStatus http status of the error kind
+func errorStatus(kind apperr.Kind) int {
+	switch kind {
+	case apperr.NotFound:
+		return http.StatusNotFound
+	case apperr.Conflict:
+		return http.StatusConflict
+	case apperr.Validation:
+		return http.StatusBadRequest
+	case apperr.Unauthorized:
+		return http.StatusUnauthorized
+	case apperr.Forbidden:
+		return http.StatusForbidden
+	case apperr.TooManyRequests:
+		return http.StatusTooManyRequests
+	case apperr.Timeout:
+		return http.StatusGatewayTimeout
+	case apperr.Canceled:
+		return StatusClientClosedRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // SendRequestValidationError Send validation error response to consumers.
 func (h *App) SendRequestValidationError(w http.ResponseWriter, validationErrors validator.ValidationErrors) {
 	errorResponse := map[string][]string{}
@@ -238,11 +295,26 @@ func (h *App) GetUserCode(ctx context.Context) string {
 	return fmt.Sprintf("%v", ctx.Value("identifier").(map[string]string)["mcode"])
 }
 
+// GetSessionIdentifier ...
+func (h *App) GetSessionIdentifier(ctx context.Context) string {
+	return fmt.Sprintf("%v", ctx.Value("identifier").(map[string]string)["session_identifier"])
+}
+
 // GetUserRole ...
 func (h *App) GetUserRole(ctx context.Context) string {
 	return fmt.Sprintf("%v", ctx.Value("identifier").(map[string]string)["role"])
 }
 
+// GetUserPermissions permissions of the role carried in the access token
+func (h *App) GetUserPermissions(ctx context.Context) []string {
+	identifier, ok := ctx.Value("identifier").(map[string]string)
+	if !ok || len(identifier["permissions"]) == 0 {
+		return []string{}
+	}
+
+	return strings.Split(identifier["permissions"], ",")
+}
+
 // ParamOrder ...
 type ParamOrder struct {
 	Field string
@@ -290,3 +362,13 @@ func (h *App) GetBoolParam(r *http.Request, name string) (bool, error) {
 func (h *App) PingAction(w http.ResponseWriter, r *http.Request) {
 	h.SendSuccess(w, h.EmptyJSONArr(), nil)
 }
+
+// JWKSAction publish the public keys to verify the JWT at /.well-known/jwks.json
+func (h *App) JWKSAction(w http.ResponseWriter, r *http.Request) {
+	response, _ := json.Marshal(h.JWTKeys.JWKS())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(response)
+}
@@ -0,0 +1,184 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	MsgNotReady = "ERR:NOT_READY" // Readiness probe failed or the app is shutting down
+
+	defaultHealthTimeout = 2 * time.Second
+)
+
+// HealthCheck probe of a dependency, the check gets a context with the timeout of the probe
+type HealthCheck struct {
+	Name    string
+	Timeout time.Duration
+	Check   func(ctx context.Context) error
+}
+
+// HealthStatus result of a probe in the readiness response
+type HealthStatus struct {
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// AddHealthCheck register a dependency probed by /readyz
+func (app *App) AddHealthCheck(name string, timeout time.Duration, check func(ctx context.Context) error) {
+	if timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
+
+	app.healthMu.Lock()
+	app.healthChecks = append(app.healthChecks, HealthCheck{Name: name, Timeout: timeout, Check: check})
+	app.healthMu.Unlock()
+}
+
+// SetupHealthChecks register the probes of postgres and redis, rabbitmq and smtp are
+// probed only when health.rabbitmq / health.smtp are enabled in config
+func (app *App) SetupHealthChecks() {
+	timeout := time.Duration(app.Config.GetInt("health.timeout")) * time.Millisecond
+
+	app.AddHealthCheck("db", timeout, func(ctx context.Context) error {
+		return app.DB.Ping(ctx)
+	})
+	app.AddHealthCheck("redis", timeout, func(ctx context.Context) error {
+		return app.Redis.Ping(ctx).Err()
+	})
+
+	if app.Config.GetBool("health.rabbitmq") {
+		app.AddHealthCheck("rabbitmq", timeout, func(ctx context.Context) error {
+			return pingRabbitMQ(ctx, app.Config.GetString("queue.rabbitmq.host"))
+		})
+	}
+
+	if app.Config.GetBool("health.smtp") {
+		app.AddHealthCheck("smtp", timeout, func(ctx context.Context) error {
+			return pingSMTP(ctx, app.Config.GetString("mail.host"), app.Config.GetInt("mail.port"))
+		})
+	}
+}
+
+// SetNotReady make /readyz fail, it's called at the start of the graceful shutdown so the
+// load balancer stops sending new requests before the server is closed
+func (app *App) SetNotReady() {
+	atomic.StoreInt32(&app.draining, 1)
+}
+
+// IsReady false once the graceful shutdown has started
+func (app *App) IsReady() bool {
+	return atomic.LoadInt32(&app.draining) == 0
+}
+
+// LivenessAction /healthz, the process is up and serving http
+func (app *App) LivenessAction(w http.ResponseWriter, r *http.Request) {
+	app.SendSuccess(w, map[string]string{"status": "ok"}, nil)
+}
+
+// ReadinessAction /readyz, every dependency is probed in parallel with its own timeout
+func (app *App) ReadinessAction(w http.ResponseWriter, r *http.Request) {
+	if !app.IsReady() {
+		app.RespondWithJSON(w, http.StatusServiceUnavailable, MsgNotReady, "shutting down",
+			map[string]interface{}{"status": "shutting_down"}, app.EmptyJSONArr())
+		return
+	}
+
+	app.healthMu.RLock()
+	checks := app.healthChecks
+	app.healthMu.RUnlock()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		ready   = true
+		results = make(map[string]HealthStatus, len(checks))
+	)
+
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(r.Context(), check.Timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check.Check(ctx)
+			status := HealthStatus{Status: "up", LatencyMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				status.Status = "down"
+				status.Error = err.Error()
+			}
+
+			mu.Lock()
+			results[check.Name] = status
+			if err != nil {
+				ready = false
+			}
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	payload := map[string]interface{}{"status": "ready", "checks": results}
+	if !ready {
+		payload["status"] = "not_ready"
+		app.RespondWithJSON(w, http.StatusServiceUnavailable, MsgNotReady, "not ready", payload, app.EmptyJSONArr())
+		return
+	}
+
+	app.SendSuccess(w, payload, nil)
+}
+
+// pingRabbitMQ open and close a connection to the broker
+func pingRabbitMQ(ctx context.Context, host string) error {
+	conn, err := amqp.DialConfig(host, amqp.Config{
+		Dial: func(network, addr string) (net.Conn, error) {
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			// bound the amqp handshake too, the deadline is cleared once it's opened
+			if deadline, ok := ctx.Deadline(); ok {
+				_ = conn.SetDeadline(deadline)
+			}
+			return conn, nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+// pingSMTP connect to the mail server and wait for its greeting
+func pingSMTP(ctx context.Context, host string, port int) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	return client.Quit()
+}
@@ -0,0 +1,149 @@
+package bootstrap
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of HTTP requests by route pattern, method and status.",
+	}, []string{"method", "route", "status"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "http_request_duration_seconds",
+		Help: "Latency of the HTTP requests in seconds.",
+	}, []string{"method", "route", "status"})
+	httpInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Number of HTTP requests being served.",
+	})
+)
+
+// MetricsMiddleware count the requests and their latency. The route label is the chi
+// pattern (e.g. /v1/users/addresses/{code}) so the ids don't blow up the cardinality.
+func (app *App) MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		httpInFlight.Inc()
+		defer httpInFlight.Dec()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := rctx.RoutePattern(); len(pattern) > 0 {
+				route = pattern
+			}
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		labels := []string{r.Method, route, strconv.Itoa(status)}
+		httpRequests.WithLabelValues(labels...).Inc()
+		httpDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	})
+}
+
+// RegisterPoolMetrics expose the stats of the postgres and redis pools, read at every scrape
+func (app *App) RegisterPoolMetrics() {
+	if app.DB != nil {
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "pgxpool_acquired_conns",
+			Help: "Number of connections currently acquired from the pool.",
+		}, func() float64 {
+			return float64(app.DB.Stat().AcquiredConns())
+		})
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "pgxpool_idle_conns",
+			Help: "Number of idle connections in the pool.",
+		}, func() float64 {
+			return float64(app.DB.Stat().IdleConns())
+		})
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "pgxpool_total_conns",
+			Help: "Total number of connections in the pool.",
+		}, func() float64 {
+			return float64(app.DB.Stat().TotalConns())
+		})
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "pgxpool_max_conns",
+			Help: "Maximum size of the pool.",
+		}, func() float64 {
+			return float64(app.DB.Stat().MaxConns())
+		})
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Name: "pgxpool_acquire_total",
+			Help: "Number of successful acquires from the pool.",
+		}, func() float64 {
+			return float64(app.DB.Stat().AcquireCount())
+		})
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Name: "pgxpool_acquire_duration_seconds_total",
+			Help: "Total time spent waiting for a connection.",
+		}, func() float64 {
+			return app.DB.Stat().AcquireDuration().Seconds()
+		})
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Name: "pgxpool_empty_acquire_total",
+			Help: "Number of acquires that waited because the pool was empty.",
+		}, func() float64 {
+			return float64(app.DB.Stat().EmptyAcquireCount())
+		})
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Name: "pgxpool_canceled_acquire_total",
+			Help: "Number of acquires cancelled by the context.",
+		}, func() float64 {
+			return float64(app.DB.Stat().CanceledAcquireCount())
+		})
+	}
+
+	if app.Redis != nil {
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Name: "redis_pool_hits_total",
+			Help: "Number of times a free connection was found in the pool.",
+		}, func() float64 {
+			return float64(app.Redis.PoolStats().Hits)
+		})
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Name: "redis_pool_misses_total",
+			Help: "Number of times a free connection was not found in the pool.",
+		}, func() float64 {
+			return float64(app.Redis.PoolStats().Misses)
+		})
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Name: "redis_pool_timeouts_total",
+			Help: "Number of times a wait for a connection timed out.",
+		}, func() float64 {
+			return float64(app.Redis.PoolStats().Timeouts)
+		})
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "redis_pool_total_conns",
+			Help: "Number of connections in the pool.",
+		}, func() float64 {
+			return float64(app.Redis.PoolStats().TotalConns)
+		})
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "redis_pool_idle_conns",
+			Help: "Number of idle connections in the pool.",
+		}, func() float64 {
+			return float64(app.Redis.PoolStats().IdleConns)
+		})
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Name: "redis_pool_stale_conns_total",
+			Help: "Number of stale connections removed from the pool.",
+		}, func() float64 {
+			return float64(app.Redis.PoolStats().StaleConns)
+		})
+	}
+}
@@ -2,27 +2,38 @@ package bootstrap
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"go-skeleton/lib/logger"
 	"go-skeleton/lib/utils"
 	"net/http"
 	"runtime/debug"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v4"
 	"github.com/sirupsen/logrus"
 )
 
 type CustomUserClaims struct {
-	UserIdentifier string `json:"user_identifier"`
-	Email          string `json:"email"`
+	UserIdentifier    string   `json:"user_identifier"`
+	Email             string   `json:"email"`
+	SessionIdentifier string   `json:"sid"`
+	Purpose           string   `json:"purpose,omitempty"`
+	Role              string   `json:"role,omitempty"`
+	Permissions       []string `json:"permissions,omitempty"`
 	jwt.StandardClaims
 }
 
 const (
 	ChannelApp = "app"
 	ChannelCMS = "cms"
+
+	// PurposeTwoFactor claim of the challenge token that is exchanged for a session after the 2FA step
+	PurposeTwoFactor = "2fa"
 )
 
 var (
@@ -66,7 +77,7 @@ func (app *App) Recoverer(next http.Handler) http.Handler {
 					debug.PrintStack()
 				}
 
-				app.Log.FromDefault().WithFields(logrus.Fields{
+				logger.FromContext(r.Context()).WithFields(logrus.Fields{
 					"Panic": rvr,
 				}).Errorf("Panic: %v \n %v", rvr, string(debug.Stack()))
 
@@ -85,14 +96,7 @@ func (app *App) VerifyJwtTokenUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		claims := &CustomUserClaims{}
 		tokenAuth := r.Header.Get("Authorization")
-		_, err := jwt.ParseWithClaims(tokenAuth, claims, func(token *jwt.Token) (interface{}, error) {
-			if jwt.SigningMethodHS256 != token.Method {
-				return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-			}
-
-			secret := app.Config.GetString("app.key")
-			return []byte(secret), nil
-		})
+		_, err := jwt.ParseWithClaims(tokenAuth, claims, app.JWTKeys.Keyfunc)
 
 		if err != nil {
 			msg := utils.ErrInvalidToken
@@ -112,15 +116,97 @@ func (app *App) VerifyJwtTokenUser(next http.Handler) http.Handler {
 			return
 		}
 
+		// challenge tokens can't be used as access token
+		if len(claims.Purpose) > 0 {
+			app.SendAuthError(w, utils.ErrInvalidToken)
+			return
+		}
+
+		// check if the session of the token has been revoked (logout or refresh token reuse)
+		active, err := app.isSessionActive(r.Context(), claims.SessionIdentifier)
+		if err != nil {
+			app.SendError(w, err)
+			return
+		}
+		if !active {
+			app.SendAuthError(w, utils.ErrSessionRevoked)
+			return
+		}
+
+		// the access log and logger.FromContext get the user of the request
+		logger.AddFields(r.Context(), logrus.Fields{"user_identifier": claims.UserIdentifier})
+
 		ctx := userContext(r.Context(), "identifier", map[string]string{
-			"user_identifier": claims.UserIdentifier,
-			"email":           claims.Email,
+			"user_identifier":    claims.UserIdentifier,
+			"email":              claims.Email,
+			"session_identifier": claims.SessionIdentifier,
+			"role":               claims.Role,
+			"permissions":        strings.Join(claims.Permissions, ","),
 		})
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// isSessionActive check the session of the access token still exists and isn't revoked,
+// a database error is returned so it isn't mistaken for a revoked session
+func (app *App) isSessionActive(ctx context.Context, sessionIdentifier string) (bool, error) {
+	var revoked bool
+
+	if len(sessionIdentifier) == 0 {
+		return false, nil
+	}
+
+	sql := `SELECT revoked_date IS NOT NULL FROM user_sessions WHERE session_identifier = $1`
+	err := app.DB.QueryRow(ctx, sql, sessionIdentifier).Scan(&revoked)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"functionName": "bootstrap.isSessionActive",
+			"error":        err,
+		}).Errorf("Error message : %s", err.Error())
+
+		return false, err
+	}
+
+	return !revoked, nil
+}
+
+// RequirePermission allow the request only when the role of the user has every permission,
+// use it after VerifyJwtTokenUser
+func (app *App) RequirePermission(permissions ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			granted := app.GetUserPermissions(r.Context())
+			for _, permission := range permissions {
+				if !utils.Contains(granted, permission) {
+					app.SendForbidden(w, utils.ErrPermissionDenied)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireChannel allow only the requests with the X-CHANNEL header of the channel
+func (app *App) RequireChannel(channel string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if app.GetChannel(r) != channel {
+				app.SendBadRequest(w, fmt.Sprintf("undefined %s header or wrong value of header", XChannelHeader))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // HeaderCheckerMiddleware check the necesarry headers
 func (app *App) HeaderCheckerMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
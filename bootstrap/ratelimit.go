@@ -0,0 +1,245 @@
+package bootstrap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-skeleton/lib/logger"
+	"go-skeleton/lib/utils"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+)
+
+// RateLimitKeyFunc give the identity the requests are counted for, an empty key skip the policy
+type RateLimitKeyFunc func(r *http.Request) string
+
+// RateLimitPolicy allow Limit requests for the same key in a sliding Window
+type RateLimitPolicy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+	Key    RateLimitKeyFunc
+}
+
+// rateLimitResult state of a policy after the current request
+type rateLimitResult struct {
+	policy     RateLimitPolicy
+	allowed    bool
+	remaining  int
+	retryAfter time.Duration
+}
+
+// slidingWindowScript count the requests of the last window in a sorted set scored by time,
+// it returns {allowed, count, milliseconds until the oldest request leaves the window}
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], 0, now - window)
+local count = redis.call('ZCARD', KEYS[1])
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], window)
+	return {1, count + 1, window}
+end
+
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+return {0, count, tonumber(oldest[2]) + window - now}
+`)
+
+// RateLimitPolicy create a policy, the limit and window (seconds) can be
+// overridden in config with rate_limit.<name>.limit and rate_limit.<name>.window
+func (app *App) RateLimitPolicy(name string, limit int, window time.Duration, key RateLimitKeyFunc) RateLimitPolicy {
+	if l := app.Config.GetInt(fmt.Sprintf("rate_limit.%s.limit", name)); l > 0 {
+		limit = l
+	}
+	if w := app.Config.GetInt(fmt.Sprintf("rate_limit.%s.window", name)); w > 0 {
+		window = time.Duration(w) * time.Second
+	}
+
+	return RateLimitPolicy{Name: name, Limit: limit, Window: window, Key: key}
+}
+
+// RateLimit throttle the route with every policy, the request is refused when one of them is exceeded.
+// When redis isn't reachable the request is allowed, so an outage of the cache doesn't lock everybody out.
+func (app *App) RateLimit(policies ...RateLimitPolicy) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var strictest *rateLimitResult
+
+			for _, policy := range policies {
+				key := policy.Key(r)
+				if len(key) == 0 {
+					continue
+				}
+
+				res, err := app.hitRateLimit(r.Context(), policy, key)
+				if err != nil {
+					logger.FromContext(r.Context()).WithFields(logrus.Fields{
+						"functionName": "bootstrap.RateLimit",
+						"policy":       policy.Name,
+						"error":        err,
+					}).Errorf("Error message : %s", err.Error())
+					continue
+				}
+
+				if !res.allowed {
+					setRateLimitHeaders(w, res)
+					app.SendTooManyRequests(w, utils.ErrTooManyRequests, res.retryAfter)
+					return
+				}
+
+				if strictest == nil || res.remaining < strictest.remaining {
+					strictest = &res
+				}
+			}
+
+			if strictest != nil {
+				setRateLimitHeaders(w, *strictest)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (app *App) hitRateLimit(ctx context.Context, policy RateLimitPolicy, key string) (rateLimitResult, error) {
+	var (
+		res    = rateLimitResult{policy: policy}
+		now    = time.Now().UnixMilli()
+		member = fmt.Sprintf("%d-%d", time.Now().UnixNano(), rand.Int63())
+	)
+
+	if app.Redis == nil {
+		return res, fmt.Errorf("redis client is not set")
+	}
+
+	redisKey := fmt.Sprintf("ratelimit:%s:%s", policy.Name, key)
+	values, err := slidingWindowScript.Run(ctx, app.Redis, []string{redisKey}, now, policy.Window.Milliseconds(), policy.Limit, member).Int64Slice()
+	if err != nil {
+		return res, err
+	}
+	if len(values) != 3 {
+		return res, fmt.Errorf("unexpected rate limit result %v", values)
+	}
+
+	res.allowed = values[0] == 1
+	res.remaining = policy.Limit - int(values[1])
+	if res.remaining < 0 {
+		res.remaining = 0
+	}
+	res.retryAfter = time.Duration(values[2]) * time.Millisecond
+
+	return res, nil
+}
+
+// setRateLimitHeaders write the RateLimit-* headers (IETF draft) and Retry-After when refused
+func setRateLimitHeaders(w http.ResponseWriter, res rateLimitResult) {
+	reset := int(math.Ceil(res.retryAfter.Seconds()))
+
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(res.policy.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(reset))
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", res.policy.Limit, int(res.policy.Window.Seconds())))
+}
+
+// KeyByIP count the requests per client IP. RemoteAddr is set from the
+// X-Forwarded-For/X-Real-IP headers only when app.trust_proxy is enabled.
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// maxKeyBody the size of the body a key func reads to find its key
+const maxKeyBody = 64 << 10
+
+// peekBody read at most maxKeyBody of the body, the body is restored so the handler gets it whole
+func peekBody(r *http.Request) ([]byte, error) {
+	// everything read is kept, with the rest of the body
+	var read bytes.Buffer
+	body := r.Body
+	data, err := io.ReadAll(http.MaxBytesReader(nil, io.NopCloser(io.TeeReader(body, &read)), maxKeyBody))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(&read, body), body}
+
+	return data, err
+}
+
+// KeyByEmail count the requests per email of the JSON body.
+// A body larger than maxKeyBody is counted per client IP instead.
+func KeyByEmail(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+
+	data, err := peekBody(r)
+	if err != nil {
+		return KeyByIP(r)
+	}
+
+	payload := struct {
+		Email string `json:"email"`
+	}{}
+	if err = json.Unmarshal(data, &payload); err != nil {
+		return ""
+	}
+
+	return strings.ToLower(strings.TrimSpace(payload.Email))
+}
+
+// KeyByChallengeUser count the requests per user of the 2FA challenge token of the JSON body,
+// so the attempts of a user are limited whatever the IP. An invalid token isn't counted,
+// the handler refuses it. A body larger than maxKeyBody is counted per client IP instead.
+func (app *App) KeyByChallengeUser(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+
+	data, err := peekBody(r)
+	if err != nil {
+		return KeyByIP(r)
+	}
+
+	payload := struct {
+		ChallengeToken string `json:"challenge_token"`
+	}{}
+	if err = json.Unmarshal(data, &payload); err != nil {
+		return ""
+	}
+
+	claims := &CustomUserClaims{}
+	_, err = jwt.ParseWithClaims(payload.ChallengeToken, claims, app.JWTKeys.Keyfunc)
+	if err != nil || claims.Purpose != PurposeTwoFactor {
+		return ""
+	}
+
+	return claims.UserIdentifier
+}
+
+// KeyByUserIdentifier count the requests per logged in user, use it after VerifyJwtTokenUser
+func KeyByUserIdentifier(r *http.Request) string {
+	identifier, ok := r.Context().Value("identifier").(map[string]string)
+	if !ok {
+		return ""
+	}
+
+	return identifier["user_identifier"]
+}
@@ -0,0 +1,120 @@
+package bootstrap
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"go-skeleton/lib/logger"
+	"go-skeleton/lib/tracing"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+// RequestIDHeader header of the request id, taken from the caller when it's valid
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength longer ids sent by the caller are replaced
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// accessLog one JSON line per request on stdout
+var accessLog = newAccessLogger()
+
+func newAccessLogger() *logrus.Logger {
+	l := logrus.New()
+	l.Out = os.Stdout
+	l.Formatter = &logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano}
+	l.AddHook(tracing.LogrusHook{})
+
+	return l
+}
+
+// RequestID honor the X-Request-ID of the caller or generate one, it's returned in the response
+// and put with the method, path and channel in the fields of logger.FromContext
+func (app *App) RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		ctx = logger.NewContext(ctx, logrus.Fields{
+			"request_id": id,
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"channel":    app.GetChannel(r),
+		})
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// GetRequestID the id of the request, empty outside of the RequestID middleware
+func (app *App) GetRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// AccessLog write the JSON access log of the request, use it after RequestID
+func (app *App) AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		fields := logger.Fields(r.Context())
+		fields["status"] = status
+		fields["bytes"] = ww.BytesWritten()
+		fields["latency_ms"] = float64(time.Since(start).Microseconds()) / 1000
+		fields["remote_ip"] = r.RemoteAddr
+		fields["user_agent"] = r.UserAgent()
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := rctx.RoutePattern(); len(pattern) > 0 {
+				fields["route"] = pattern
+			}
+		}
+
+		entry := accessLog.WithContext(r.Context()).WithFields(fields)
+		switch {
+		case status >= http.StatusInternalServerError:
+			entry.Error("request")
+		case status >= http.StatusBadRequest:
+			entry.Warn("request")
+		default:
+			entry.Info("request")
+		}
+	})
+}
+
+// validRequestID accept only short printable ascii ids, the id is written in the logs
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,51 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"go-skeleton/lib/apperr"
+	"net/http"
+	"time"
+)
+
+// timeoutWriter remember if the handler has written the response
+type timeoutWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.written = true
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.written = true
+	return tw.ResponseWriter.Write(b)
+}
+
+// Timeout cancel the request context after the timeout of the route, it can be overridden
+// in config with http.timeout.<name> (seconds). The handlers pass the context down to the
+// queries, so they return with a context error that is sent as 504, or 499 when the client
+// has gone. A handler that doesn't answer after the cancellation gets the same response.
+func (app *App) Timeout(name string, timeout time.Duration) func(next http.Handler) http.Handler {
+	if t := app.Config.GetInt(fmt.Sprintf("http.timeout.%s", name)); t > 0 {
+		timeout = time.Duration(t) * time.Second
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			tw := &timeoutWriter{ResponseWriter: w}
+			next.ServeHTTP(tw, r.WithContext(ctx))
+
+			if !tw.written {
+				if ctxErr, ok := apperr.FromContext(ctx.Err()); ok {
+					app.SendError(w, ctxErr)
+				}
+			}
+		})
+	}
+}
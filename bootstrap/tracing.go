@@ -0,0 +1,41 @@
+package bootstrap
+
+import (
+	"go-skeleton/lib/tracing"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceIDHeader response header with the trace id of the request
+const TraceIDHeader = "X-Trace-ID"
+
+// TracingMiddleware create the server span of the request with otelhttp, child of the
+// traceparent sent by the caller. The trace id is returned in X-Trace-ID so a client can report it.
+func (app *App) TracingMiddleware(next http.Handler) http.Handler {
+	if !tracing.Enabled() {
+		return next
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := trace.SpanFromContext(r.Context())
+		w.Header().Set(TraceIDHeader, span.SpanContext().TraceID().String())
+
+		next.ServeHTTP(w, r)
+
+		// the route pattern is only known once chi has routed the request
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := rctx.RoutePattern(); len(pattern) > 0 {
+				span.SetName(r.Method + " " + pattern)
+				span.SetAttributes(semconv.HTTPRouteKey.String(pattern))
+			}
+		}
+	})
+
+	return otelhttp.NewHandler(handler, "HTTP", otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return "HTTP " + r.Method
+	}))
+}
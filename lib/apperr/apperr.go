@@ -0,0 +1,113 @@
+package apperr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-skeleton/lib/utils"
+)
+
+// Kind category of the error, it decides the http status of the response
+type Kind string
+
+const (
+	NotFound        Kind = "not_found"
+	Conflict        Kind = "conflict"
+	Validation      Kind = "validation"
+	Unauthorized    Kind = "unauthorized"
+	Forbidden       Kind = "forbidden"
+	TooManyRequests Kind = "too_many_requests"
+	Timeout         Kind = "timeout"
+	Canceled        Kind = "canceled"
+	Internal        Kind = "internal"
+)
+
+// Error application error with a stable machine code and a message that is
+// safe to show to the user, the cause is only logged.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Cause   error
+}
+
+// Error give the user message, so err.Error() stays the same as the former string errors
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Is match another *Error by code, e.g. errors.Is(err, apperr.New(apperr.NotFound, apperr.CodeEmptyData, ""))
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+
+	return e.Code == t.Code
+}
+
+// String detail of the error with the cause, for the logs
+func (e *Error) String() string {
+	if e.Cause == nil {
+		return fmt.Sprintf("%s [%s]: %s", e.Kind, e.Code, e.Message)
+	}
+
+	return fmt.Sprintf("%s [%s]: %s: %v", e.Kind, e.Code, e.Message, e.Cause)
+}
+
+// New create an error without cause
+func New(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// Wrap create an error caused by err
+func Wrap(err error, kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message, Cause: err}
+}
+
+// As give the *Error in the chain of err
+func As(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+
+	return nil, false
+}
+
+// FromContext turn a cancelled or timed out context error into an *Error, ok is false for other errors
+func FromContext(err error) (*Error, bool) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return Wrap(err, Timeout, CodeTimeout, utils.ErrRequestTimeout), true
+	case errors.Is(err, context.Canceled):
+		return Wrap(err, Canceled, CodeClientClosedRequest, utils.ErrRequestCanceled), true
+	}
+
+	return nil, false
+}
+
+// KindOf give the kind of err, an error that isn't an *Error is Internal
+func KindOf(err error) Kind {
+	if e, ok := As(err); ok {
+		return e.Kind
+	}
+
+	return Internal
+}
+
+// IsKind check the kind of err
+func IsKind(err error, kind Kind) bool {
+	e, ok := As(err)
+	return ok && e.Kind == kind
+}
+
+// HasCode check the code of err
+func HasCode(err error, code string) bool {
+	e, ok := As(err)
+	return ok && e.Code == code
+}
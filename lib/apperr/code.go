@@ -0,0 +1,50 @@
+package apperr
+
+// Stable machine codes, the response stat_code is "ERR:" + code.
+// Clients rely on them, so don't rename an existing code.
+const (
+	// General
+	CodeEmptyData  = "EMPTY_DATA"
+	CodeConflict   = "CONFLICT"
+	CodeBadRequest = "BAD_REQUEST"
+	CodeInternal   = "INTERNAL"
+
+	// Request
+	CodeTimeout             = "TIMEOUT"
+	CodeClientClosedRequest = "CLIENT_CLOSED_REQUEST"
+
+	// Auth
+	CodeInvalidCredentials     = "INVALID_CREDENTIALS"
+	CodeEmailNotVerified       = "EMAIL_NOT_VERIFIED"
+	CodeEmailAlreadyRegistered = "EMAIL_ALREADY_REGISTERED"
+	CodeAccountLocked          = "ACCOUNT_LOCKED"
+	CodeInvalidToken           = "INVALID_TOKEN"
+	CodeTokenExpired           = "TOKEN_EXPIRED"
+	CodeTokenUsed              = "TOKEN_USED"
+	CodeSessionRevoked         = "SESSION_REVOKED"
+	CodeRefreshTokenReused     = "REFRESH_TOKEN_REUSED"
+	CodeSocialEmailNotVerified = "SOCIAL_EMAIL_NOT_VERIFIED"
+	CodePasswordMismatch       = "PASSWORD_MISMATCH"
+	CodeInvalidPassword        = "INVALID_PASSWORD"
+	CodeInvalidEmailType       = "INVALID_EMAIL_TYPE"
+
+	// Two-factor authentication
+	CodeInvalidTwoFactorCode    = "INVALID_TWO_FACTOR_CODE"
+	CodeTwoFactorAlreadyEnabled = "TWO_FACTOR_ALREADY_ENABLED"
+	CodeTwoFactorNotEnabled     = "TWO_FACTOR_NOT_ENABLED"
+	CodeTwoFactorNotEnrolled    = "TWO_FACTOR_NOT_ENROLLED"
+	CodeTwoFactorChallengeUsed  = "TWO_FACTOR_CHALLENGE_USED"
+
+	// Setting
+	CodeInvalidContentType = "INVALID_CONTENT_TYPE"
+
+	// Upload
+	CodeFileTypeNotAllowed = "FILE_TYPE_NOT_ALLOWED"
+	CodeFileTooLarge       = "FILE_TOO_LARGE"
+
+	// Resumable upload
+	CodeUnsupportedTusVersion = "UNSUPPORTED_TUS_VERSION"
+	CodeUploadOffsetMismatch  = "UPLOAD_OFFSET_MISMATCH"
+	CodeUploadLocked          = "UPLOAD_LOCKED"
+	CodeUploadExpired         = "UPLOAD_EXPIRED"
+)
@@ -1,16 +1,24 @@
 package facebook
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
-	"errors"
-	"fmt"
 	"go-skeleton/bootstrap"
+	"go-skeleton/lib/apperr"
+	"go-skeleton/lib/tracing"
+	"go-skeleton/lib/utils"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"time"
 )
 
 const (
 	FACEBOOK_VERIFY_URL = "https://graph.facebook.com/v2.5/me"
+	FACEBOOK_DEBUG_URL  = "https://graph.facebook.com/debug_token"
 )
 
 type service struct {
@@ -18,42 +26,115 @@ type service struct {
 }
 
 type FacebookTokenResponse struct {
-	ID    string `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+}
+
+// debugTokenResponse the token inspected by the debug_token endpoint
+type debugTokenResponse struct {
+	Data struct {
+		AppID   string `json:"app_id"`
+		UserID  string `json:"user_id"`
+		IsValid bool   `json:"is_valid"`
+	} `json:"data"`
 }
 
 func New(app *bootstrap.App) *service {
 	return &service{app}
 }
 
-func (s *service) Verify(token string) (FacebookTokenResponse, error) {
+// Enabled the facebook login is served only with an app, without it a token of any app would be accepted
+func Enabled(app *bootstrap.App) bool {
+	return len(app.Config.GetString("facebook.app_id")) > 0 && len(app.Config.GetString("facebook.app_secret")) > 0
+}
+
+// verifyURL the graph endpoint, can be changed with facebook.verify_url to test against a stub server
+func (s *service) verifyURL() string {
+	if u := s.app.Config.GetString("facebook.verify_url"); len(u) > 0 {
+		return u
+	}
+
+	return FACEBOOK_VERIFY_URL
+}
+
+// debugURL the debug_token endpoint, can be changed with facebook.debug_url
+func (s *service) debugURL() string {
+	if u := s.app.Config.GetString("facebook.debug_url"); len(u) > 0 {
+		return u
+	}
+
+	return FACEBOOK_DEBUG_URL
+}
+
+// Verify check the token was issued to our app with debug_token, then get the profile of
+// its user, the call is signed with the appsecret_proof
+func (s *service) Verify(ctx context.Context, token string) (FacebookTokenResponse, error) {
 	var (
-		err    error
-		client = &http.Client{}
-		res    = FacebookTokenResponse{}
+		client    = &http.Client{Timeout: 10 * time.Second, Transport: tracing.NewTransport(nil)}
+		res       = FacebookTokenResponse{}
+		debug     = debugTokenResponse{}
+		appID     = s.app.Config.GetString("facebook.app_id")
+		appSecret = s.app.Config.GetString("facebook.app_secret")
 	)
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s?access_token=%s&fields=%s", FACEBOOK_VERIFY_URL, token, "id,name,email"), nil)
+	if len(appID) == 0 || len(appSecret) == 0 {
+		return res, apperr.New(apperr.Unauthorized, apperr.CodeInvalidToken, utils.ErrInvalidToken)
+	}
+
+	param := url.Values{}
+	param.Set("input_token", token)
+	param.Set("access_token", appID+"|"+appSecret)
+	if err := getJSON(ctx, client, s.debugURL()+"?"+param.Encode(), &debug); err != nil {
+		return res, err
+	}
+	if !debug.Data.IsValid || debug.Data.AppID != appID || len(debug.Data.UserID) == 0 {
+		return res, apperr.New(apperr.Unauthorized, apperr.CodeInvalidToken, utils.ErrInvalidToken)
+	}
+
+	mac := hmac.New(sha256.New, []byte(appSecret))
+	mac.Write([]byte(token))
+
+	param = url.Values{}
+	param.Set("access_token", token)
+	param.Set("appsecret_proof", hex.EncodeToString(mac.Sum(nil)))
+	param.Set("fields", "id,name,first_name,last_name,email")
+	if err := getJSON(ctx, client, s.verifyURL()+"?"+param.Encode(), &res); err != nil {
+		return res, err
+	}
+
+	if len(res.Email) < 1 || res.ID != debug.Data.UserID {
+		return res, apperr.New(apperr.Unauthorized, apperr.CodeInvalidToken, utils.ErrInvalidToken)
+	}
+
+	return res, nil
+}
+
+// getJSON decode the response of the graph api, any failure is an invalid token
+func getJSON(ctx context.Context, client *http.Client, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
 	if err != nil {
-		return res, errors.New("invalid token")
+		return apperr.New(apperr.Unauthorized, apperr.CodeInvalidToken, utils.ErrInvalidToken)
 	}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	response, err := client.Do(req)
 	if err != nil {
-		return res, errors.New("invalid token")
+		return apperr.New(apperr.Unauthorized, apperr.CodeInvalidToken, utils.ErrInvalidToken)
 	}
 	defer response.Body.Close()
 
+	if response.StatusCode != http.StatusOK {
+		return apperr.New(apperr.Unauthorized, apperr.CodeInvalidToken, utils.ErrInvalidToken)
+	}
+
 	respData, err := ioutil.ReadAll(response.Body)
 	if err != nil {
-		return res, errors.New("invalid token")
+		return apperr.New(apperr.Unauthorized, apperr.CodeInvalidToken, utils.ErrInvalidToken)
 	}
-	json.Unmarshal(respData, &res)
-
-	if len(res.Email) < 1 {
-		return res, errors.New("invalid token")
+	if err = json.Unmarshal(respData, v); err != nil {
+		return apperr.New(apperr.Unauthorized, apperr.CodeInvalidToken, utils.ErrInvalidToken)
 	}
 
-	return res, err
+	return nil
 }
@@ -2,13 +2,16 @@ package google
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"go-skeleton/bootstrap"
+	"go-skeleton/lib/apperr"
+	"go-skeleton/lib/tracing"
 	"go-skeleton/lib/utils"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 const (
@@ -20,43 +23,77 @@ type service struct {
 }
 
 type GoogleTokenResponse struct {
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	Sub           string `json:"sub"`
+	Aud           string `json:"aud"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Picture       string `json:"picture"`
+	Email         string `json:"email"`
+	EmailVerified string `json:"email_verified"`
 }
 
 func New(app *bootstrap.App) *service {
 	return &service{app}
 }
 
-func (s *service) Verify(token string) (GoogleTokenResponse, error) {
+// Enabled the google login is served only with a client id, without it a token of any app would be accepted
+func Enabled(app *bootstrap.App) bool {
+	return len(app.Config.GetString("google.client_id")) > 0
+}
+
+// verifyURL the tokeninfo endpoint, can be changed with google.verify_url to test against a stub server
+func (s *service) verifyURL() string {
+	if u := s.app.Config.GetString("google.verify_url"); len(u) > 0 {
+		return u
+	}
+
+	return GOOGLE_VERIFY_URL
+}
+
+func (s *service) Verify(ctx context.Context, token string) (GoogleTokenResponse, error) {
 	var (
 		err    error
-		client = &http.Client{}
+		client = &http.Client{Timeout: 10 * time.Second, Transport: tracing.NewTransport(nil)}
 		res    = GoogleTokenResponse{}
 		param  = url.Values{}
 	)
 	param.Set("id_token", token)
 
 	var payload = bytes.NewBufferString(param.Encode())
-	req, err := http.NewRequest(http.MethodPost, GOOGLE_VERIFY_URL, payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.verifyURL(), payload)
 	if err != nil {
-		return res, errors.New(utils.ErrInvalidToken)
+		return res, apperr.New(apperr.Unauthorized, apperr.CodeInvalidToken, utils.ErrInvalidToken)
 	}
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	response, err := client.Do(req)
 	if err != nil {
-		return res, errors.New(utils.ErrInvalidToken)
+		return res, apperr.New(apperr.Unauthorized, apperr.CodeInvalidToken, utils.ErrInvalidToken)
 	}
 
 	defer response.Body.Close()
 
+	if response.StatusCode != http.StatusOK {
+		return res, apperr.New(apperr.Unauthorized, apperr.CodeInvalidToken, utils.ErrInvalidToken)
+	}
+
 	respData, err := ioutil.ReadAll(response.Body)
-	json.Unmarshal(respData, &res)
+	if err != nil {
+		return res, apperr.New(apperr.Unauthorized, apperr.CodeInvalidToken, utils.ErrInvalidToken)
+	}
+	if err = json.Unmarshal(respData, &res); err != nil {
+		return res, apperr.New(apperr.Unauthorized, apperr.CodeInvalidToken, utils.ErrInvalidToken)
+	}
+
+	if len(res.Email) < 1 || len(res.Sub) < 1 {
+		return res, apperr.New(apperr.Unauthorized, apperr.CodeInvalidToken, utils.ErrInvalidToken)
+	}
 
-	if len(res.Email) < 1 {
-		return res, errors.New(utils.ErrInvalidToken)
+	// the token must be issued for our client id
+	if clientID := s.app.Config.GetString("google.client_id"); len(clientID) == 0 || res.Aud != clientID {
+		return res, apperr.New(apperr.Unauthorized, apperr.CodeInvalidToken, utils.ErrInvalidToken)
 	}
 
-	return res, err
+	return res, nil
 }
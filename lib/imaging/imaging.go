@@ -0,0 +1,212 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go-skeleton/lib/utils"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// defaults of the pipeline when upload.image.* is empty
+const (
+	DefaultMaxDimension = 2048
+	DefaultQuality      = 85
+)
+
+// DefaultVariants the thumbnail sizes when upload.image.variants is empty
+var DefaultVariants = []int{64, 256, 1024}
+
+// MaxPixels of a decoded image, the dimensions of a small file can need gigabytes of memory
+const MaxPixels = 50_000_000
+
+var (
+	// ErrNotImage the content isn't a decodable jpeg, png or webp image
+	ErrNotImage = errors.New("imaging: unsupported or invalid image")
+	// ErrTooLarge the image has more than MaxPixels
+	ErrTooLarge = errors.New("imaging: image dimensions are too large")
+)
+
+// Options of the pipeline
+type Options struct {
+	// MaxDimension of the longest side of the original, a larger image is downscaled
+	MaxDimension int
+	// Variants the longest side of the thumbnails, an image is never upscaled
+	Variants []int
+	// Quality of the jpeg encoding, 1 to 100
+	Quality int
+}
+
+// OptionsFromConfig the options of upload.image.{max_dimension, variants, quality}, the
+// variants are comma separated sizes e.g. "64,256,1024"
+func OptionsFromConfig(config utils.Config) Options {
+	opts := Options{
+		MaxDimension: config.GetInt("upload.image.max_dimension"),
+		Quality:      config.GetInt("upload.image.quality"),
+	}
+	if opts.MaxDimension <= 0 {
+		opts.MaxDimension = DefaultMaxDimension
+	}
+	if opts.Quality <= 0 || opts.Quality > 100 {
+		opts.Quality = DefaultQuality
+	}
+
+	for _, v := range strings.Split(config.GetString("upload.image.variants"), ",") {
+		if size, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && size > 0 {
+			opts.Variants = append(opts.Variants, size)
+		}
+	}
+	if len(opts.Variants) == 0 {
+		opts.Variants = DefaultVariants
+	}
+	sort.Ints(opts.Variants)
+
+	return opts
+}
+
+// Encoded an image encoded without its metadata
+type Encoded struct {
+	Data        []byte
+	Width       int
+	Height      int
+	ContentType string
+	// Ext of the format with the dot, e.g. .jpg
+	Ext string
+}
+
+// Variant a thumbnail of the image, Size is its configured size
+type Variant struct {
+	Encoded
+	Size int
+}
+
+// Result the processed original and its variants, smallest first
+type Result struct {
+	Original Encoded
+	Variants []Variant
+}
+
+// Supported the content type is processed by the pipeline
+func Supported(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/webp":
+		return true
+	}
+
+	return false
+}
+
+// Process decode the image, turn it upright from its EXIF orientation, downscale it to
+// MaxDimension and render the variants. Every output is re-encoded so no metadata (EXIF, GPS,
+// ICC, comments) of the upload is kept. The jpeg stay jpeg, the png stay png and the webp are
+// encoded as png when they have transparency or jpeg otherwise.
+func Process(r io.Reader, opts Options) (*Result, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotImage, err)
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotImage, err)
+	}
+
+	asPNG := format == "png" || (format == "webp" && !opaque(img))
+
+	// downscaled first, turning the smaller image is cheaper
+	res := &Result{}
+	original := fit(img, opts.MaxDimension)
+	if format == "jpeg" {
+		original = orient(original, jpegOrientation(content))
+	}
+	if res.Original, err = encode(original, asPNG, opts.Quality); err != nil {
+		return nil, err
+	}
+
+	for _, size := range opts.Variants {
+		encoded, err := encode(fit(original, size), asPNG, opts.Quality)
+		if err != nil {
+			return nil, err
+		}
+		res.Variants = append(res.Variants, Variant{Encoded: encoded, Size: size})
+	}
+
+	return res, nil
+}
+
+// fit the image downscaled so its longest side is at most size
+func fit(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if size <= 0 || (w <= size && h <= size) {
+		return img
+	}
+
+	if w >= h {
+		h = max(1, h*size/w)
+		w = size
+	} else {
+		w = max(1, w*size/h)
+		h = size
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+
+	return dst
+}
+
+func encode(img image.Image, asPNG bool, quality int) (Encoded, error) {
+	var (
+		buf bytes.Buffer
+		err error
+		res = Encoded{Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}
+	)
+
+	if asPNG {
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+		res.ContentType, res.Ext = "image/png", ".png"
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+		res.ContentType, res.Ext = "image/jpeg", ".jpg"
+	}
+	res.Data = buf.Bytes()
+
+	return res, err
+}
+
+// opaque the image has no transparent pixel
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+
+	return false
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
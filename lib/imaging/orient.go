@@ -0,0 +1,127 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+// the EXIF orientations, 1 is upright
+const (
+	orientFlipH      = 2
+	orientRotate180  = 3
+	orientFlipV      = 4
+	orientTranspose  = 5
+	orientRotate90   = 6
+	orientTransverse = 7
+	orientRotate270  = 8
+)
+
+// jpegOrientation the orientation tag of the EXIF segment of the jpeg, 1 when there is none.
+// The camera stores the pixels as sensed and the viewer turns them, once the EXIF is stripped
+// the pixels themselves must be turned.
+func jpegOrientation(content []byte) int {
+	if len(content) < 4 || content[0] != 0xFF || content[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(content); {
+		if content[i] != 0xFF {
+			return 1
+		}
+		marker := content[i+1]
+		// start of scan, the metadata segments are before it
+		if marker == 0xDA {
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(content[i+2 : i+4]))
+		if size < 2 || i+2+size > len(content) {
+			return 1
+		}
+		segment := content[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + size
+	}
+
+	return 1
+}
+
+// exifOrientation the orientation tag of IFD0 of the TIFF structure of the EXIF segment
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[offset : offset+2]))
+	for n := 0; n < count; n++ {
+		entry := offset + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			value := int(order.Uint16(tiff[entry+8 : entry+10]))
+			if value < 1 || value > 8 {
+				return 1
+			}
+			return value
+		}
+	}
+
+	return 1
+}
+
+// orient the image turned upright from its orientation
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < orientFlipH || orientation > orientRotate270 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= orientTranspose {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case orientFlipH:
+				sx, sy = w-1-x, y
+			case orientRotate180:
+				sx, sy = w-1-x, h-1-y
+			case orientFlipV:
+				sx, sy = x, h-1-y
+			case orientTranspose:
+				sx, sy = y, x
+			case orientRotate90:
+				sx, sy = y, h-1-x
+			case orientTransverse:
+				sx, sy = w-1-y, h-1-x
+			case orientRotate270:
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,233 @@
+package jwtkey
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Key a verification key, with the private key when it can be used for signing
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.PrivateKey
+	Public  crypto.PublicKey
+}
+
+// KeySet the signing key and every key that is still accepted for verification
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+	secret  []byte
+}
+
+// JWK public key in the JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS set of public keys published at /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+var (
+	ErrUnknownKey      = errors.New("unknown key id")
+	ErrUnexpectedAlg   = errors.New("unexpected signing method")
+	ErrNoSigningKey    = errors.New("signing key doesn't exists")
+	ErrUnsupportedKey  = errors.New("unsupported key type, use RSA or ECDSA (P-256/P-384/P-521)")
+	ErrNoPrivateSigner = errors.New("signing key doesn't have a private key")
+)
+
+// NewHMAC key set signed with a shared secret (HS256) without key id
+func NewHMAC(secret string) *KeySet {
+	return &KeySet{secret: []byte(secret), keys: map[string]*Key{}}
+}
+
+// Load read every <kid>.pem file in dir. A file may contain a private key, that
+// can sign and verify, or only a public key, that is kept for verification
+// during a rotation window. The key named signingKid is used to sign new tokens.
+func Load(dir, signingKid string) (*KeySet, error) {
+	ks := &KeySet{keys: map[string]*Key{}}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return ks, err
+	}
+
+	for _, file := range files {
+		kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+		key, err := readKey(file)
+		if err != nil {
+			return ks, fmt.Errorf("%s: %v", file, err)
+		}
+		key.ID = kid
+		ks.keys[kid] = key
+	}
+
+	signing, ok := ks.keys[signingKid]
+	if !ok {
+		return ks, fmt.Errorf("%w: %s", ErrNoSigningKey, signingKid)
+	}
+	if signing.Private == nil {
+		return ks, fmt.Errorf("%w: %s", ErrNoPrivateSigner, signingKid)
+	}
+	ks.signing = signing
+
+	return ks, nil
+}
+
+// Sign create a signed token of the claims with the current signing key
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if ks.signing == nil {
+		if len(ks.secret) == 0 {
+			return "", ErrNoSigningKey
+		}
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ks.secret)
+	}
+
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	token.Header["kid"] = ks.signing.ID
+
+	return token.SignedString(ks.signing.Private)
+}
+
+// Keyfunc select the verification key by the kid header of the token
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if ks.signing == nil {
+		if jwt.SigningMethodHS256 != token.Method {
+			return nil, fmt.Errorf("%w: %v", ErrUnexpectedAlg, token.Header["alg"])
+		}
+		return ks.secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+
+	if key.Method.Alg() != token.Method.Alg() {
+		return nil, fmt.Errorf("%w: %v", ErrUnexpectedAlg, token.Header["alg"])
+	}
+
+	return key.Public, nil
+}
+
+// JWKS the public verification keys, empty for a shared secret key set
+func (ks *KeySet) JWKS() JWKS {
+	res := JWKS{Keys: []JWK{}}
+
+	kids := make([]string, 0, len(ks.keys))
+	for kid := range ks.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	for _, kid := range kids {
+		key := ks.keys[kid]
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = pub.Curve.Params().Name
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+			jwk.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+		}
+
+		res.Keys = append(res.Keys, jwk)
+	}
+
+	return res
+}
+
+// readKey parse the first PEM block of the file as a private or public key
+func readKey(file string) (*Key, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("invalid PEM file")
+	}
+
+	var (
+		key    = &Key{}
+		parsed interface{}
+	)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM type %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Private, key.Public = k, &k.PublicKey
+	case *ecdsa.PrivateKey:
+		key.Private, key.Public = k, &k.PublicKey
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		key.Public = k
+	default:
+		return nil, ErrUnsupportedKey
+	}
+
+	switch pub := key.Public.(type) {
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			key.Method = jwt.SigningMethodES256
+		case elliptic.P384():
+			key.Method = jwt.SigningMethodES384
+		case elliptic.P521():
+			key.Method = jwt.SigningMethodES512
+		default:
+			return nil, ErrUnsupportedKey
+		}
+	}
+
+	return key, nil
+}
@@ -0,0 +1,79 @@
+package logger
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// requestFields the fields of a request, shared by pointer so the fields added by the inner
+// middlewares (e.g. the user identifier once the token is verified) are seen by the access log
+type requestFields struct {
+	mu   sync.RWMutex
+	data logrus.Fields
+}
+
+type fieldsKey struct{}
+
+var std Contract
+
+// SetDefault the logger used by FromContext
+func SetDefault(c Contract) {
+	std = c
+}
+
+// NewContext return a copy of ctx carrying the fields, they are added to every entry of FromContext
+func NewContext(ctx context.Context, fields logrus.Fields) context.Context {
+	data := make(logrus.Fields, len(fields))
+	for k, v := range fields {
+		data[k] = v
+	}
+
+	return context.WithValue(ctx, fieldsKey{}, &requestFields{data: data})
+}
+
+// AddFields add the fields to the ones of NewContext, nothing is done when ctx has none
+func AddFields(ctx context.Context, fields logrus.Fields) {
+	rf, ok := ctx.Value(fieldsKey{}).(*requestFields)
+	if !ok {
+		return
+	}
+
+	rf.mu.Lock()
+	for k, v := range fields {
+		rf.data[k] = v
+	}
+	rf.mu.Unlock()
+}
+
+// Fields copy of the fields of ctx
+func Fields(ctx context.Context) logrus.Fields {
+	fields := logrus.Fields{}
+	rf, ok := ctx.Value(fieldsKey{}).(*requestFields)
+	if !ok {
+		return fields
+	}
+
+	rf.mu.RLock()
+	for k, v := range rf.data {
+		fields[k] = v
+	}
+	rf.mu.RUnlock()
+
+	return fields
+}
+
+// FromContext an entry of the default logger with the request fields of ctx (request_id,
+// user_identifier, channel...) so the logs can be correlated with the access log
+func FromContext(ctx context.Context) *logrus.Entry {
+	var log *logrus.Logger
+	if std != nil {
+		log = std.FromDefault()
+	}
+	if log == nil {
+		log = logrus.StandardLogger()
+	}
+
+	return log.WithContext(ctx).WithFields(Fields(ctx))
+}
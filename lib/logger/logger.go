@@ -1,87 +1,194 @@
 package logger
 
 import (
-	"log"
+	"fmt"
+	"go-skeleton/lib/tracing"
+	"io"
+	"io/ioutil"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/getsentry/sentry-go"
 	"github.com/sirupsen/logrus"
 )
 
+// Sink types
+const (
+	SinkStdout = "stdout"
+	SinkFile   = "file"
+	SinkSentry = "sentry"
+	SinkSyslog = "syslog"
+)
+
 // Contract ...
 type Contract interface {
-	Sentry() *logrus.Logger
-	File() *logrus.Logger
+	// FromDefault the logger writing to every sink
 	FromDefault() *logrus.Logger
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+	// Reopen reopen the log file, it's done on SIGHUP too
+	Reopen() error
+	// Close flush sentry and close the sinks
+	Close() error
+}
+
+// SinkOptions a destination of the logs with its minimum level and format
+type SinkOptions struct {
+	Type   string
+	Level  logrus.Level
+	Format string
+	// File options of the file sink
+	File RotateOptions
+	// SentryDSN dsn of the sentry sink
+	SentryDSN string
+	// Syslog options of the syslog sink
+	Syslog SyslogOptions
+}
+
+// Options of the logger, every entry is sent to each sink that accepts its level
+type Options struct {
+	Sinks []SinkOptions
 }
 
 // logs ...
 type logs struct {
-	Logrus      *logrus.Logger
-	DefaultType string
-	Source      string
+	Logrus  *logrus.Logger
+	file    *RotatingFile
+	closers []io.Closer
+	sentry  bool
 }
 
-// New instantiate the logger package
-func NewLogger(tp, source string) Contract {
-	return &logs{
-		Logrus:      logrus.New(),
-		DefaultType: tp,
-		Source:      source,
+// New instantiate the logger package, the sinks are opened once here. A sink that can't be
+// opened is reported on stderr and skipped so the app still starts.
+func NewLogger(opts Options) Contract {
+	th := &logs{Logrus: logrus.New()}
+	th.Logrus.Out = ioutil.Discard
+	th.Logrus.Formatter = discardFormatter{}
+	th.Logrus.Level = logrus.PanicLevel
+	// entries created WithContext(ctx) get the trace_id and span_id of the request,
+	// it's added first so every sink gets the fields
+	th.Logrus.AddHook(tracing.LogrusHook{})
+
+	for _, sink := range opts.Sinks {
+		if err := th.addSink(sink); err != nil {
+			fmt.Fprintf(os.Stderr, "logger: sink %s disabled: %v\n", sink.Type, err)
+			continue
+		}
+		// the logger creates the entries needed by the most verbose sink
+		if sink.Level > th.Logrus.Level {
+			th.Logrus.Level = sink.Level
+		}
 	}
-}
 
-func (th logs) FromDefault() *logrus.Logger {
-	var log *logrus.Logger
-	switch def := th.DefaultType; def {
-	case "file":
-		log = th.File()
-	case "sentry":
-		log = th.Sentry()
+	if th.file != nil {
+		go th.reopenOnSIGHUP()
 	}
 
-	// log.SetFormatter(&logrus.JSONFormatter{})
-	return log
+	return th
 }
 
-// File is a function to set logrus with file
-func (th logs) File() *logrus.Logger {
-	var (
-		err  error
-		file *os.File
-	)
-	path := th.Source
-	// if file exist then open and append/write into log file.
-	if _, err = os.Stat(path); err == nil {
-		file, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, os.ModeAppend)
-		if err == nil {
-			th.Logrus.Out = file
-
-			return th.Logrus
+func (th *logs) addSink(sink SinkOptions) error {
+	var w io.Writer
+
+	switch sink.Type {
+	case SinkStdout:
+		w = os.Stdout
+	case SinkFile:
+		if th.file != nil {
+			return fmt.Errorf("only one file sink is supported")
+		}
+		file, err := OpenRotatingFile(sink.File)
+		if err != nil {
+			return err
+		}
+		th.file = file
+		th.closers = append(th.closers, file)
+		w = file
+	case SinkSyslog:
+		syslog, err := newSyslogWriter(sink.Syslog)
+		if err != nil {
+			return err
+		}
+		th.closers = append(th.closers, syslog)
+		w = syslog
+	case SinkSentry:
+		if len(sink.SentryDSN) == 0 {
+			return fmt.Errorf("the sentry dsn is empty")
 		}
+		if err := sentry.Init(sentry.ClientOptions{Dsn: sink.SentryDSN}); err != nil {
+			return err
+		}
+		th.sentry = true
+		th.Logrus.AddHook(NewSentry(levelsFrom(sink.Level)))
+		return nil
+	default:
+		return fmt.Errorf("unknown sink")
 	}
 
-	file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0755)
-	if err == nil {
-		th.Logrus.Out = file
-	} else {
-		th.Logrus.Info("Failed to log to file, using default stderr")
+	hook, err := newSinkHook(sink.Level, sink.Format, w)
+	if err != nil {
+		return err
 	}
+	th.Logrus.AddHook(hook)
 
-	defer file.Close()
+	return nil
+}
 
+func (th *logs) FromDefault() *logrus.Logger {
 	return th.Logrus
 }
 
-// Sentry is a function for setting Sentry.io logger
-func (th logs) Sentry() *logrus.Logger {
-	if err := sentry.Init(sentry.ClientOptions{Dsn: th.Source}); err != nil {
-		log.Fatal(err)
+func (th *logs) Debugf(format string, args ...interface{}) {
+	th.Logrus.Debugf(format, args...)
+}
+
+func (th *logs) Infof(format string, args ...interface{}) {
+	th.Logrus.Infof(format, args...)
+}
+
+func (th *logs) Warnf(format string, args ...interface{}) {
+	th.Logrus.Warnf(format, args...)
+}
+
+func (th *logs) Errorf(format string, args ...interface{}) {
+	th.Logrus.Errorf(format, args...)
+}
+
+func (th *logs) Reopen() error {
+	if th.file == nil {
+		return nil
 	}
 
-	th.Logrus.AddHook(NewSentry(
-		[]logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel},
-	))
+	return th.file.Reopen()
+}
 
-	return th.Logrus
+func (th *logs) Close() error {
+	// the events are sent in background, wait for the queued ones
+	if th.sentry {
+		sentry.Flush(2 * time.Second)
+	}
+
+	var err error
+	for _, c := range th.closers {
+		if cErr := c.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}
+
+	return err
+}
+
+// reopenOnSIGHUP reopen the file after it was moved by logrotate
+func (th *logs) reopenOnSIGHUP() {
+	sng := make(chan os.Signal, 1)
+	signal.Notify(sng, syscall.SIGHUP)
+	for range sng {
+		if err := th.Reopen(); err != nil {
+			fmt.Fprintf(os.Stderr, "logger: failed to reopen the log file: %v\n", err)
+		}
+	}
 }
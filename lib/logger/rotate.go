@@ -0,0 +1,270 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat suffix of the rotated files, it sorts in the order of the rotations
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotateOptions of the rotating file, a zero value disables the matching rotation or retention
+type RotateOptions struct {
+	Path string
+	// MaxSize rotate once the file would grow past this size in bytes
+	MaxSize int64
+	// Interval rotate at every hour (time.Hour) or every midnight (24 * time.Hour)
+	Interval time.Duration
+	// MaxBackups number of rotated files kept
+	MaxBackups int
+	// MaxAge rotated files older than this are removed
+	MaxAge time.Duration
+	// Compress gzip the rotated files
+	Compress bool
+}
+
+// RotatingFile io.Writer on a log file that is opened once and rotated by size and time,
+// the rotated files are renamed <path>.<time> then compressed and pruned in background
+type RotatingFile struct {
+	opts RotateOptions
+
+	mu         sync.Mutex
+	file       *os.File
+	size       int64
+	nextRotate time.Time
+
+	// millMu serialize the compression and the pruning of the rotated files
+	millMu sync.Mutex
+}
+
+// OpenRotatingFile open or create the file in append mode
+func OpenRotatingFile(opts RotateOptions) (*RotatingFile, error) {
+	if len(opts.Path) == 0 {
+		return nil, fmt.Errorf("logger: the path of the log file is empty")
+	}
+
+	rf := &RotatingFile{opts: opts}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+
+	return rf, nil
+}
+
+func (rf *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(rf.opts.Path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(rf.opts.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	rf.file = file
+	rf.size = info.Size()
+	rf.nextRotate = nextRotation(time.Now(), rf.opts.Interval)
+
+	return nil
+}
+
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	sizeExceeded := rf.opts.MaxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.opts.MaxSize
+	intervalPassed := !rf.nextRotate.IsZero() && !time.Now().Before(rf.nextRotate)
+	if sizeExceeded || intervalPassed {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+
+	return n, err
+}
+
+// Rotate rotate the file now
+func (rf *RotatingFile) Rotate() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	return rf.rotate()
+}
+
+func (rf *RotatingFile) rotate() error {
+	if rf.file != nil {
+		if err := rf.file.Close(); err != nil {
+			return err
+		}
+		rf.file = nil
+	}
+
+	backup := rf.opts.Path + "." + time.Now().Format(backupTimeFormat)
+	if err := os.Rename(rf.opts.Path, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := rf.open(); err != nil {
+		return err
+	}
+
+	go rf.mill(backup)
+
+	return nil
+}
+
+// Reopen close and open the file again, for the rotation done by an external tool such as
+// logrotate that renames the file then sends SIGHUP
+func (rf *RotatingFile) Reopen() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file != nil {
+		if err := rf.file.Close(); err != nil {
+			return err
+		}
+		rf.file = nil
+	}
+
+	return rf.open()
+}
+
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return nil
+	}
+	err := rf.file.Close()
+	rf.file = nil
+
+	return err
+}
+
+// mill compress the new backup then remove the backups over MaxBackups or MaxAge
+func (rf *RotatingFile) mill(backup string) {
+	rf.millMu.Lock()
+	defer rf.millMu.Unlock()
+
+	if rf.opts.Compress {
+		if err := compressFile(backup); err != nil {
+			fmt.Fprintf(os.Stderr, "logger: can't compress %s: %v\n", backup, err)
+		}
+	}
+
+	backups, err := rf.backups()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "logger: can't list the backups of %s: %v\n", rf.opts.Path, err)
+		return
+	}
+
+	// newest first
+	for i, b := range backups {
+		expired := rf.opts.MaxAge > 0 && time.Since(b.modTime) > rf.opts.MaxAge
+		tooMany := rf.opts.MaxBackups > 0 && i >= rf.opts.MaxBackups
+		if expired || tooMany {
+			if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "logger: can't remove %s: %v\n", b.path, err)
+			}
+		}
+	}
+}
+
+type backupFile struct {
+	path    string
+	modTime time.Time
+}
+
+// backups the rotated files, newest first
+func (rf *RotatingFile) backups() ([]backupFile, error) {
+	dir := filepath.Dir(rf.opts.Path)
+	prefix := filepath.Base(rf.opts.Path) + "."
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []backupFile
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if _, err := time.Parse(backupTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".gz")); err != nil {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backupFile{path: filepath.Join(dir, name), modTime: info.ModTime()})
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].path > backups[j].path })
+
+	return backups, nil
+}
+
+// compressFile gzip the file to <path>.gz and remove it
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err == nil {
+		err = gz.Close()
+	}
+	if cErr := dst.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// nextRotation the next hour or the next midnight (local time) after now, zero without interval
+func nextRotation(now time.Time, interval time.Duration) time.Time {
+	switch {
+	case interval <= 0:
+		return time.Time{}
+	case interval >= 24*time.Hour:
+		y, m, d := now.Date()
+		return time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+	}
+
+	return now.Truncate(interval).Add(interval)
+}
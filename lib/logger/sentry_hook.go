@@ -4,7 +4,6 @@ package logger
 
 import (
 	"reflect"
-	"time"
 
 	"github.com/getsentry/sentry-go"
 	"github.com/sirupsen/logrus"
@@ -76,9 +75,10 @@ func (hook Hook) Levels() []logrus.Level {
 	return hook.levels
 }
 
+// Fire queue the event, the sentry transport sends it in background so the request isn't
+// blocked, the queued events are flushed by Close
 func (hook Hook) Fire(entry *logrus.Entry) error {
 	event := sentry.NewEvent()
-	defer sentry.Flush(2 * time.Second)
 	for k, v := range hook.extra {
 		event.Extra[k] = v
 	}
@@ -0,0 +1,117 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Sink formats
+const (
+	FormatText   = "text"
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+)
+
+// levelWriter a writer that needs the level of the entry, e.g. the syslog priority
+type levelWriter interface {
+	WriteLevel(level logrus.Level, p []byte) error
+}
+
+// sinkHook write the entries from Level to its writer with its own formatter, every sink
+// is a hook so each one can have its level and format on the same logger
+type sinkHook struct {
+	levels    []logrus.Level
+	formatter logrus.Formatter
+	writer    io.Writer
+}
+
+func newSinkHook(level logrus.Level, format string, w io.Writer) (*sinkHook, error) {
+	formatter, err := NewFormatter(format)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sinkHook{levels: levelsFrom(level), formatter: formatter, writer: w}, nil
+}
+
+func (h *sinkHook) Levels() []logrus.Level {
+	return h.levels
+}
+
+func (h *sinkHook) Fire(entry *logrus.Entry) error {
+	b, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+
+	if lw, ok := h.writer.(levelWriter); ok {
+		return lw.WriteLevel(entry.Level, b)
+	}
+	_, err = h.writer.Write(b)
+
+	return err
+}
+
+// levelsFrom the level and every more severe one
+func levelsFrom(level logrus.Level) []logrus.Level {
+	var levels []logrus.Level
+	for _, l := range logrus.AllLevels {
+		if l <= level {
+			levels = append(levels, l)
+		}
+	}
+
+	return levels
+}
+
+// NewFormatter the formatter of text (human readable), json or logfmt, text when empty
+func NewFormatter(format string) (logrus.Formatter, error) {
+	switch format {
+	case "", FormatText:
+		return &textFormatter{}, nil
+	case FormatJSON:
+		return &logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano}, nil
+	case FormatLogfmt:
+		return &logrus.TextFormatter{DisableColors: true, FullTimestamp: true, TimestampFormat: time.RFC3339Nano, QuoteEmptyFields: true}, nil
+	}
+
+	return nil, fmt.Errorf("logger: unknown format %q", format)
+}
+
+// textFormatter `2006-01-02T15:04:05Z07:00 ERROR message key=value ...`
+type textFormatter struct{}
+
+func (f *textFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	var b bytes.Buffer
+
+	b.WriteString(entry.Time.Format(time.RFC3339))
+	b.WriteByte(' ')
+	fmt.Fprintf(&b, "%-5s", strings.ToUpper(entry.Level.String()))
+	b.WriteByte(' ')
+	b.WriteString(strings.TrimSuffix(entry.Message, "\n"))
+
+	keys := make([]string, 0, len(entry.Data))
+	for k := range entry.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%v", k, entry.Data[k])
+	}
+	b.WriteByte('\n')
+
+	return b.Bytes(), nil
+}
+
+// discardFormatter the logger itself writes nothing, the sinks do
+type discardFormatter struct{}
+
+func (discardFormatter) Format(*logrus.Entry) ([]byte, error) {
+	return nil, nil
+}
@@ -0,0 +1,128 @@
+package logger
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// facilityLocal0 default syslog facility
+const facilityLocal0 = 16
+
+// SyslogOptions of the syslog sink
+type SyslogOptions struct {
+	// Network udp (default), tcp or unix
+	Network string
+	Address string
+	Tag     string
+	// Facility syslog facility, local0 when zero
+	Facility int
+}
+
+// syslogWriter send the entries as RFC 5424 messages, the connection is opened once and
+// dialed again after a write error
+type syslogWriter struct {
+	opts     SyslogOptions
+	hostname string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newSyslogWriter(opts SyslogOptions) (*syslogWriter, error) {
+	if len(opts.Network) == 0 {
+		opts.Network = "udp"
+	}
+	if len(opts.Address) == 0 {
+		return nil, fmt.Errorf("logger: the syslog address is empty")
+	}
+	if opts.Facility == 0 {
+		opts.Facility = facilityLocal0
+	}
+	if len(opts.Tag) == 0 {
+		opts.Tag = "go-skeleton"
+	}
+
+	hostname, _ := os.Hostname()
+	w := &syslogWriter{opts: opts, hostname: hostname}
+	if err := w.dial(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *syslogWriter) dial() error {
+	conn, err := net.DialTimeout(w.opts.Network, w.opts.Address, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+
+	return nil
+}
+
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	return len(p), w.WriteLevel(logrus.InfoLevel, p)
+}
+
+func (w *syslogWriter) WriteLevel(level logrus.Level, p []byte) error {
+	// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d - - %s",
+		w.opts.Facility*8+syslogSeverity(level), time.Now().Format(time.RFC3339Nano),
+		w.hostname, w.opts.Tag, os.Getpid(), p)
+	if w.opts.Network != "udp" && (len(msg) == 0 || msg[len(msg)-1] != '\n') {
+		msg += "\n"
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn != nil {
+		if _, err := w.conn.Write([]byte(msg)); err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+
+	if err := w.dial(); err != nil {
+		return err
+	}
+	_, err := w.conn.Write([]byte(msg))
+
+	return err
+}
+
+func (w *syslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+
+	return err
+}
+
+// syslogSeverity the RFC 5424 severity of the level
+func syslogSeverity(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return 2 // critical
+	case logrus.ErrorLevel:
+		return 3
+	case logrus.WarnLevel:
+		return 4
+	case logrus.InfoLevel:
+		return 6
+	}
+
+	return 7 // debug
+}
@@ -0,0 +1,64 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultFileDir directory of the file driver when mail.file.path is empty
+const defaultFileDir = "storages/mails"
+
+// FileMailer write every mail in its own .eml file instead of sending it, the files open in
+// any mail client
+type FileMailer struct {
+	dir string
+}
+
+func NewFileMailer(dir string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &FileMailer{dir: dir}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg *Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	email, err := msg.email()
+	if err != nil {
+		return err
+	}
+
+	// sortable by date, the random part avoids overwriting the mails of the same millisecond
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	name := time.Now().UTC().Format("20060102T150405.000") + "-"
+	if len(msg.Template) > 0 {
+		name += msg.Template + "-"
+	}
+	name += hex.EncodeToString(b) + ".eml"
+
+	// write then rename so a reader never sees a partial file
+	path := filepath.Join(m.dir, name)
+	if err = os.WriteFile(path+".tmp", []byte(email.GetMessage()), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// Dir directory of the .eml files
+func (m *FileMailer) Dir() string {
+	return m.dir
+}
+
+func (m *FileMailer) Close() error {
+	return nil
+}
@@ -1,27 +1,57 @@
 package mail
 
 import (
+	"context"
 	"fmt"
 	"go-skeleton/bootstrap"
-	"go-skeleton/lib/utils"
-	"log"
-
-	mail "github.com/xhit/go-simple-mail/v2"
+	"go-skeleton/lib/logger"
+	"go-skeleton/lib/tracing"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Html filename
+// Templates of resources/templates
 const (
 	UserVerifyEmail    = "user_verify_registration"
 	UserForgotPassword = "user_forgot_password"
 	UserUpdateEmail    = "user_update_email"
 )
 
-var MailSubj = map[string]string{
-	UserUpdateEmail:    "[Detect Data] Email Verification",
-	UserVerifyEmail:    "[Detect Data] Email Verification",
-	UserForgotPassword: "[Detect Data] Forgot Password",
+// tokenTemplates the mails with a link of a verification token, the token expires soon
+// after the mail is queued so they can't be resent
+var tokenTemplates = map[string]bool{
+	UserVerifyEmail:    true,
+	UserForgotPassword: true,
+	UserUpdateEmail:    true,
+}
+
+// HasToken check the mail of the template carries a verification token
+func HasToken(template string) bool {
+	return tokenTemplates[template]
 }
 
+var (
+	templatesOnce sync.Once
+	templates     *Templates
+
+	mailSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mail_sent_total",
+		Help: "Number of emails sent by template.",
+	}, []string{"template"})
+	mailFail = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mail_failed_total",
+		Help: "Number of emails that failed to send by template.",
+	}, []string{"template"})
+)
+
 type EmailData struct {
 	Name        string
 	Email       string
@@ -31,56 +61,151 @@ type EmailData struct {
 }
 
 type Contract struct {
-	app *bootstrap.App
+	app    *bootstrap.App
+	mailer Mailer
 }
 
+// New the contract with the default mailer, it's created from the config mail.drive when
+// SetDefault wasn't called
 func New(app *bootstrap.App) *Contract {
-	return &Contract{app}
+	return &Contract{app: app}
 }
 
-func (c *Contract) SendMail(usedFor, subject, to string, emailData interface{}) error {
-	fn := fmt.Sprintf("%s/%s.html", c.app.Config.GetString("resource_path"), usedFor)
+// NewWithMailer the contract with its own mailer, e.g. a MemoryMailer in the tests
+func NewWithMailer(app *bootstrap.App, m Mailer) *Contract {
+	return &Contract{app: app, mailer: m}
+}
 
-	server := mail.NewSMTPClient()
+// Mailer the mailer used by the contract
+func (c *Contract) Mailer() (Mailer, error) {
+	if c.mailer != nil {
+		return c.mailer, nil
+	}
+	if m := Default(); m != nil {
+		return m, nil
+	}
 
-	// SMTP Server
-	server.Host = c.app.Config.GetString("mail.host")
-	server.Port = c.app.Config.GetInt("mail.port")
-	server.Username = c.app.Config.GetString("mail.username")
-	server.Password = c.app.Config.GetString("mail.password")
-	server.Encryption = mail.EncryptionSTARTTLS
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultMailer == nil {
+		m, err := NewMailer(c.app.Config)
+		if err != nil {
+			return nil, err
+		}
+		defaultMailer = m
+	}
+
+	return defaultMailer, nil
+}
 
-	// SMTP client
-	smtpClient, err := server.Connect()
+// Templates the mail templates, overridden by the files of mail.template_path
+func (c *Contract) Templates() *Templates {
+	templatesOnce.Do(func() {
+		templates = NewTemplates(c.app.Config.GetString("mail.template_path"))
+	})
+
+	return templates
+}
+
+// Locale the locale of the mails of a user with this preferred locale, app.locale then the
+// first of Locales when the user has none
+func (c *Contract) Locale(preferred string) string {
+	if locale := ParseLocale(preferred); len(locale) > 0 {
+		return locale
+	}
+	if locale := ParseLocale(c.app.Config.GetString("app.locale")); len(locale) > 0 {
+		return locale
+	}
+
+	return Locales[0]
+}
+
+// SendMail send the template in the locale to the address with the mailer, the deadline of
+// ctx bounds the send, a cancelled ctx stops before the mail is sent
+func (c *Contract) SendMail(ctx context.Context, usedFor, locale, to string, emailData interface{}) error {
+	ctx, span := tracing.Start(ctx, "mail send", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("mail.template", usedFor)))
+	defer span.End()
+
+	err := c.sendMail(ctx, span, usedFor, locale, to, emailData)
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		mailFail.WithLabelValues(usedFor).Inc()
 		return err
 	}
 
-	// fill the html body
-	tpl, err := utils.ParseTpl(fn, emailData)
+	mailSent.WithLabelValues(usedFor).Inc()
+	return nil
+}
+
+// render the template in the locale, the first of Locales when the locale has no such template
+func (c *Contract) render(usedFor, locale string, emailData interface{}) (Rendered, error) {
+	tpl := c.Templates()
+	if !tpl.Has(usedFor, locale) {
+		locale = Locales[0]
+	}
+
+	return tpl.Render(usedFor, locale, emailData)
+}
+
+// message the mail with the template filled with emailData
+func (c *Contract) message(usedFor, locale, to string, emailData interface{}) (*Message, error) {
+	rendered, err := c.render(usedFor, locale, emailData)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// New email simple html with inline and CC
-	from := fmt.Sprintf("%s <%s>", c.app.Config.GetString("mail.mail_name"), c.app.Config.GetString("mail.mail_from"))
-	email := mail.NewMSG()
-	email.SetFrom(from).
-		AddTo(to).
-		SetSubject(subject)
+	return &Message{
+		From:     fmt.Sprintf("%s <%s>", c.app.Config.GetString("mail.mail_name"), c.app.Config.GetString("mail.mail_from")),
+		To:       []string{to},
+		Subject:  rendered.Subject,
+		HTML:     rendered.HTML,
+		Text:     rendered.Text,
+		Template: usedFor,
+		Date:     time.Now(),
+	}, nil
+}
+
+func (c *Contract) sendMail(ctx context.Context, span trace.Span, usedFor, locale, to string, emailData interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	email.SetBody(mail.TextHTML, tpl)
-	if email.Error != nil {
+	mailer, err := c.Mailer()
+	if err != nil {
 		return err
 	}
+	span.SetAttributes(attribute.String("mail.driver", driverName(mailer)))
+	if smtp, ok := mailer.(*SMTPMailer); ok {
+		span.SetAttributes(semconv.NetPeerNameKey.String(smtp.opts.Host))
+	}
 
-	// Call Send and pass the client
-	err = email.Send(smtpClient)
+	msg, err := c.message(usedFor, locale, to, emailData)
 	if err != nil {
 		return err
-	} else {
-		log.Println("Email Sent")
 	}
 
+	if err = mailer.Send(ctx, msg); err != nil {
+		return err
+	}
+	logger.FromContext(ctx).WithFields(logrus.Fields{
+		"template": usedFor,
+		"driver":   driverName(mailer),
+	}).Info("email sent")
+
 	return nil
 }
+
+func driverName(m Mailer) string {
+	switch m.(type) {
+	case *SMTPMailer:
+		return DriverSMTP
+	case *FileMailer:
+		return DriverFile
+	case *MemoryMailer:
+		return DriverMemory
+	}
+
+	return fmt.Sprintf("%T", m)
+}
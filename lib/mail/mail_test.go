@@ -0,0 +1,130 @@
+package mail
+
+import (
+	"context"
+	"go-skeleton/bootstrap"
+	"go-skeleton/lib/utils"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testApp the app with the config of the json, e.g. {"mail": {"drive": "memory"}}
+func testApp(t *testing.T, config string) *bootstrap.App {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return &bootstrap.App{Config: utils.NewViperConfig(filepath.Dir(path), path)}
+}
+
+func TestSendMailMemory(t *testing.T) {
+	app := testApp(t, `{"mail": {"mail_name": "Skeleton", "mail_from": "no-reply@example.com"}}`)
+	mailer := NewMemoryMailer()
+	c := NewWithMailer(app, mailer)
+
+	link := "https://example.com/reset-password?token=abc123"
+	err := c.SendMail(context.Background(), UserForgotPassword, "en", "user@example.com", EmailData{Name: "Jane", Link: link})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent := mailer.SentTo("USER@example.com")
+	if len(sent) != 1 {
+		t.Fatalf("got %d mails to the user, want 1", len(sent))
+	}
+	msg := sent[0]
+	if msg.From != "Skeleton <no-reply@example.com>" {
+		t.Errorf("from %q", msg.From)
+	}
+	if msg.Subject != "[Detect Data] Forgot Password" {
+		t.Errorf("subject %q", msg.Subject)
+	}
+	if msg.Template != UserForgotPassword {
+		t.Errorf("template %q", msg.Template)
+	}
+	for name, body := range map[string]string{"html": msg.HTML, "text": msg.Text} {
+		if !strings.Contains(body, "Hi Jane") || !strings.Contains(body, link) {
+			t.Errorf("%s part without the name or the link:\n%s", name, body)
+		}
+	}
+
+	// a failing mailer is returned to the caller, nothing is recorded
+	mailer.Reset()
+	mailer.FailWith(os.ErrDeadlineExceeded)
+	if err = c.SendMail(context.Background(), UserVerifyEmail, "id", "user@example.com", EmailData{}); err != os.ErrDeadlineExceeded {
+		t.Errorf("error %v, want the error of the mailer", err)
+	}
+	if mailer.Count() != 0 {
+		t.Errorf("%d mails recorded by a failing mailer", mailer.Count())
+	}
+
+	// a cancelled context stops before the send
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	mailer.Reset()
+	if err = c.SendMail(ctx, UserVerifyEmail, "en", "user@example.com", EmailData{}); err == nil {
+		t.Error("mail sent with a cancelled context")
+	}
+}
+
+func TestNewMailerDriver(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mails")
+
+	tests := []struct {
+		config  string
+		want    string
+		wantErr bool
+	}{
+		{config: `{"mail": {"drive": "memory"}}`, want: DriverMemory},
+		{config: `{"mail": {"drive": "FILE", "file": {"path": "` + filepath.ToSlash(dir) + `"}}}`, want: DriverFile},
+		{config: `{"mail": {"drive": "smtp", "host": "localhost", "port": 25}}`, want: DriverSMTP},
+		{config: `{"mail": {"drive": "pigeon"}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		m, err := NewMailer(testApp(t, tt.config).Config)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: no error for an unknown driver", tt.config)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.config, err)
+		}
+		if got := driverName(m); got != tt.want {
+			t.Errorf("%s: driver %s, want %s", tt.config, got, tt.want)
+		}
+		m.Close()
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewFileMailer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewWithMailer(testApp(t, `{"mail": {"mail_from": "no-reply@example.com"}}`), m)
+
+	err = c.SendMail(context.Background(), UserVerifyEmail, "en", "user@example.com", EmailData{Name: "Jane", Link: "https://example.com/verify"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+UserVerifyEmail+"-*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("got %v files (%v), want one .eml", files, err)
+	}
+	content, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "user@example.com") {
+		t.Errorf("the .eml has no recipient:\n%s", content)
+	}
+}
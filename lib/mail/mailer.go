@@ -0,0 +1,100 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"go-skeleton/lib/utils"
+	"strings"
+	"sync"
+	"time"
+
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// Drivers of mail.drive
+const (
+	DriverSMTP   = "smtp"
+	DriverFile   = "file"
+	DriverMemory = "memory"
+)
+
+// Message a mail ready to be sent, the bodies are the rendered template
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	HTML    string
+	// Text plain text alternative of the html
+	Text string
+	// Template name of the html template, kept by the drivers that record the mails
+	Template string
+	Date     time.Time
+}
+
+// Mailer deliver the messages, the drivers are safe for concurrent use
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+	// Close release the connections of the driver
+	Close() error
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultMailer Mailer
+)
+
+// NewMailer the driver of mail.drive: smtp (default), file or memory
+func NewMailer(config utils.Config) (Mailer, error) {
+	switch drive := strings.ToLower(config.GetString("mail.drive")); drive {
+	case "", DriverSMTP:
+		return NewSMTPMailer(SMTPOptionsFromConfig(config))
+	case DriverFile:
+		dir := config.GetString("mail.file.path")
+		if len(dir) == 0 {
+			dir = defaultFileDir
+		}
+		return NewFileMailer(dir)
+	case DriverMemory:
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("mail: unknown driver %q (smtp|file|memory)", drive)
+	}
+}
+
+// SetDefault the mailer of the contracts created with New
+func SetDefault(m Mailer) {
+	defaultMu.Lock()
+	defaultMailer = m
+	defaultMu.Unlock()
+}
+
+// Default the mailer set with SetDefault, nil when it's not set
+func Default() Mailer {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+
+	return defaultMailer
+}
+
+// email the go-simple-mail email of the message, used for the SMTP send and the .eml files
+func (msg *Message) email() (*mail.Email, error) {
+	email := mail.NewMSG()
+	email.SetFrom(msg.From).
+		AddTo(msg.To...).
+		SetSubject(msg.Subject)
+	if !msg.Date.IsZero() {
+		email.SetDate(msg.Date.UTC().Format("2006-01-02 15:04:05 MST"))
+	}
+
+	if len(msg.Text) > 0 {
+		email.SetBody(mail.TextPlain, msg.Text)
+		email.AddAlternative(mail.TextHTML, msg.HTML)
+	} else {
+		email.SetBody(mail.TextHTML, msg.HTML)
+	}
+	if email.Error != nil {
+		return nil, email.Error
+	}
+
+	return email, nil
+}
@@ -0,0 +1,117 @@
+package mail
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// MemoryMailer keep the mails in memory, for the tests and the local development. The
+// helpers return copies so they can be used while mails are sent.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+	// err returned by Send instead of keeping the mail, see FailWith
+	err error
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, msg *Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return m.err
+	}
+
+	cp := *msg
+	cp.To = append([]string(nil), msg.To...)
+	m.messages = append(m.messages, cp)
+
+	return nil
+}
+
+// Messages the mails sent, oldest first
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message(nil), m.messages...)
+}
+
+// Last the last mail sent, false when there is none
+func (m *MemoryMailer) Last() (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.messages) == 0 {
+		return Message{}, false
+	}
+
+	return m.messages[len(m.messages)-1], true
+}
+
+// SentTo the mails sent to the address, the case is ignored
+func (m *MemoryMailer) SentTo(address string) []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []Message
+	for _, msg := range m.messages {
+		for _, to := range msg.To {
+			if strings.EqualFold(extractAddress(to), address) {
+				res = append(res, msg)
+				break
+			}
+		}
+	}
+
+	return res
+}
+
+// Count number of mails sent
+func (m *MemoryMailer) Count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.messages)
+}
+
+// Reset forget the mails sent and the error of FailWith
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = nil
+	m.err = nil
+}
+
+// FailWith make Send return err, nil sends again
+func (m *MemoryMailer) FailWith(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.err = err
+}
+
+func (m *MemoryMailer) Close() error {
+	return nil
+}
+
+// extractAddress the address of "Name <address>"
+func extractAddress(s string) string {
+	if i := strings.LastIndex(s, "<"); i >= 0 {
+		if j := strings.LastIndex(s, ">"); j > i {
+			return s[i+1 : j]
+		}
+	}
+
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,327 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go-skeleton/bootstrap"
+	"log"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Status of the mails of mail_queue
+const (
+	StatusPending = "pending"
+	StatusSending = "sending"
+	StatusSent    = "sent"
+	StatusFailed  = "failed"
+)
+
+// Status of the rows of mail_deliveries, resend is written when an admin queues the mail again
+const (
+	DeliverySent   = "sent"
+	DeliveryFailed = "failed"
+	DeliveryResend = "resend"
+)
+
+const defaultMaxAttempts = 5
+
+// Execer pgxpool.Pool or pgx.Tx, with a transaction the mail is queued only if it's committed
+type Execer interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+}
+
+// Enqueue store the mail in mail_queue, it's rendered in the locale and sent by the Sender
+// with retries, config mail.queue.max_attempts
+func (c *Contract) Enqueue(ctx context.Context, db Execer, usedFor, locale, to string, emailData EmailData) error {
+	data, err := json.Marshal(emailData)
+	if err != nil {
+		return err
+	}
+
+	// the subject is kept for the admin list, a template error is returned now
+	rendered, err := c.render(usedFor, locale, emailData)
+	if err != nil {
+		return err
+	}
+
+	maxAttempts := c.app.Config.GetInt("mail.queue.max_attempts")
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+
+	now := time.Now().UTC()
+	sql := `INSERT INTO mail_queue (mail_identifier, template, locale, recipient, subject, data, max_attempts, next_attempt_date, created_date)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $8)`
+	_, err = db.Exec(ctx, sql, newMailID(), usedFor, locale, to, rendered.Subject, data, maxAttempts, now)
+
+	return err
+}
+
+// newMailID random 32 hex chars
+func newMailID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// SenderOptions of the sender, the zero values use the defaults
+type SenderOptions struct {
+	// Interval between two polls when the queue is empty (default 5s)
+	Interval time.Duration
+	// BatchSize mails claimed per poll (default 20)
+	BatchSize int
+	// SendTimeout deadline of the SMTP send of one mail (default 30s)
+	SendTimeout time.Duration
+	// StaleAfter a mail still sending after this (the instance stopped) is claimed again (default 10m)
+	StaleAfter time.Duration
+	// MaxBackoff cap of the delay before a failed mail is retried (default 1h)
+	MaxBackoff time.Duration
+}
+
+// Sender send the mails of mail_queue with the mailer of the contract. The mails are claimed
+// with SKIP LOCKED so several instances can run it, every attempt is written in mail_deliveries.
+type Sender struct {
+	mail *Contract
+	db   *pgxpool.Pool
+	opts SenderOptions
+}
+
+// NewSender the sender with the options of the config mail.queue.interval (ms) and
+// mail.queue.batch_size
+func NewSender(app *bootstrap.App) *Sender {
+	return NewSenderWithOptions(app, SenderOptions{
+		Interval:  time.Duration(app.Config.GetInt("mail.queue.interval")) * time.Millisecond,
+		BatchSize: app.Config.GetInt("mail.queue.batch_size"),
+	})
+}
+
+func NewSenderWithOptions(app *bootstrap.App, opts SenderOptions) *Sender {
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 20
+	}
+	if opts.SendTimeout <= 0 {
+		opts.SendTimeout = 30 * time.Second
+	}
+	if opts.StaleAfter <= 0 {
+		opts.StaleAfter = 10 * time.Minute
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Hour
+	}
+
+	return &Sender{mail: New(app), db: app.DB, opts: opts}
+}
+
+// Run send the queued mails until ctx is done, a full batch is followed by the next one at once
+func (s *Sender) Run(ctx context.Context) {
+	for {
+		n, err := s.sendBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("[mail] sender: %v", err)
+		}
+
+		wait := s.opts.Interval
+		if err == nil && n == s.opts.BatchSize {
+			wait = 0
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+type queuedMail struct {
+	id          int64
+	identifier  string
+	template    string
+	locale      string
+	recipient   string
+	data        []byte
+	attempts    int
+	maxAttempts int
+}
+
+// claim mark a batch as sending and count the attempt, the rows are committed before the
+// send so a slow SMTP server doesn't hold the lock
+func (s *Sender) claim(ctx context.Context) ([]queuedMail, error) {
+	now := time.Now().UTC()
+	sql := `UPDATE mail_queue SET status = $1, attempts = attempts + 1, updated_date = $2
+		WHERE id IN (
+			SELECT id FROM mail_queue
+			WHERE (status = $3 AND next_attempt_date <= $2) OR (status = $1 AND updated_date < $4)
+			ORDER BY id
+			LIMIT $5
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, mail_identifier, template, locale, recipient, data, attempts, max_attempts`
+	rows, err := s.db.Query(ctx, sql, StatusSending, now, StatusPending, now.Add(-s.opts.StaleAfter), s.opts.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mails []queuedMail
+	for rows.Next() {
+		var m queuedMail
+		if err = rows.Scan(&m.id, &m.identifier, &m.template, &m.locale, &m.recipient,
+			&m.data, &m.attempts, &m.maxAttempts); err != nil {
+			return nil, err
+		}
+		mails = append(mails, m)
+	}
+
+	return mails, rows.Err()
+}
+
+func (s *Sender) sendBatch(ctx context.Context) (int, error) {
+	mails, err := s.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, m := range mails {
+		if ctx.Err() != nil {
+			// give the rest back without counting the attempt
+			for _, rest := range mails[i:] {
+				s.release(rest)
+			}
+			break
+		}
+
+		// the instance sending it stopped after the last attempt
+		if m.attempts > m.maxAttempts {
+			if err = s.failed(m, m.attempts-1, fmt.Errorf("interrupted while sending")); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		sendErr := s.send(ctx, m)
+		if sendErr == nil {
+			err = s.sent(m)
+		} else {
+			log.Printf("[mail] send %s %s attempt %d failed: %v", m.template, m.identifier, m.attempts, sendErr)
+			err = s.failed(m, m.attempts, sendErr)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(mails), nil
+}
+
+func (s *Sender) send(ctx context.Context, m queuedMail) error {
+	var data EmailData
+	if err := json.Unmarshal(m.data, &data); err != nil {
+		return fmt.Errorf("decode data: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.opts.SendTimeout)
+	defer cancel()
+
+	return s.mail.SendMail(ctx, m.template, m.locale, m.recipient, data)
+}
+
+func (s *Sender) sent(m queuedMail) error {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// the data isn't kept once the mail is sent, it can hold a live verification link
+	_, err = tx.Exec(ctx, `UPDATE mail_queue SET status = $1, data = '{}', last_error = NULL, sent_date = $2, updated_date = $2 WHERE id = $3`,
+		StatusSent, now, m.id)
+	if err != nil {
+		return err
+	}
+	if err = insertDelivery(ctx, tx, m.id, m.attempts, DeliverySent, ""); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// failed schedule the next attempt with an exponential backoff, the mail is failed once
+// max_attempts is reached
+func (s *Sender) failed(m queuedMail, attempt int, sendErr error) error {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	status := StatusPending
+	if attempt >= m.maxAttempts {
+		status = StatusFailed
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// a failed mail with a token can't be resent, its data isn't kept either
+	sql := `UPDATE mail_queue SET status = $1, attempts = $2, last_error = $3, next_attempt_date = $4, updated_date = $5 WHERE id = $6`
+	if status == StatusFailed && HasToken(m.template) {
+		sql = `UPDATE mail_queue SET status = $1, data = '{}', attempts = $2, last_error = $3, next_attempt_date = $4, updated_date = $5 WHERE id = $6`
+	}
+	_, err = tx.Exec(ctx, sql, status, attempt, sendErr.Error(), now.Add(s.backoff(attempt)), now, m.id)
+	if err != nil {
+		return err
+	}
+	if err = insertDelivery(ctx, tx, m.id, attempt, DeliveryFailed, sendErr.Error()); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// release put a claimed mail back in the queue and cancel its attempt
+func (s *Sender) release(m queuedMail) {
+	_, err := s.db.Exec(context.Background(), `UPDATE mail_queue SET status = $1, attempts = attempts - 1, updated_date = $2 WHERE id = $3 AND status = $4`,
+		StatusPending, time.Now().UTC(), m.id, StatusSending)
+	if err != nil {
+		log.Printf("[mail] release %s: %v", m.identifier, err)
+	}
+}
+
+// backoff exponential delay from 30s, capped by MaxBackoff
+func (s *Sender) backoff(attempts int) time.Duration {
+	delay := 30 * time.Second
+	for i := 1; i < attempts && delay < s.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > s.opts.MaxBackoff {
+		delay = s.opts.MaxBackoff
+	}
+
+	return delay
+}
+
+// insertDelivery write an attempt in the history of the mail
+func insertDelivery(ctx context.Context, db Execer, mailID int64, attempt int, status, errMsg string) error {
+	var deliveryErr interface{}
+	if len(errMsg) > 0 {
+		deliveryErr = errMsg
+	}
+
+	_, err := db.Exec(ctx, `INSERT INTO mail_deliveries (mail_id, attempt, status, error, created_date) VALUES($1, $2, $3, $4, $5)`,
+		mailID, attempt, status, deliveryErr, time.Now().UTC())
+
+	return err
+}
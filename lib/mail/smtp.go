@@ -0,0 +1,205 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"go-skeleton/lib/utils"
+	"strings"
+	"sync"
+	"time"
+
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+const (
+	// smtpNoopAfter the kept connection is checked with NOOP when it wasn't used for this long
+	smtpNoopAfter = 30 * time.Second
+	// smtpIdleTimeout the kept connection is replaced when it wasn't used for this long, the
+	// servers close the idle connections
+	smtpIdleTimeout = 2 * time.Minute
+	// smtpDefaultTimeout connect and send timeout when ctx has no deadline
+	smtpDefaultTimeout = 30 * time.Second
+)
+
+// SMTPOptions of the SMTP driver
+type SMTPOptions struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// Encryption none, ssl (implicit TLS, port 465) or starttls (default)
+	Encryption string
+	// Auth plain (default), login, cram-md5 or none, it's none without username
+	Auth string
+}
+
+// SMTPOptionsFromConfig the options of mail.host, mail.port, mail.username, mail.password,
+// mail.encryption (or the former mail.ecryption) and mail.auth
+func SMTPOptionsFromConfig(config utils.Config) SMTPOptions {
+	encryption := config.GetString("mail.encryption")
+	if len(encryption) == 0 {
+		encryption = config.GetString("mail.ecryption")
+	}
+
+	return SMTPOptions{
+		Host:       config.GetString("mail.host"),
+		Port:       config.GetInt("mail.port"),
+		Username:   config.GetString("mail.username"),
+		Password:   config.GetString("mail.password"),
+		Encryption: encryption,
+		Auth:       config.GetString("mail.auth"),
+	}
+}
+
+// SMTPMailer send the mails with go-simple-mail. One connection is kept and shared by the
+// mails, it's checked after a pause and opened again after an error.
+type SMTPMailer struct {
+	opts       SMTPOptions
+	encryption mail.Encryption
+	auth       mail.AuthType
+
+	mu      sync.Mutex
+	client  *mail.SMTPClient
+	lastUse time.Time
+}
+
+func NewSMTPMailer(opts SMTPOptions) (*SMTPMailer, error) {
+	encryption, err := parseEncryption(opts.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := parseAuth(opts.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SMTPMailer{opts: opts, encryption: encryption, auth: auth}, nil
+}
+
+// parseEncryption none, ssl/ssltls or tls/starttls, the empty value is starttls
+func parseEncryption(s string) (mail.Encryption, error) {
+	switch strings.ToLower(s) {
+	case "", "tls", "starttls":
+		return mail.EncryptionSTARTTLS, nil
+	case "ssl", "ssltls", "ssl/tls":
+		return mail.EncryptionSSLTLS, nil
+	case "none":
+		return mail.EncryptionNone, nil
+	}
+
+	return mail.EncryptionNone, fmt.Errorf("mail: unknown encryption %q (none|ssl|starttls)", s)
+}
+
+func parseAuth(s string) (mail.AuthType, error) {
+	switch strings.ToLower(s) {
+	case "", "plain":
+		return mail.AuthPlain, nil
+	case "login":
+		return mail.AuthLogin, nil
+	case "cram-md5", "crammd5":
+		return mail.AuthCRAMMD5, nil
+	case "none":
+		return mail.AuthNone, nil
+	}
+
+	return mail.AuthNone, fmt.Errorf("mail: unknown auth %q (plain|login|cram-md5|none)", s)
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	email, err := msg.email()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	client, err := m.smtpClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	client.SendTimeout = timeout(ctx)
+	err = email.Send(client)
+	if err != nil {
+		// the state of the connection is unknown, open a new one for the next mail
+		m.closeClient()
+		return err
+	}
+	m.lastUse = time.Now()
+
+	return nil
+}
+
+// smtpClient the kept connection or a new one, call it with mu held
+func (m *SMTPMailer) smtpClient(ctx context.Context) (*mail.SMTPClient, error) {
+	if m.client != nil {
+		idle := time.Since(m.lastUse)
+		if idle > smtpIdleTimeout {
+			m.closeClient()
+		} else if idle > smtpNoopAfter {
+			if err := m.client.Noop(); err != nil {
+				m.closeClient()
+			}
+		}
+	}
+	if m.client != nil {
+		return m.client, nil
+	}
+
+	client, err := m.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.client = client
+	m.lastUse = time.Now()
+
+	return client, nil
+}
+
+// connect open a connection, the deadline of ctx bounds the connect
+func (m *SMTPMailer) connect(ctx context.Context) (*mail.SMTPClient, error) {
+	server := mail.NewSMTPClient()
+	server.Host = m.opts.Host
+	server.Port = m.opts.Port
+	server.Username = m.opts.Username
+	server.Password = m.opts.Password
+	server.Encryption = m.encryption
+	server.Authentication = m.auth
+	server.KeepAlive = true
+
+	server.ConnectTimeout = timeout(ctx)
+
+	return server.Connect()
+}
+
+// timeout the time left before the deadline of ctx
+func timeout(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline)
+	}
+
+	return smtpDefaultTimeout
+}
+
+func (m *SMTPMailer) closeClient() {
+	if m.client == nil {
+		return
+	}
+	_ = m.client.Quit()
+	_ = m.client.Close()
+	m.client = nil
+}
+
+// Close quit the kept connection
+func (m *SMTPMailer) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closeClient()
+	return nil
+}
@@ -0,0 +1,180 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+
+	"go-skeleton/resources"
+)
+
+// Locales of the templates, the first one is used when neither the user nor app.locale has one
+var Locales = []string{"en", "id"}
+
+// Rendered the parts of a mail rendered from its template
+type Rendered struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Templates render the mails of resources/templates. A message is <locale>/<name>.tmpl, it
+// defines "subject", "preheader", "html" and "text"; the html is put in layout.html and the
+// text in layout.txt, <locale>/common.tmpl defines the parts shared by the messages of the
+// locale. The files of the override directory are used instead of the embedded ones.
+type Templates struct {
+	embedded fs.FS
+	override string
+
+	// parsed templates, only the embedded ones are kept, the override files are read at
+	// every render so they can be edited without a restart
+	cache sync.Map
+}
+
+type parsedTemplate struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// NewTemplates the embedded templates, overridden by the files of dir when it's not empty
+func NewTemplates(dir string) *Templates {
+	embedded, err := fs.Sub(resources.Templates, "templates")
+	if err != nil {
+		panic(err)
+	}
+
+	return &Templates{embedded: embedded, override: dir}
+}
+
+// Render the subject, html and text of the template in the locale
+func (t *Templates) Render(name, locale string, data interface{}) (Rendered, error) {
+	var res Rendered
+
+	tpl, err := t.parsed(name, locale)
+	if err != nil {
+		return res, err
+	}
+
+	var buf bytes.Buffer
+	if err = tpl.text.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return res, err
+	}
+	// a subject is a single line
+	res.Subject = strings.Join(strings.Fields(buf.String()), " ")
+
+	buf.Reset()
+	if err = tpl.html.ExecuteTemplate(&buf, "layout.html", data); err != nil {
+		return res, err
+	}
+	res.HTML = buf.String()
+
+	buf.Reset()
+	if err = tpl.text.ExecuteTemplate(&buf, "layout.txt", data); err != nil {
+		return res, err
+	}
+	res.Text = buf.String()
+
+	return res, nil
+}
+
+func (t *Templates) parsed(name, locale string) (*parsedTemplate, error) {
+	key := locale + "/" + name
+	if len(t.override) == 0 {
+		if tpl, ok := t.cache.Load(key); ok {
+			return tpl.(*parsedTemplate), nil
+		}
+	}
+
+	files := []string{"layout.html", "layout.txt", path.Join(locale, "common.tmpl"), path.Join(locale, name+".tmpl")}
+	funcs := map[string]interface{}{
+		"locale": func() string { return locale },
+	}
+
+	tpl := &parsedTemplate{
+		html: htmltemplate.New(name).Funcs(funcs),
+		text: texttemplate.New(name).Funcs(funcs),
+	}
+	for _, file := range files {
+		content, err := t.readFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("mail template %s: %w", key, err)
+		}
+
+		// the text templates don't need the html layout and the html ones the text layout
+		if file != "layout.txt" {
+			if _, err = tpl.html.New(file).Parse(string(content)); err != nil {
+				return nil, err
+			}
+		}
+		if file != "layout.html" {
+			if _, err = tpl.text.New(file).Parse(string(content)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(t.override) == 0 {
+		t.cache.Store(key, tpl)
+	}
+
+	return tpl, nil
+}
+
+// readFile the file of the override directory, or the embedded one
+func (t *Templates) readFile(name string) ([]byte, error) {
+	if len(t.override) > 0 {
+		content, err := os.ReadFile(filepath.Join(t.override, filepath.FromSlash(name)))
+		if err == nil {
+			return content, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	return fs.ReadFile(t.embedded, name)
+}
+
+// Has the template exists in the locale
+func (t *Templates) Has(name, locale string) bool {
+	file := path.Join(locale, name+".tmpl")
+	if len(t.override) > 0 {
+		if _, err := os.Stat(filepath.Join(t.override, filepath.FromSlash(file))); err == nil {
+			return true
+		}
+	}
+	_, err := fs.Stat(t.embedded, file)
+
+	return err == nil
+}
+
+// ParseLocale the first supported locale of a language tag or an Accept-Language header,
+// e.g. "id-ID,id;q=0.9,en;q=0.8" is id, empty when none is supported
+func ParseLocale(s string) string {
+	parts := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '|' })
+	for _, part := range parts {
+		tag := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if i := strings.IndexAny(tag, "-_"); i >= 0 {
+			tag = tag[:i]
+		}
+		tag = strings.ToLower(tag)
+		if tag == "idn" || tag == "ind" {
+			tag = "id"
+		}
+		for _, locale := range Locales {
+			if tag == locale {
+				return locale
+			}
+		}
+	}
+
+	return ""
+}
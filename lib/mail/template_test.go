@@ -0,0 +1,125 @@
+package mail
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseLocale(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "id-ID,id;q=0.9,en;q=0.8", want: "id"},
+		{in: "id-ID,id;q=0.9", want: "id"},
+		{in: "en-US,en;q=0.9", want: "en"},
+		{in: "EN_gb", want: "en"},
+		{in: "ind", want: "id"},
+		{in: "idn", want: "id"},
+		{in: "fr-FR,fr;q=0.9,id;q=0.5", want: "id"},
+		{in: "fr-FR,de;q=0.9", want: ""},
+		{in: "*", want: ""},
+		{in: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := ParseLocale(tt.in); got != tt.want {
+			t.Errorf("ParseLocale(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRenderEmbedded(t *testing.T) {
+	tpl := NewTemplates("")
+	data := EmailData{Name: "Jane <script>", Link: "https://example.com/verify?token=a&b"}
+
+	tests := []struct {
+		locale  string
+		subject string
+		text    string
+	}{
+		{locale: "en", subject: "[Detect Data] Email Verification", text: "Hi Jane <script>,"},
+		{locale: "id", subject: "[Detect Data] Verifikasi Email", text: "Halo Jane <script>,"},
+	}
+	for _, tt := range tests {
+		res, err := tpl.Render(UserVerifyEmail, tt.locale, data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.locale, err)
+		}
+		if res.Subject != tt.subject {
+			t.Errorf("%s: subject %q, want %q", tt.locale, res.Subject, tt.subject)
+		}
+		// the text part isn't escaped, the html one is
+		if !strings.Contains(res.Text, tt.text) || !strings.Contains(res.Text, data.Link) {
+			t.Errorf("%s: text part:\n%s", tt.locale, res.Text)
+		}
+		if strings.Contains(res.HTML, "<script>") || !strings.Contains(res.HTML, "Jane &lt;script&gt;") {
+			t.Errorf("%s: the html part doesn't escape the data:\n%s", tt.locale, res.HTML)
+		}
+		if !strings.Contains(res.HTML, `lang="`+tt.locale+`"`) || !strings.Contains(res.HTML, "token=a&amp;b") {
+			t.Errorf("%s: html part:\n%s", tt.locale, res.HTML)
+		}
+	}
+
+	if _, err := tpl.Render("user_unknown", "en", data); err == nil {
+		t.Error("no error for a missing template")
+	}
+}
+
+func TestRenderLocaleFallback(t *testing.T) {
+	c := &Contract{}
+	templatesOnce.Do(func() { templates = NewTemplates("") })
+
+	// a locale without templates renders the first of Locales
+	res, err := c.render(UserForgotPassword, "fr", EmailData{Name: "Jane"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Subject != "[Detect Data] Forgot Password" {
+		t.Errorf("subject %q, want the %s one", res.Subject, Locales[0])
+	}
+}
+
+func TestRenderOverride(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "id"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "id", UserForgotPassword+".tmpl")
+	write := func(subject string) {
+		t.Helper()
+		content := `{{define "subject"}}` + subject + `{{end}}{{define "preheader"}}{{end}}{{define "html"}}<p>{{.Name}}</p>{{end}}{{define "text"}}{{.Name}}{{end}}`
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("Custom")
+	tpl := NewTemplates(dir)
+
+	res, err := tpl.Render(UserForgotPassword, "id", EmailData{Name: "Jane"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Subject != "Custom" {
+		t.Errorf("subject %q, want the override", res.Subject)
+	}
+	// the layout and common parts the directory doesn't have are the embedded ones
+	if !strings.Contains(res.Text, "Jane") || !strings.Contains(res.Text, "--") {
+		t.Errorf("text part:\n%s", res.Text)
+	}
+
+	// the override files are read again, an edit is used without a restart
+	write("Edited")
+	if res, err = tpl.Render(UserForgotPassword, "id", EmailData{}); err != nil || res.Subject != "Edited" {
+		t.Errorf("subject %q (%v) after the edit, want Edited", res.Subject, err)
+	}
+
+	// the other templates and locales are still embedded
+	if res, err = tpl.Render(UserForgotPassword, "en", EmailData{}); err != nil || res.Subject != "[Detect Data] Forgot Password" {
+		t.Errorf("en subject %q (%v), want the embedded one", res.Subject, err)
+	}
+	if !tpl.Has(UserForgotPassword, "id") || tpl.Has(UserForgotPassword, "fr") {
+		t.Error("Has doesn't match the files")
+	}
+}
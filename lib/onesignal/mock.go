@@ -1,20 +1,22 @@
 package onesignal
 
+import "context"
+
 type (
 	configMock struct{}
 )
 
 var (
-	PushNotificationMock func(xPlayer, title, description string) error
+	PushNotificationMock func(ctx context.Context, xPlayer, title, description string) error
 )
 
 func NewConfigMock() OneSignal {
 	return &configMock{}
 }
 
-func (lib *configMock) PushNotification(xPlayer, title, description string) error {
+func (lib *configMock) PushNotification(ctx context.Context, xPlayer, title, description string) error {
 	if PushNotificationMock != nil {
-		return PushNotificationMock(xPlayer, title, description)
+		return PushNotificationMock(ctx, xPlayer, title, description)
 	}
 	return nil
 }
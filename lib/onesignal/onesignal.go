@@ -2,11 +2,16 @@ package onesignal
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"go-skeleton/lib/tracing"
 	"go-skeleton/lib/utils"
 	"io/ioutil"
 	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 type (
@@ -16,7 +21,7 @@ type (
 	}
 
 	OneSignal interface {
-		PushNotification(xPlayer, title, description string) error
+		PushNotification(ctx context.Context, xPlayer, title, description string) error
 	}
 )
 
@@ -24,11 +29,27 @@ const (
 	UrlHost = "https://onesignal.com/api/v1/notifications"
 )
 
+var pushes = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "onesignal_pushes_total",
+	Help: "Number of push notifications sent to OneSignal by status.",
+}, []string{"status"})
+
 func New(conf utils.Config) OneSignal {
 	return &config{conf: conf}
 }
 
-func (lib *config) PushNotification(xPlayer, title, description string) error {
+func (lib *config) PushNotification(ctx context.Context, xPlayer, title, description string) error {
+	err := lib.push(ctx, xPlayer, title, description)
+	if err != nil {
+		pushes.WithLabelValues("failed").Inc()
+		return err
+	}
+
+	pushes.WithLabelValues("success").Inc()
+	return nil
+}
+
+func (lib *config) push(ctx context.Context, xPlayer, title, description string) error {
 	var (
 		err error
 	)
@@ -46,14 +67,14 @@ func (lib *config) PushNotification(xPlayer, title, description string) error {
 	}
 
 	// Populate Http Request
-	requestData, err := http.NewRequest(http.MethodPost, UrlHost, bytes.NewBuffer(payload))
+	requestData, err := http.NewRequestWithContext(ctx, http.MethodPost, UrlHost, bytes.NewBuffer(payload))
 	if err != nil {
 		return err
 	}
 	requestData.Header.Set("Authorization", "Basic "+lib.conf.GetString("onesignal.app_key"))
 	requestData.Header.Set("Content-Type", "application/json; charset=utf-8")
 
-	client := &http.Client{}
+	client := &http.Client{Transport: tracing.NewTransport(nil)}
 
 	// Do Http Request
 	resp, err := client.Do(requestData)
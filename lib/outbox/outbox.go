@@ -0,0 +1,58 @@
+// Package outbox implement the transactional outbox: the domain events are inserted in the
+// outbox_events table by the transaction that changes the state, then a relay publishes
+// them to RabbitMQ. An event is published at least once, the consumers dedup on its id.
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// DefaultExchange topic exchange of the domain events
+const DefaultExchange = "domain.events"
+
+// Event a domain event, Type is the routing key
+type Event struct {
+	Type          string
+	AggregateType string
+	AggregateID   string
+	Data          interface{}
+}
+
+// Envelope the body of the published message
+type Envelope struct {
+	ID            string          `json:"id"`
+	Type          string          `json:"type"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// Add insert the event with the transaction of the state change, it's published only
+// once the transaction is committed
+func Add(ctx context.Context, tx pgx.Tx, event Event) error {
+	payload, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+
+	sql := `INSERT INTO outbox_events (event_identifier, event_type, aggregate_type, aggregate_identifier, payload, created_date)
+		VALUES($1, $2, $3, $4, $5, $6)`
+	_, err = tx.Exec(ctx, sql, newEventID(), event.Type, event.AggregateType,
+		event.AggregateID, payload, time.Now().UTC())
+
+	return err
+}
+
+// newEventID random 32 hex chars, unlike the prefix codes it can't collide under load
+func newEventID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
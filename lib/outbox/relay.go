@@ -0,0 +1,194 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-skeleton/lib/rabbit"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// RelayOptions of the relay, the zero values use the defaults
+type RelayOptions struct {
+	// Interval between two polls when the outbox is empty (default 1s)
+	Interval time.Duration
+	// BatchSize events locked and published per poll (default 100)
+	BatchSize int
+	// MaxBackoff cap of the delay before a failed event is retried (default 5m)
+	MaxBackoff time.Duration
+	// PublishTimeout wait for the publisher confirm of one event (default 10s)
+	PublishTimeout time.Duration
+}
+
+// Relay publish the committed events of the outbox in order of creation. The events are
+// locked with SKIP LOCKED so several instances can run the relay, an event is marked as
+// published only after the broker confirmed it.
+type Relay struct {
+	db        *pgxpool.Pool
+	publisher *rabbit.Publisher
+	opts      RelayOptions
+}
+
+func NewRelay(db *pgxpool.Pool, publisher *rabbit.Publisher, opts RelayOptions) *Relay {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Minute
+	}
+	if opts.PublishTimeout <= 0 {
+		opts.PublishTimeout = 10 * time.Second
+	}
+
+	return &Relay{db: db, publisher: publisher, opts: opts}
+}
+
+// Run poll the outbox until ctx is done, a full batch is followed by the next one at once
+func (r *Relay) Run(ctx context.Context) {
+	for {
+		n, err := r.relayBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("[outbox] relay: %v", err)
+		}
+
+		wait := r.opts.Interval
+		if err == nil && n == r.opts.BatchSize {
+			wait = 0
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+type outboxRow struct {
+	id            int64
+	identifier    string
+	eventType     string
+	aggregateType string
+	aggregateID   string
+	payload       []byte
+	attempts      int
+	createdDate   time.Time
+}
+
+// relayBatch publish a batch in one transaction, the lock is held until the batch is done
+func (r *Relay) relayBatch(ctx context.Context) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	// the batch is published inside the transaction, the statement_timeout of the API queries
+	// is turned off for it only
+	if _, err = tx.Exec(ctx, "SET LOCAL statement_timeout = 0"); err != nil {
+		return 0, err
+	}
+
+	sql := `SELECT id, event_identifier, event_type, aggregate_type, aggregate_identifier, payload, attempts, created_date
+		FROM outbox_events
+		WHERE published_date IS NULL AND available_date <= NOW()
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`
+	rows, err := tx.Query(ctx, sql, r.opts.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var events []outboxRow
+	for rows.Next() {
+		var ev outboxRow
+		if err = rows.Scan(&ev.id, &ev.identifier, &ev.eventType, &ev.aggregateType, &ev.aggregateID,
+			&ev.payload, &ev.attempts, &ev.createdDate); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		events = append(events, ev)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, ev := range events {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if pubErr := r.publish(ctx, ev); pubErr != nil {
+			delay := r.backoff(ev.attempts + 1)
+			_, err = tx.Exec(ctx, `UPDATE outbox_events SET attempts = attempts + 1, last_error = $1, available_date = $2 WHERE id = $3`,
+				pubErr.Error(), time.Now().Add(delay).UTC(), ev.id)
+			if err != nil {
+				return 0, err
+			}
+			// keep the order of the events, the rest of the batch waits for the next poll
+			log.Printf("[outbox] publish %s %s failed, retry in %s: %v", ev.eventType, ev.identifier, delay, pubErr)
+			break
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE outbox_events SET published_date = $1, attempts = attempts + 1, last_error = NULL WHERE id = $2`,
+			time.Now().UTC(), ev.id)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// a failed commit after the publish only causes a duplicate, the delivery is at least once
+	if err = tx.Commit(context.Background()); err != nil {
+		return 0, err
+	}
+
+	return len(events), nil
+}
+
+func (r *Relay) publish(ctx context.Context, ev outboxRow) error {
+	body, err := json.Marshal(Envelope{
+		ID:            ev.identifier,
+		Type:          ev.eventType,
+		AggregateType: ev.aggregateType,
+		AggregateID:   ev.aggregateID,
+		OccurredAt:    ev.createdDate,
+		Data:          ev.payload,
+	})
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.opts.PublishTimeout)
+	defer cancel()
+
+	return r.publisher.Publish(ctx, ev.eventType, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    ev.identifier,
+		Type:         ev.eventType,
+		Timestamp:    ev.createdDate,
+		Body:         body,
+	})
+}
+
+// backoff exponential delay from 1s, capped by MaxBackoff
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := time.Second
+	for i := 1; i < attempts && delay < r.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > r.opts.MaxBackoff {
+		delay = r.opts.MaxBackoff
+	}
+
+	return delay
+}
@@ -1,30 +1,25 @@
 package rabbit
 
 import (
+	"fmt"
 	"go-skeleton/lib/utils"
-	"log"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-func handleError(err error, msg string) {
+// Connect dial the broker and open a channel, the connection is closed when the channel
+// can't be opened
+func Connect(host string) (*amqp.Connection, *amqp.Channel, error) {
+	conn, err := amqp.Dial(host)
 	if err != nil {
-		log.Fatalf("%s: %s", msg, err)
+		return nil, nil, fmt.Errorf("%s: %w", utils.ErrConnectAMQP, err)
 	}
-}
-
-func Connect(host string) (*amqp.Connection, *amqp.Channel, error) {
-	var (
-		err         error
-		conn        *amqp.Connection
-		amqpChannel *amqp.Channel
-	)
 
-	conn, err = amqp.Dial(host)
-	handleError(err, utils.ErrConnectAMQP)
-
-	amqpChannel, err = conn.Channel()
-	handleError(err, utils.ErrCreateChannelAMQP)
+	amqpChannel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("%s: %w", utils.ErrCreateChannelAMQP, err)
+	}
 
-	return conn, amqpChannel, err
+	return conn, amqpChannel, nil
 }
@@ -0,0 +1,335 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// HeaderAttempts number of times the message was processed
+	HeaderAttempts = "x-attempts"
+	// HeaderRoutingKey routing key of the message before it went through the retry queue
+	HeaderRoutingKey = "x-original-routing-key"
+	// HeaderError last error of the handler, set on the messages of the dead letter queue
+	HeaderError = "x-last-error"
+
+	maxReconnectDelay = 30 * time.Second
+	// confirmTimeout wait for the publisher confirm of a retried or dead lettered copy
+	confirmTimeout = 30 * time.Second
+)
+
+// errDeliveriesClosed the deliveries stopped while the channel is open, e.g. the broker
+// cancelled the consumer because the queue was deleted
+var errDeliveriesClosed = errors.New("rabbitmq: deliveries closed")
+
+// HandlerFunc process a delivery, an error retries the message
+type HandlerFunc func(ctx context.Context, d amqp.Delivery) error
+
+// ConsumerOptions of a queue
+type ConsumerOptions struct {
+	Queue string
+	// Exchange topic exchange the queue is bound to
+	Exchange string
+	// BindingKeys routing keys bound to the queue, the keys of the handlers when empty
+	BindingKeys []string
+	// Prefetch number of messages processed at the same time (default 1)
+	Prefetch int
+	// MaxAttempts a message still failing after this is moved to <queue>.dlq (default 5)
+	MaxAttempts int
+	// RetryDelay wait before the first retry, doubled at each attempt (default 10s)
+	RetryDelay time.Duration
+	// HandlerTimeout deadline of the context given to the handler (default 1m)
+	HandlerTimeout time.Duration
+}
+
+// Consumer consume a queue and dispatch the messages to the handler of their routing key.
+// A failed message is delayed in the retry queue of its delay, <queue>.retry.<delay> with
+// the delay as x-message-ttl, then dead lettered back to the queue. Every message of a retry
+// queue has the same TTL, so a long delay never holds back a shorter one. After MaxAttempts it's moved to <queue>.dlq, the copy is acked once the broker confirmed
+// it. The connection is opened again with a backoff when the connection or the channel is
+// closed, or when the deliveries stop.
+type Consumer struct {
+	host     string
+	opts     ConsumerOptions
+	handlers map[string]HandlerFunc
+}
+
+func NewConsumer(host string, opts ConsumerOptions) *Consumer {
+	if opts.Prefetch <= 0 {
+		opts.Prefetch = 1
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = 10 * time.Second
+	}
+	if opts.HandlerTimeout <= 0 {
+		opts.HandlerTimeout = time.Minute
+	}
+
+	return &Consumer{host: host, opts: opts, handlers: map[string]HandlerFunc{}}
+}
+
+// Handle register the handler of the routing key, call it before Run
+func (c *Consumer) Handle(routingKey string, handler HandlerFunc) {
+	c.handlers[routingKey] = handler
+}
+
+// Run consume until ctx is done, then stop receiving and wait for the messages in progress
+func (c *Consumer) Run(ctx context.Context) error {
+	delay := time.Second
+	for {
+		connected, err := c.consume(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if connected {
+			delay = time.Second
+		}
+		log.Printf("[rabbit] consumer %s: %v, reconnecting in %s", c.opts.Queue, err, delay)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// consume run one connection until it's closed or ctx is done
+func (c *Consumer) consume(ctx context.Context) (bool, error) {
+	conn, ch, err := Connect(c.host)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	if err = c.declare(ch); err != nil {
+		return false, err
+	}
+	if err = ch.Qos(c.opts.Prefetch, 0, false); err != nil {
+		return false, err
+	}
+	// the retry and dead letter copies are confirmed before the original is acked
+	if err = ch.Confirm(false); err != nil {
+		return false, err
+	}
+
+	tag := fmt.Sprintf("%s-%d", c.opts.Queue, time.Now().UnixNano())
+	deliveries, err := ch.Consume(c.opts.Queue, tag, false, false, false, false, nil)
+	if err != nil {
+		return false, err
+	}
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.opts.Prefetch; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range deliveries {
+				c.process(ch, d)
+			}
+		}()
+	}
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-ctx.Done():
+		// stop the deliveries, the workers finish the messages they already have
+		_ = ch.Cancel(tag, false)
+		<-drained
+		return true, nil
+	case amqpErr := <-connClosed:
+		<-drained
+		return true, closeError(amqpErr)
+	case amqpErr := <-chClosed:
+		<-drained
+		return true, closeError(amqpErr)
+	case <-drained:
+		return true, errDeliveriesClosed
+	}
+}
+
+// closeError the error of a close notification, nil when it was closed by us
+func closeError(amqpErr *amqp.Error) error {
+	if amqpErr == nil {
+		return amqp.ErrClosed
+	}
+
+	return amqpErr
+}
+
+// declare the queue with its retry and dead letter queues
+func (c *Consumer) declare(ch *amqp.Channel) error {
+	q := c.opts.Queue
+
+	if _, err := ch.QueueDeclare(q+".dlq", true, false, false, false, nil); err != nil {
+		return err
+	}
+	// a retry queue per delay, the expired messages go back to the queue through the default exchange
+	for attempts := 1; attempts < c.opts.MaxAttempts; attempts++ {
+		delay := c.retryDelay(attempts)
+		if _, err := ch.QueueDeclare(c.retryQueue(delay), true, false, false, false, amqp.Table{
+			"x-message-ttl":             delay.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": q,
+		}); err != nil {
+			return err
+		}
+	}
+	if _, err := ch.QueueDeclare(q, true, false, false, false, nil); err != nil {
+		return err
+	}
+
+	if len(c.opts.Exchange) == 0 {
+		return nil
+	}
+	if err := ch.ExchangeDeclare(c.opts.Exchange, amqp.ExchangeTopic, true, false, false, false, nil); err != nil {
+		return err
+	}
+
+	keys := c.opts.BindingKeys
+	if len(keys) == 0 {
+		for key := range c.handlers {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		if err := ch.QueueBind(q, key, c.opts.Exchange, false, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Consumer) process(ch *amqp.Channel, d amqp.Delivery) {
+	routingKey := d.RoutingKey
+	if key, ok := d.Headers[HeaderRoutingKey].(string); ok && len(key) > 0 {
+		routingKey = key
+	}
+	attempts := headerInt(d.Headers, HeaderAttempts) + 1
+
+	handler, ok := c.handlers[routingKey]
+	if !ok {
+		c.deadLetter(ch, d, routingKey, attempts, fmt.Errorf("no handler for %s", routingKey))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.HandlerTimeout)
+	err := c.safeHandle(ctx, handler, d)
+	cancel()
+	if err == nil {
+		_ = d.Ack(false)
+		return
+	}
+
+	if attempts >= c.opts.MaxAttempts {
+		c.deadLetter(ch, d, routingKey, attempts, err)
+		return
+	}
+
+	delay := c.retryDelay(attempts)
+	log.Printf("[rabbit] %s %s attempt %d failed, retry in %s: %v", c.opts.Queue, routingKey, attempts, delay, err)
+
+	c.forward(ch, d, c.retryQueue(delay), republish(d, routingKey, attempts, err))
+}
+
+// retryDelay wait before the retry of a message failed attempts times, doubled at each attempt
+func (c *Consumer) retryDelay(attempts int) time.Duration {
+	delay := c.opts.RetryDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+	}
+
+	return delay
+}
+
+// retryQueue name of the retry queue of the delay, e.g. worker.retry.20s. The name carries
+// the delay so a new retry_delay declares new queues instead of conflicting with the TTL of
+// the existing ones.
+func (c *Consumer) retryQueue(delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", c.opts.Queue, delay)
+}
+
+// safeHandle turn a panic of the handler into an error so the message is retried
+func (c *Consumer) safeHandle(ctx context.Context, handler HandlerFunc, d amqp.Delivery) (err error) {
+	defer func() {
+		if rvr := recover(); rvr != nil {
+			err = fmt.Errorf("panic: %v", rvr)
+		}
+	}()
+
+	return handler(ctx, d)
+}
+
+func (c *Consumer) deadLetter(ch *amqp.Channel, d amqp.Delivery, routingKey string, attempts int, err error) {
+	log.Printf("[rabbit] %s %s moved to the dead letter queue after %d attempts: %v", c.opts.Queue, routingKey, attempts, err)
+	c.forward(ch, d, c.opts.Queue+".dlq", republish(d, routingKey, attempts, err))
+}
+
+// forward publish the copy to the queue and ack the original once the broker confirmed the
+// copy, the original is requeued when the copy isn't confirmed so the message isn't lost
+func (c *Consumer) forward(ch *amqp.Channel, d amqp.Delivery, queue string, msg amqp.Publishing) {
+	ctx, cancel := context.WithTimeout(context.Background(), confirmTimeout)
+	defer cancel()
+
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, "", queue, false, false, msg)
+	if err != nil || confirm == nil || !confirm.Wait() {
+		_ = d.Nack(false, true)
+		return
+	}
+	_ = d.Ack(false)
+}
+
+// republish copy of the delivery with the attempt headers
+func republish(d amqp.Delivery, routingKey string, attempts int, err error) amqp.Publishing {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[HeaderAttempts] = int32(attempts)
+	headers[HeaderRoutingKey] = routingKey
+	headers[HeaderError] = err.Error()
+
+	return amqp.Publishing{
+		Headers:         headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    amqp.Persistent,
+		CorrelationId:   d.CorrelationId,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		Body:            d.Body,
+	}
+}
+
+func headerInt(headers amqp.Table, key string) int {
+	switch v := headers[key].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	}
+
+	return 0
+}
@@ -0,0 +1,124 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+	// ErrNacked the broker refused the message
+	ErrNacked = errors.New("rabbitmq: message nacked by the broker")
+	// ErrUnroutable no queue is bound for the routing key, the broker returned the message
+	ErrUnroutable = errors.New("rabbitmq: message returned by the broker, no queue is bound for it")
+)
+
+// Publisher publish persistent messages to a durable topic exchange and wait for the
+// publisher confirm of each one. The messages are mandatory, a message no queue is bound
+// for is returned and refused with ErrUnroutable instead of being dropped. The connection is opened on the first publish and
+// opened again after it was closed.
+type Publisher struct {
+	host     string
+	exchange string
+
+	mu       sync.Mutex
+	conn     *amqp.Connection
+	ch       *amqp.Channel
+	confirms chan amqp.Confirmation
+	returns  chan amqp.Return
+}
+
+func NewPublisher(host, exchange string) *Publisher {
+	return &Publisher{host: host, exchange: exchange}
+}
+
+// Publish send the message and return once the broker confirmed it, a nil error means the
+// broker took the responsibility of the message
+func (p *Publisher) Publish(ctx context.Context, routingKey string, msg amqp.Publishing) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.connect(); err != nil {
+		return err
+	}
+
+	if msg.DeliveryMode == 0 {
+		msg.DeliveryMode = amqp.Persistent
+	}
+	if err := p.ch.PublishWithContext(ctx, p.exchange, routingKey, true, false, msg); err != nil {
+		p.reset()
+		return err
+	}
+
+	select {
+	case confirm, ok := <-p.confirms:
+		if !ok {
+			p.reset()
+			return amqp.ErrClosed
+		}
+		if !confirm.Ack {
+			return ErrNacked
+		}
+		// the broker sends the return of an unroutable message before its confirm
+		select {
+		case <-p.returns:
+			return ErrUnroutable
+		default:
+		}
+		return nil
+	case <-ctx.Done():
+		// the pending confirm would be read by the next publish, start over on a new channel
+		p.reset()
+		return ctx.Err()
+	}
+}
+
+// connect open the connection and the confirm channel and declare the exchange
+func (p *Publisher) connect() error {
+	if p.ch != nil && !p.ch.IsClosed() && p.conn != nil && !p.conn.IsClosed() {
+		return nil
+	}
+	p.reset()
+
+	conn, ch, err := Connect(p.host)
+	if err != nil {
+		return err
+	}
+
+	if err = ch.ExchangeDeclare(p.exchange, amqp.ExchangeTopic, true, false, false, false, nil); err != nil {
+		conn.Close()
+		return fmt.Errorf("rabbitmq: declare exchange %s: %w", p.exchange, err)
+	}
+	if err = ch.Confirm(false); err != nil {
+		conn.Close()
+		return fmt.Errorf("rabbitmq: enable publisher confirms: %w", err)
+	}
+
+	p.conn = conn
+	p.ch = ch
+	p.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	p.returns = ch.NotifyReturn(make(chan amqp.Return, 1))
+
+	return nil
+}
+
+func (p *Publisher) reset() {
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	p.conn = nil
+	p.ch = nil
+	p.confirms = nil
+	p.returns = nil
+}
+
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.reset()
+	return nil
+}
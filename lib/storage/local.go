@@ -0,0 +1,340 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// multipartRoot the directory of the multipart uploads under the root, it's under private/ so
+// the parts are never served
+const multipartRoot = "private/.multipart"
+
+// Local store the objects as files under the root directory, the content type is found
+// from the extension of the key. An object put with a content type must have the extension of
+// that type, so it's never served with another one, e.g. html put as a pdf.
+type Local struct {
+	root      string
+	publicURL string
+}
+
+// NewLocal the storage in root, the urls are publicURL/key
+func NewLocal(root, publicURL string) (*Local, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+
+	return &Local{root: root, publicURL: publicURL}, nil
+}
+
+// Root directory of the files
+func (l *Local) Root() string {
+	return l.root
+}
+
+// path the file of the key
+func (l *Local) path(key string) (string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error {
+	fn, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err = checkContentType(key, opts.ContentType); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return err
+	}
+
+	// write a temporary file then rename it, a reader never sees a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(fn), "."+filepath.Base(fn)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, &ctxReader{ctx: ctx, r: r})
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), fn)
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	obj, err := l.Stat(ctx, key)
+	if err != nil {
+		return nil, obj, err
+	}
+
+	fn, _ := l.path(key)
+	file, err := os.Open(fn)
+	if err != nil {
+		return nil, obj, notExist(err)
+	}
+
+	return file, obj, nil
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	fn, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(fn)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (l *Local) Stat(ctx context.Context, key string) (Object, error) {
+	fn, err := l.path(key)
+	if err != nil {
+		return Object{}, err
+	}
+
+	info, err := os.Stat(fn)
+	if err != nil {
+		return Object{}, notExist(err)
+	}
+	if info.IsDir() {
+		return Object{}, ErrNotExist
+	}
+
+	key, _ = CleanKey(key)
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if len(contentType) == 0 {
+		contentType = "application/octet-stream"
+	}
+
+	return Object{Key: key, Size: info.Size(), ContentType: contentType, ModTime: info.ModTime()}, nil
+}
+
+func (l *Local) URL(key string) string {
+	key, err := CleanKey(key)
+	if err != nil {
+		return ""
+	}
+
+	return joinURL(l.publicURL, key)
+}
+
+func (l *Local) List(ctx context.Context, prefix string, fn func(Object) error) error {
+	// walk the deepest directory of the prefix only
+	dir := "."
+	if i := strings.LastIndex(prefix, "/"); i > 0 {
+		cleaned, err := CleanKey(prefix[:i])
+		if err != nil {
+			return err
+		}
+		dir = cleaned
+	}
+
+	walkRoot := filepath.Join(l.root, filepath.FromSlash(dir))
+	err := filepath.WalkDir(walkRoot, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		// the temporary files of Put and the parts of the multipart uploads aren't objects
+		if strings.HasPrefix(d.Name(), ".") && d.IsDir() && file != walkRoot {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(l.root, file)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		obj, err := l.Stat(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		return fn(obj)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// multipartDir the directory of the parts of the upload, the id is the hex name of the directory
+func (l *Local) multipartDir(uploadID string) (string, error) {
+	if len(uploadID) == 0 {
+		return "", fmt.Errorf("storage: empty upload id")
+	}
+	if _, err := hex.DecodeString(uploadID); err != nil {
+		return "", fmt.Errorf("storage: invalid upload id %q", uploadID)
+	}
+
+	return filepath.Join(l.root, filepath.FromSlash(multipartRoot), uploadID), nil
+}
+
+// CreateMultipart the parts are files of a directory under root/private/.multipart until
+// the upload is completed
+func (l *Local) CreateMultipart(ctx context.Context, key string, opts PutOptions) (string, error) {
+	if _, err := CleanKey(key); err != nil {
+		return "", err
+	}
+	if err := checkContentType(key, opts.ContentType); err != nil {
+		return "", err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	uploadID := hex.EncodeToString(id)
+
+	dir, _ := l.multipartDir(uploadID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	return uploadID, nil
+}
+
+func (l *Local) UploadPart(ctx context.Context, key, uploadID string, number int, r io.ReadSeeker, size int64) (Part, error) {
+	dir, err := l.multipartDir(uploadID)
+	if err != nil {
+		return Part{}, err
+	}
+	if _, err = os.Stat(dir); err != nil {
+		return Part{}, notExist(err)
+	}
+
+	// the part is renamed once written, a retried part replaces it whole
+	tmp, err := os.CreateTemp(dir, ".part.*.tmp")
+	if err != nil {
+		return Part{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, &ctxReader{ctx: ctx, r: r})
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return Part{}, err
+	}
+	if n != size {
+		return Part{}, fmt.Errorf("storage: part %d has %d bytes, expected %d", number, n, size)
+	}
+	if err = os.Rename(tmp.Name(), filepath.Join(dir, strconv.Itoa(number))); err != nil {
+		return Part{}, err
+	}
+
+	return Part{Number: number, ETag: strconv.Itoa(number), Size: size}, nil
+}
+
+func (l *Local) CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) error {
+	dir, err := l.multipartDir(uploadID)
+	if err != nil {
+		return err
+	}
+
+	readers := make([]io.Reader, 0, len(parts))
+	for _, p := range parts {
+		file, err := os.Open(filepath.Join(dir, strconv.Itoa(p.Number)))
+		if err != nil {
+			return notExist(err)
+		}
+		defer file.Close()
+		readers = append(readers, file)
+	}
+
+	if err = l.Put(ctx, key, io.MultiReader(readers...), PutOptions{}); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
+
+func (l *Local) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	dir, err := l.multipartDir(uploadID)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
+
+// checkContentType the type found from the extension of the key is the content type, when
+// it's set, the parameters such as the charset aren't compared
+func checkContentType(key, contentType string) error {
+	if len(contentType) == 0 {
+		return nil
+	}
+
+	want, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("storage: invalid content type %q", contentType)
+	}
+	got, _, _ := mime.ParseMediaType(mime.TypeByExtension(path.Ext(key)))
+	if got != want {
+		return fmt.Errorf("storage: the extension of %q isn't the one of %s", key, want)
+	}
+
+	return nil
+}
+
+// notExist ErrNotExist for a missing file
+func notExist(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotExist
+	}
+
+	return err
+}
+
+// ctxReader stop the copy when ctx is done
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return cr.r.Read(p)
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalMultipartResume(t *testing.T) {
+	ctx := context.Background()
+	l, err := NewLocal(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := "private/uploads/report.pdf"
+	id, err := l.CreateMultipart(ctx, key, PutOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := l.multipartDir(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel, _ := filepath.Rel(l.Root(), dir); !strings.HasPrefix(filepath.ToSlash(rel), "private/") {
+		t.Errorf("parts stored in %s, want under private/", rel)
+	}
+
+	upload := func(number int, content string) Part {
+		t.Helper()
+		part, err := l.UploadPart(ctx, key, id, number, strings.NewReader(content), int64(len(content)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return part
+	}
+
+	// part 2 is sent again after a failed request, the retry replaces it whole
+	p1 := upload(1, "first-")
+	upload(2, "broken")
+	p2 := upload(2, "second-")
+	p3 := upload(3, "third")
+
+	// a part with less bytes than announced is refused
+	if _, err = l.UploadPart(ctx, key, id, 4, strings.NewReader("abc"), 5); err == nil {
+		t.Error("short part accepted")
+	}
+
+	if err = l.CompleteMultipart(ctx, key, id, []Part{p1, p2, p3}); err != nil {
+		t.Fatal(err)
+	}
+	body, _, err := l.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	got, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte("first-second-third"); !bytes.Equal(got, want) {
+		t.Errorf("completed object %q, want %q", got, want)
+	}
+
+	// the parts are removed once completed, aborting again isn't an error
+	if _, err = l.UploadPart(ctx, key, id, 1, strings.NewReader("x"), 1); err != ErrNotExist {
+		t.Errorf("part of a completed upload: %v, want ErrNotExist", err)
+	}
+	if err = l.AbortMultipart(ctx, key, id); err != nil {
+		t.Errorf("abort of a completed upload: %v", err)
+	}
+}
+
+func TestLocalMultipartInvalidID(t *testing.T) {
+	l, err := NewLocal(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"", "../../etc", "zz"} {
+		if _, err = l.UploadPart(context.Background(), "a", id, 1, strings.NewReader("x"), 1); err == nil {
+			t.Errorf("upload id %q accepted", id)
+		}
+	}
+}
+
+func TestLocalContentType(t *testing.T) {
+	ctx := context.Background()
+	l, err := NewLocal(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// html put as a pdf would be served as text/html by its extension
+	if err = l.Put(ctx, "uploads/x.html", strings.NewReader("<script></script>"), PutOptions{ContentType: "application/pdf"}); err == nil {
+		t.Error("pdf put with the .html extension")
+	}
+	if _, err = l.CreateMultipart(ctx, "uploads/x.html", PutOptions{ContentType: "application/pdf"}); err == nil {
+		t.Error("pdf multipart created with the .html extension")
+	}
+
+	if err = l.Put(ctx, "uploads/x.pdf", strings.NewReader("%PDF-1.4"), PutOptions{ContentType: "application/pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	obj, err := l.Stat(ctx, "uploads/x.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.ContentType != "application/pdf" {
+		t.Errorf("content type %q, want application/pdf", obj.ContentType)
+	}
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+// MinPartSize of the parts of a multipart upload but the last one, the limit of S3
+const MinPartSize = 5 << 20
+
+// Part an uploaded part of a multipart upload
+type Part struct {
+	Number int    `json:"number"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+}
+
+// Multipart is implemented by the backends that build an object from parts uploaded by
+// separate calls, e.g. by the requests of a resumable upload. Every part but the last one
+// must be at least MinPartSize.
+type Multipart interface {
+	// CreateMultipart start the upload of the object, the returned id is given to the other calls
+	CreateMultipart(ctx context.Context, key string, opts PutOptions) (string, error)
+	// UploadPart store the part number (from 1) of the upload, a part uploaded again is replaced
+	UploadPart(ctx context.Context, key, uploadID string, number int, r io.ReadSeeker, size int64) (Part, error)
+	// CompleteMultipart create the object from the parts in their order
+	CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) error
+	// AbortMultipart discard the uploaded parts, aborting an unknown upload isn't an error
+	AbortMultipart(ctx context.Context, key, uploadID string) error
+}
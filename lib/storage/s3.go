@@ -0,0 +1,362 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// S3Options of the S3 backend, Endpoint and PathStyle are for the S3-compatible servers
+type S3Options struct {
+	// Endpoint e.g. http://localhost:9000, empty for AWS
+	Endpoint string
+	// PathStyle address the bucket in the path (endpoint/bucket/key) instead of the host
+	PathStyle bool
+	Region    string
+	Key       string
+	Secret    string
+	Bucket    string
+	// Prefix prepended to the keys, e.g. api/uploads
+	Prefix string
+	// PublicURL base of the urls, the bucket url when it's empty
+	PublicURL string
+}
+
+// S3 store the objects in a bucket of AWS S3 or of an S3-compatible server, the client is
+// created once and shared
+type S3 struct {
+	opts     S3Options
+	client   *s3.S3
+	uploader *s3manager.Uploader
+}
+
+func NewS3(opts S3Options) (*S3, error) {
+	if len(opts.Bucket) == 0 {
+		return nil, fmt.Errorf("storage: the s3 bucket is empty")
+	}
+	if len(opts.Region) == 0 {
+		// the S3-compatible servers accept any region
+		opts.Region = "us-east-1"
+	}
+	opts.Prefix = strings.Trim(opts.Prefix, "/")
+
+	cfg := &aws.Config{
+		Region:           aws.String(opts.Region),
+		Credentials:      credentials.NewStaticCredentials(opts.Key, opts.Secret, ""),
+		S3ForcePathStyle: aws.Bool(opts.PathStyle),
+	}
+	if len(opts.Endpoint) > 0 {
+		cfg.Endpoint = aws.String(opts.Endpoint)
+		cfg.DisableSSL = aws.Bool(strings.HasPrefix(opts.Endpoint, "http://"))
+	}
+
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client := s3.New(sess)
+
+	return &S3{opts: opts, client: client, uploader: s3manager.NewUploaderWithClient(client)}, nil
+}
+
+// key the key in the bucket
+func (b *S3) key(key string) (string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	if len(b.opts.Prefix) > 0 {
+		key = b.opts.Prefix + "/" + key
+	}
+
+	return key, nil
+}
+
+func (b *S3) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error {
+	objectKey, err := b.key(key)
+	if err != nil {
+		return err
+	}
+
+	input := &s3manager.UploadInput{
+		Bucket:               aws.String(b.opts.Bucket),
+		Key:                  aws.String(objectKey),
+		Body:                 r,
+		ServerSideEncryption: aws.String("AES256"),
+	}
+	if len(opts.ContentType) > 0 {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+	if len(opts.ContentDisposition) > 0 {
+		input.ContentDisposition = aws.String(opts.ContentDisposition)
+	}
+	if opts.Public {
+		input.ACL = aws.String(s3.ObjectCannedACLPublicRead)
+	}
+	// the S3-compatible servers don't all support the server side encryption
+	if len(b.opts.Endpoint) > 0 {
+		input.ServerSideEncryption = nil
+	}
+
+	// the uploader sends the large bodies in parts, the size doesn't need to be known
+	_, err = b.uploader.UploadWithContext(ctx, input)
+
+	return err
+}
+
+func (b *S3) Get(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	objectKey, err := b.key(key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+
+	out, err := b.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.opts.Bucket),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		return nil, Object{}, s3Error(err)
+	}
+
+	obj := Object{
+		Key:         strings.TrimPrefix(objectKey, b.opts.Prefix+"/"),
+		Size:        aws.Int64Value(out.ContentLength),
+		ContentType: aws.StringValue(out.ContentType),
+		ModTime:     aws.TimeValue(out.LastModified),
+	}
+
+	return out.Body, obj, nil
+}
+
+func (b *S3) Delete(ctx context.Context, key string) error {
+	objectKey, err := b.key(key)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(b.opts.Bucket),
+		Key:    aws.String(objectKey),
+	})
+	if err = s3Error(err); errors.Is(err, ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func (b *S3) Stat(ctx context.Context, key string) (Object, error) {
+	objectKey, err := b.key(key)
+	if err != nil {
+		return Object{}, err
+	}
+
+	out, err := b.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(b.opts.Bucket),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		return Object{}, s3Error(err)
+	}
+
+	return Object{
+		Key:         strings.TrimPrefix(objectKey, b.opts.Prefix+"/"),
+		Size:        aws.Int64Value(out.ContentLength),
+		ContentType: aws.StringValue(out.ContentType),
+		ModTime:     aws.TimeValue(out.LastModified),
+	}, nil
+}
+
+// URL the PublicURL with the key, or the url of the object in the bucket
+func (b *S3) URL(key string) string {
+	objectKey, err := b.key(key)
+	if err != nil {
+		return ""
+	}
+	escaped := (&url.URL{Path: objectKey}).EscapedPath()
+
+	switch {
+	case len(b.opts.PublicURL) > 0:
+		return joinURL(b.opts.PublicURL, escaped)
+	case len(b.opts.Endpoint) > 0 && b.opts.PathStyle:
+		return joinURL(b.opts.Endpoint, path.Join(b.opts.Bucket, escaped))
+	case len(b.opts.Endpoint) > 0:
+		u, err := url.Parse(b.opts.Endpoint)
+		if err != nil {
+			return ""
+		}
+		u.Host = b.opts.Bucket + "." + u.Host
+		return joinURL(u.String(), escaped)
+	}
+
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", b.opts.Bucket, b.opts.Region, escaped)
+}
+
+func (b *S3) List(ctx context.Context, prefix string, fn func(Object) error) error {
+	objectPrefix := prefix
+	if len(b.opts.Prefix) > 0 {
+		objectPrefix = b.opts.Prefix + "/" + strings.TrimPrefix(prefix, "/")
+	}
+
+	var fnErr error
+	err := b.client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.opts.Bucket),
+		Prefix: aws.String(objectPrefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, item := range page.Contents {
+			fnErr = fn(Object{
+				Key:     strings.TrimPrefix(aws.StringValue(item.Key), b.opts.Prefix+"/"),
+				Size:    aws.Int64Value(item.Size),
+				ModTime: aws.TimeValue(item.LastModified),
+			})
+			if fnErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+
+	return err
+}
+
+func (b *S3) PresignGet(key string, expires time.Duration, filename string) (string, error) {
+	objectKey, err := b.key(key)
+	if err != nil {
+		return "", err
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(b.opts.Bucket),
+		Key:    aws.String(objectKey),
+	}
+	if len(filename) > 0 {
+		input.ResponseContentDisposition = aws.String(mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	}
+	req, _ := b.client.GetObjectRequest(input)
+
+	return req.Presign(expires)
+}
+
+func (b *S3) CreateMultipart(ctx context.Context, key string, opts PutOptions) (string, error) {
+	objectKey, err := b.key(key)
+	if err != nil {
+		return "", err
+	}
+
+	input := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(b.opts.Bucket),
+		Key:    aws.String(objectKey),
+	}
+	if len(opts.ContentType) > 0 {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+	if len(opts.ContentDisposition) > 0 {
+		input.ContentDisposition = aws.String(opts.ContentDisposition)
+	}
+	if opts.Public {
+		input.ACL = aws.String(s3.ObjectCannedACLPublicRead)
+	}
+	if len(b.opts.Endpoint) == 0 {
+		input.ServerSideEncryption = aws.String("AES256")
+	}
+
+	out, err := b.client.CreateMultipartUploadWithContext(ctx, input)
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(out.UploadId), nil
+}
+
+func (b *S3) UploadPart(ctx context.Context, key, uploadID string, number int, r io.ReadSeeker, size int64) (Part, error) {
+	objectKey, err := b.key(key)
+	if err != nil {
+		return Part{}, err
+	}
+
+	out, err := b.client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(b.opts.Bucket),
+		Key:           aws.String(objectKey),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int64(int64(number)),
+		Body:          r,
+		ContentLength: aws.Int64(size),
+	})
+	if err != nil {
+		return Part{}, err
+	}
+
+	return Part{Number: number, ETag: aws.StringValue(out.ETag), Size: size}, nil
+}
+
+func (b *S3) CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) error {
+	objectKey, err := b.key(key)
+	if err != nil {
+		return err
+	}
+
+	completed := make([]*s3.CompletedPart, 0, len(parts))
+	for _, p := range parts {
+		completed = append(completed, &s3.CompletedPart{
+			ETag:       aws.String(p.ETag),
+			PartNumber: aws.Int64(int64(p.Number)),
+		})
+	}
+
+	_, err = b.client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(b.opts.Bucket),
+		Key:             aws.String(objectKey),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+
+	return err
+}
+
+func (b *S3) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	objectKey, err := b.key(key)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(b.opts.Bucket),
+		Key:      aws.String(objectKey),
+		UploadId: aws.String(uploadID),
+	})
+	var aErr awserr.Error
+	if errors.As(err, &aErr) && aErr.Code() == s3.ErrCodeNoSuchUpload {
+		return nil
+	}
+
+	return err
+}
+
+// s3Error ErrNotExist for a missing object
+func s3Error(err error) error {
+	var aErr awserr.Error
+	if errors.As(err, &aErr) {
+		switch aErr.Code() {
+		case s3.ErrCodeNoSuchKey, "NotFound":
+			return ErrNotExist
+		}
+	}
+
+	return err
+}
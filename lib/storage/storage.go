@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-skeleton/lib/utils"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// Drivers of storage.driver
+const (
+	DriverLocal    = "local"
+	DriverS3       = "s3"
+	DriverS3Compat = "s3compat"
+)
+
+// ErrNotExist the object doesn't exist
+var ErrNotExist = errors.New("storage: object does not exist")
+
+// Object the attributes of a stored object
+type Object struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// PutOptions of an object, a negative Size is an unknown size
+type PutOptions struct {
+	ContentType string
+	// ContentDisposition e.g. attachment, empty to let the client decide
+	ContentDisposition string
+	Size               int64
+	// Public make the object readable by anyone at its URL, the objects are private otherwise
+	Public bool
+}
+
+// Storage store the objects by key, the keys are slash separated paths such as
+// uploads/2023/file.pdf. The backends are safe for concurrent use.
+type Storage interface {
+	// Put create or replace the object with the content of r
+	Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error
+	// Get the content of the object, close it after use, ErrNotExist when it doesn't exist
+	Get(ctx context.Context, key string) (io.ReadCloser, Object, error)
+	// Delete the object, deleting an object that doesn't exist isn't an error
+	Delete(ctx context.Context, key string) error
+	// Stat the attributes of the object, ErrNotExist when it doesn't exist
+	Stat(ctx context.Context, key string) (Object, error)
+	// URL the public url of the object
+	URL(key string) string
+	// List call fn with every object of which the key starts with prefix, stop at the first
+	// error of fn
+	List(ctx context.Context, prefix string, fn func(Object) error) error
+}
+
+// Presigner is implemented by the backends that can give a temporary url to a private object
+type Presigner interface {
+	// PresignGet the url to download the object until expires elapses, filename is the
+	// name of the downloaded file when it's not empty
+	PresignGet(key string, expires time.Duration, filename string) (string, error)
+}
+
+// New the backend of storage.driver: local (default), s3 or s3compat
+func New(config utils.Config) (Storage, error) {
+	switch driver := strings.ToLower(config.GetString("storage.driver")); driver {
+	case "", DriverLocal:
+		root := config.GetString("upload_path")
+		if len(root) == 0 {
+			root = "./storages/uploads"
+		}
+		return NewLocal(root, config.GetString("storage.local.public_url"))
+	case DriverS3:
+		return NewS3(S3Options{
+			Region:    config.GetString("aws.s3.region"),
+			Key:       config.GetString("aws.s3.key"),
+			Secret:    config.GetString("aws.s3.secret"),
+			Bucket:    config.GetString("aws.s3.bucket"),
+			Prefix:    config.GetString("aws.s3.filepath"),
+			PublicURL: config.GetString("aws.s3.public_url"),
+		})
+	case DriverS3Compat:
+		return NewS3(S3Options{
+			Endpoint:  config.GetString("storage.s3compat.endpoint"),
+			PathStyle: true,
+			Region:    config.GetString("storage.s3compat.region"),
+			Key:       config.GetString("storage.s3compat.key"),
+			Secret:    config.GetString("storage.s3compat.secret"),
+			Bucket:    config.GetString("storage.s3compat.bucket"),
+			Prefix:    config.GetString("storage.s3compat.prefix"),
+			PublicURL: config.GetString("storage.s3compat.public_url"),
+		})
+	default:
+		return nil, fmt.Errorf("storage: unknown driver %q (local|s3|s3compat)", driver)
+	}
+}
+
+// CleanKey the key without leading slash nor dot segments, an error when it's empty or
+// goes above the root
+func CleanKey(key string) (string, error) {
+	if strings.Contains(key, "\x00") || strings.Contains(key, `\`) {
+		return "", fmt.Errorf("storage: invalid key %q", key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("storage: invalid key %q", key)
+		}
+	}
+
+	cleaned := strings.TrimPrefix(path.Clean("/"+key), "/")
+	if len(cleaned) == 0 {
+		return "", fmt.Errorf("storage: empty key")
+	}
+
+	return cleaned, nil
+}
+
+// joinURL the base url and the key
+func joinURL(base, key string) string {
+	return strings.TrimSuffix(base, "/") + "/" + key
+}
@@ -0,0 +1,102 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RFC 6238 parameters supported by every authenticator app
+const (
+	Digits = 6
+	Period = 30
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret create a new random 160 bit secret in base32
+func GenerateSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return encoding.EncodeToString(b), nil
+}
+
+// URI build the otpauth:// URI to be shown as QR code in the authenticator app
+func URI(issuer, account, secret string) string {
+	param := url.Values{}
+	param.Set("secret", secret)
+	param.Set("issuer", issuer)
+	param.Set("algorithm", "SHA1")
+	param.Set("digits", fmt.Sprintf("%d", Digits))
+	param.Set("period", fmt.Sprintf("%d", Period))
+
+	// authenticator apps expect %20 instead of + for spaces
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + strings.ReplaceAll(param.Encode(), "+", "%20")
+}
+
+// Step the time step counter of t
+func Step(t time.Time) int64 {
+	return t.Unix() / Period
+}
+
+// Code generate the code of the secret for the time step (RFC 4226 HOTP)
+func Code(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", Digits, value%1000000), nil
+}
+
+// Validate check the code against the time steps around t, allowing skew steps of
+// clock drift. It returns the matched step so the caller can refuse a replay.
+func Validate(secret, code string, t time.Time, skew int64) (int64, bool) {
+	return ValidateAfter(secret, code, t, skew, -1)
+}
+
+// ValidateAfter is Validate refusing the steps up to last, the step of the code accepted
+// before, so a code can't be replayed. last is -1 when no code has been accepted yet.
+func ValidateAfter(secret, code string, t time.Time, skew, last int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	current := Step(t)
+	for i := -skew; i <= skew; i++ {
+		if current+i <= last {
+			continue
+		}
+		expected, err := Code(secret, current+i)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return current + i, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,120 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// the shared secret of the RFC 6238 SHA-1 test vectors
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeRFC6238(t *testing.T) {
+	// RFC 6238 appendix B, the 8 digit codes truncated to the last 6 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", tt.unix, err)
+		}
+		if got != tt.code {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestValidateWindow(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	tests := []struct {
+		name   string
+		offset int64
+		ok     bool
+	}{
+		{"previous step", -1, true},
+		{"current step", 0, true},
+		{"next step", 1, true},
+		{"two steps before", -2, false},
+		{"two steps after", 2, false},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, current+tt.offset)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		step, ok := Validate(rfcSecret, code, now, 1)
+		if ok != tt.ok {
+			t.Errorf("%s: Validate = %v, want %v", tt.name, ok, tt.ok)
+		}
+		if ok && step != current+tt.offset {
+			t.Errorf("%s: step = %d, want %d", tt.name, step, current+tt.offset)
+		}
+	}
+}
+
+func TestValidateMalformed(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	for _, code := range []string{"", "28708", "2870820", "abcdef"} {
+		if _, ok := Validate(rfcSecret, code, now, 1); ok {
+			t.Errorf("Validate(%q) accepted", code)
+		}
+	}
+	if _, ok := Validate("not base32!", "287082", now, 1); ok {
+		t.Error("Validate accepted an invalid secret")
+	}
+}
+
+func TestValidateAfterReplay(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	code, err := Code(rfcSecret, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok := ValidateAfter(rfcSecret, code, now, 1, -1)
+	if !ok || step != current {
+		t.Fatalf("first use: ValidateAfter = %d, %v, want %d, true", step, ok, current)
+	}
+
+	// the same code again, also from the next step where it's still in the window
+	if _, ok := ValidateAfter(rfcSecret, code, now, 1, step); ok {
+		t.Error("replayed code accepted")
+	}
+	if _, ok := ValidateAfter(rfcSecret, code, now.Add(Period*time.Second), 1, step); ok {
+		t.Error("replayed code accepted on the next step")
+	}
+
+	// an older code of the window is refused once a newer one was used
+	previous, err := Code(rfcSecret, current-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ValidateAfter(rfcSecret, previous, now, 1, step); ok {
+		t.Error("code older than the last accepted step accepted")
+	}
+
+	// the code of the next step is still accepted
+	next, err := Code(rfcSecret, current+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := ValidateAfter(rfcSecret, next, now, 1, step); !ok || got != current+1 {
+		t.Errorf("next step: ValidateAfter = %d, %v, want %d, true", got, ok, current+1)
+	}
+}
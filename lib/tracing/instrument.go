@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PgxLogger turn the queries logged by pgx into client spans. pgx v4 has no tracer interface
+// (the otel pgx tracers need pgx v5), so the span is created when the query is done, from its
+// duration. Set it as the ConnConfig.Logger with LogLevel pgx.LogLevelInfo.
+type PgxLogger struct{}
+
+func (PgxLogger) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	// only the messages of Exec, Query, SendBatch and CopyFrom have a duration
+	elapsed, ok := data["time"].(time.Duration)
+	if !ok {
+		return
+	}
+
+	end := time.Now()
+	attrs := []attribute.KeyValue{
+		semconv.DBSystemPostgreSQL,
+		semconv.DBOperationKey.String(msg),
+	}
+	if sql, ok := data["sql"].(string); ok {
+		attrs = append(attrs, semconv.DBStatementKey.String(sql))
+	}
+	if rowCount, ok := data["rowCount"].(int); ok {
+		attrs = append(attrs, attribute.Int("db.rows", rowCount))
+	}
+	if batchLen, ok := data["batchLen"].(int); ok {
+		attrs = append(attrs, attribute.Int("db.batch_len", batchLen))
+	}
+
+	_, span := Start(ctx, "db "+msg,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(end.Add(-elapsed)),
+		trace.WithAttributes(attrs...))
+	if err, ok := data["err"].(error); ok {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(trace.WithTimestamp(end))
+}
+
+// NewTransport wrap base (http.DefaultTransport when nil) for the outbound http clients, a
+// client span is created per request and the traceparent is sent to the server
+func NewTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return otelhttp.NewTransport(redactQuery{base})
+}
+
+// redactQuery record the url of the client span without the query, it may carry a token
+type redactQuery struct {
+	base http.RoundTripper
+}
+
+func (t redactQuery) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := *req.URL
+	u.User = nil
+	u.RawQuery = ""
+	trace.SpanFromContext(req.Context()).SetAttributes(semconv.HTTPURLKey.String(u.String()))
+
+	return t.base.RoundTrip(req)
+}
+
+// LogrusHook add the trace_id and span_id of the entry context to the fields, the entry
+// must be created with WithContext(ctx)
+type LogrusHook struct{}
+
+func (LogrusHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (LogrusHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+
+	sc := trace.SpanContextFromContext(entry.Context)
+	if !sc.IsValid() {
+		return nil
+	}
+	entry.Data["trace_id"] = sc.TraceID().String()
+	entry.Data["span_id"] = sc.SpanID().String()
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"go-skeleton/lib/utils"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName of the tracer of the spans created by the app
+const instrumentationName = "go-skeleton"
+
+var (
+	provider *sdktrace.TracerProvider
+	// file of the file exporter, closed by Shutdown
+	file *os.File
+)
+
+// Enabled true once Setup installed the tracer provider
+func Enabled() bool {
+	return provider != nil
+}
+
+// Setup install the OpenTelemetry tracer provider and the W3C trace context propagator from
+// the config, nothing is done when tracing.enabled is false.
+//
+//	tracing.exporter      otlp (default), stdout or file
+//	tracing.service_name  service.name of the resource
+//	tracing.sample_rate   ratio of the traces recorded, e.g. "0.25" (default 1)
+//	tracing.otlp.endpoint collector url, e.g. http://localhost:4318
+//	tracing.otlp.headers  extra headers, e.g. "x-api-key=secret,x-team=core"
+//	tracing.file.path     file of the file exporter
+func Setup(conf utils.Config) error {
+	if !conf.GetBool("tracing.enabled") {
+		return nil
+	}
+
+	sampleRate := 1.0
+	if rate := conf.GetString("tracing.sample_rate"); len(rate) > 0 {
+		v, err := strconv.ParseFloat(rate, 64)
+		if err != nil {
+			return fmt.Errorf("invalid tracing.sample_rate %q: %v", rate, err)
+		}
+		sampleRate = v
+	}
+
+	exporter, err := newExporter(conf)
+	if err != nil {
+		return err
+	}
+
+	serviceName := conf.GetString("tracing.service_name")
+	if len(serviceName) == 0 {
+		serviceName = instrumentationName
+	}
+
+	// a request with a traceparent follows the sampling decision of the caller
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRate))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return nil
+}
+
+// newExporter the exporter of tracing.exporter
+func newExporter(conf utils.Config) (sdktrace.SpanExporter, error) {
+	switch name := conf.GetString("tracing.exporter"); name {
+	case "", "otlp":
+		opts, err := otlpOptions(conf.GetString("tracing.otlp.endpoint"), parseHeaders(conf.GetString("tracing.otlp.headers")))
+		if err != nil {
+			return nil, err
+		}
+		return otlptracehttp.New(context.Background(), opts...)
+	case "stdout":
+		return stdouttrace.New()
+	case "file":
+		path := conf.GetString("tracing.file.path")
+		if len(path) == 0 {
+			return nil, fmt.Errorf("tracing.file.path is required by the file exporter")
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		file = f
+		return stdouttrace.New(stdouttrace.WithWriter(f))
+	default:
+		return nil, fmt.Errorf("unknown tracing.exporter %q", name)
+	}
+}
+
+// otlpOptions the OTLP/HTTP options of the collector url, the spans are sent to <url>/v1/traces
+func otlpOptions(endpoint string, headers map[string]string) ([]otlptracehttp.Option, error) {
+	if len(endpoint) == 0 {
+		endpoint = "http://localhost:4318"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || len(u.Host) == 0 {
+		return nil, fmt.Errorf("invalid tracing.otlp.endpoint %q", endpoint)
+	}
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(strings.TrimSuffix(u.Path, "/") + "/v1/traces"),
+	}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if len(headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(headers))
+	}
+
+	return opts, nil
+}
+
+// Shutdown export the queued spans and close the exporter
+func Shutdown(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+
+	err := provider.Shutdown(ctx)
+	provider = nil
+	if file != nil {
+		if cErr := file.Close(); err == nil {
+			err = cErr
+		}
+		file = nil
+	}
+
+	return err
+}
+
+// Start a span with the tracer of the app, a no-op span when tracing is off
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// parseHeaders the "k=v,k2=v2" list of tracing.otlp.headers
+func parseHeaders(s string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || len(strings.TrimSpace(kv[0])) == 0 {
+			continue
+		}
+		headers[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+
+	return headers
+}
@@ -1,8 +1,9 @@
 package upload
 
 import (
-	"errors"
+	"go-skeleton/lib/apperr"
 	"go-skeleton/lib/utils"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"strings"
@@ -12,6 +13,9 @@ const (
 	// MB size constant
 	MB             = 1 << 20
 	ContentTypePDF = "application/pdf"
+
+	// formMemory of the multipart form, the larger parts are stored in temporary files
+	formMemory = 1 * MB
 )
 
 // Sizer ...
@@ -32,52 +36,84 @@ type FileInfo struct {
 	FileExt  string
 }
 
-// MultipartHandler handle multipart form data file upload
+// countingReader count the bytes read from the body, a form error after more bytes than
+// the limit of the MaxBytesReader is the body being too large
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// MultipartHandler handle multipart form data file upload, the body is limited to MaxSize MB
+// and the parts above 1 MB are kept in temporary files instead of the memory
 func (fu Info) MultipartHandler(w http.ResponseWriter, r *http.Request, key string, AllowedExt []string) (multipart.File, FileInfo, error) {
-	if err := r.ParseMultipartForm(fu.MaxSize * MB); err != nil {
-		return nil, FileInfo{}, err
-	}
+	// Limit upload size, the form fields and the boundaries have 1 MB on top of the file
+	limit := fu.MaxSize*MB + formMemory
+	body := &countingReader{ReadCloser: r.Body}
+	r.Body = http.MaxBytesReader(w, body, limit)
 
-	// Limit upload size
-	r.Body = http.MaxBytesReader(w, r.Body, fu.MaxSize*MB) // 10 Mb
+	if err := r.ParseMultipartForm(formMemory); err != nil {
+		if body.n > limit {
+			return nil, FileInfo{}, apperr.Wrap(err, apperr.Validation, apperr.CodeFileTooLarge, utils.ErrFileTooLarge)
+		}
+		return nil, FileInfo{}, apperr.Wrap(err, apperr.Validation, apperr.CodeBadRequest, utils.ErrInvalidUploadForm)
+	}
 
 	// get the file informations
 	file, multipartFileHeader, err := r.FormFile(key)
 	if err != nil {
-		return nil, FileInfo{}, err
+		return nil, FileInfo{}, apperr.Wrap(err, apperr.Validation, apperr.CodeBadRequest, utils.ErrInvalidUploadForm)
+	}
+	if multipartFileHeader.Size > fu.MaxSize*MB {
+		file.Close()
+		return nil, FileInfo{}, apperr.New(apperr.Validation, apperr.CodeFileTooLarge, utils.ErrFileTooLarge)
 	}
 	contentTypeFileHeader := multipartFileHeader.Header.Get("Content-Type")
 
 	// Create a buffer to store the header of the file in
 	// And copy the headers into the FileHeader buffer
 	fileHeader := make([]byte, 512)
-	if _, err := file.Read(fileHeader); err != nil {
-		return nil, FileInfo{}, err
+	n, err := file.Read(fileHeader)
+	if err != nil {
+		file.Close()
+		return nil, FileInfo{}, apperr.Wrap(err, apperr.Validation, apperr.CodeBadRequest, utils.ErrInvalidUploadForm)
 	}
 
 	// set position back to start.
 	if _, err := file.Seek(0, 0); err != nil {
+		file.Close()
 		return nil, FileInfo{}, err
 	}
 
-	defer file.Close()
-
-	// Adjust mime type ext
-	mime := http.DetectContentType(fileHeader)
-	if contentTypeFileHeader == ContentTypePDF {
-		mime = ContentTypePDF
-	}
-	ext := strings.Split(mime, "/")[1]
-
 	// Check content type allowed
+	mime, ext := DetectContentType(fileHeader[:n], contentTypeFileHeader)
 	if !utils.StringContainsArray(AllowedExt, ext) {
-		return nil, FileInfo{}, errors.New(utils.ErrContentTypeNotAllowed)
+		file.Close()
+		return nil, FileInfo{}, apperr.New(apperr.Validation, apperr.CodeFileTypeNotAllowed, utils.ErrContentTypeNotAllowed)
 	}
 
 	return file, FileInfo{
 		Filename: multipartFileHeader.Filename,
-		FileSize: file.(Sizer).Size(),
+		FileSize: multipartFileHeader.Size,
 		FileMime: mime,
 		FileExt:  ext,
 	}, nil
 }
+
+// DetectContentType the mime type and its extension from the first 512 bytes of the file,
+// declared is the content type given by the client, trusted for the pdf only
+func DetectContentType(header []byte, declared string) (string, string) {
+	// Adjust mime type ext
+	mime := http.DetectContentType(header)
+	if declared == ContentTypePDF {
+		mime = ContentTypePDF
+	}
+	ext := strings.Split(mime, "/")[1]
+
+	return mime, ext
+}
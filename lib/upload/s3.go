@@ -2,6 +2,7 @@ package upload
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"log"
 	"os"
@@ -22,10 +23,21 @@ type S3Info struct {
 	Filename string
 	Filemime string
 	Filesize int64
+	// ACL canned ACL of the object e.g. public-read, empty keeps the object private
+	ACL string
 }
 
-// PushS3Buffer ...
-func PushS3Buffer(buffer *bytes.Reader, in S3Info) error {
+// acl the ACL of the object, nil to use the bucket default
+func (in S3Info) acl() *string {
+	if len(in.ACL) == 0 {
+		return nil
+	}
+
+	return aws.String(in.ACL)
+}
+
+// PushS3Buffer upload the buffer, the upload is aborted when ctx is done
+func PushS3Buffer(ctx context.Context, buffer *bytes.Reader, in S3Info) error {
 	session, err := session.NewSession(&aws.Config{
 		Region:      &in.Region,
 		Credentials: credentials.NewStaticCredentials(in.Key, in.Secret, ""),
@@ -37,10 +49,10 @@ func PushS3Buffer(buffer *bytes.Reader, in S3Info) error {
 	// config settings: this is where you choose the bucket,
 	// filename, content-type and storage class of the file
 	// you're uploading
-	_, err = s3.New(session).PutObject(&s3.PutObjectInput{
+	_, err = s3.New(session).PutObjectWithContext(ctx, &s3.PutObjectInput{
 		Bucket:               aws.String(in.Bucket),
 		Key:                  aws.String(in.Filename),
-		ACL:                  aws.String("public-read"), // could be private if you want it to be access by only authorized users
+		ACL:                  in.acl(),
 		Body:                 buffer,
 		ContentLength:        aws.Int64(in.Filesize),
 		ContentType:          aws.String(in.Filemime),
@@ -77,7 +89,7 @@ func PushS3ByPath(fPath string, in S3Info) error {
 	_, err = s3.New(session).PutObject(&s3.PutObjectInput{
 		Bucket:               aws.String(in.Bucket),
 		Key:                  aws.String(in.Filename),
-		ACL:                  aws.String("public-read"), // could be private if you want it to be access by only authorized users
+		ACL:                  in.acl(),
 		Body:                 file,
 		ContentLength:        aws.Int64(in.Filesize),
 		ContentType:          aws.String(in.Filemime),
@@ -109,7 +121,7 @@ func PushS3Base64(in S3Info, base64File string) error {
 	_, err = s3.New(session).PutObject(&s3.PutObjectInput{
 		Bucket:               aws.String(in.Bucket),
 		Key:                  aws.String(in.Filename),
-		ACL:                  aws.String("public-read"), // could be private if you want it to be access by only authorized users
+		ACL:                  in.acl(),
 		Body:                 bytes.NewReader(decode),
 		ContentType:          aws.String(in.Filemime),
 		ContentDisposition:   aws.String("attachment"),
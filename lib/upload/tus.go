@@ -0,0 +1,94 @@
+package upload
+
+import (
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The tus resumable upload protocol, https://tus.io/protocols/resumable-upload
+const (
+	TusVersion = "1.0.0"
+	// TusExtensions supported by the server
+	TusExtensions = "creation,creation-with-upload,termination,expiration"
+	// TusContentType of the PATCH requests
+	TusContentType = "application/offset+octet-stream"
+
+	HeaderTusResumable  = "Tus-Resumable"
+	HeaderTusVersion    = "Tus-Version"
+	HeaderTusExtension  = "Tus-Extension"
+	HeaderTusMaxSize    = "Tus-Max-Size"
+	HeaderUploadLength  = "Upload-Length"
+	HeaderUploadOffset  = "Upload-Offset"
+	HeaderUploadMeta    = "Upload-Metadata"
+	HeaderUploadExpires = "Upload-Expires"
+	HeaderUploadDefer   = "Upload-Defer-Length"
+	// HeaderFileIdentifier of the response completing an upload, not part of the protocol
+	HeaderFileIdentifier = "Upload-File-Identifier"
+
+	// TusPendingPrefix of the objects of the bytes received after the last part of an upload,
+	// private/tus/<upload identifier>/<offset of the first byte>. They're private so the
+	// storage route never serves them.
+	TusPendingPrefix = "private/tus/"
+)
+
+// TusPendingKey the key of the pending bytes of the upload received from offset, the size of
+// its parts
+func TusPendingKey(uploadIdentifier string, offset int64) string {
+	return TusPendingPrefix + uploadIdentifier + "/" + strconv.FormatInt(offset, 10)
+}
+
+// ErrInvalidMetadata the Upload-Metadata header is malformed
+var ErrInvalidMetadata = errors.New("upload: invalid Upload-Metadata")
+
+// ParseTusMetadata the pairs of the Upload-Metadata header, comma separated keys each followed
+// by a space and its base64 value, the value can be omitted
+func ParseTusMetadata(header string) (map[string]string, error) {
+	meta := map[string]string{}
+	if len(strings.TrimSpace(header)) == 0 {
+		return meta, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, ErrInvalidMetadata
+		}
+		if _, ok := meta[fields[0]]; ok {
+			return nil, ErrInvalidMetadata
+		}
+
+		var value []byte
+		if len(fields) == 2 {
+			var err error
+			if value, err = base64.StdEncoding.DecodeString(fields[1]); err != nil {
+				return nil, ErrInvalidMetadata
+			}
+		}
+		meta[fields[0]] = string(value)
+	}
+
+	return meta, nil
+}
+
+// FormatTusMetadata the Upload-Metadata header of the pairs, sorted by key
+func FormatTusMetadata(meta map[string]string) string {
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if len(meta[k]) == 0 {
+			pairs = append(pairs, k)
+			continue
+		}
+		pairs = append(pairs, k+" "+base64.StdEncoding.EncodeToString([]byte(meta[k])))
+	}
+
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,74 @@
+package upload
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTusMetadata(t *testing.T) {
+	meta, err := ParseTusMetadata("filename d29ybGRfZG9taW5hdGlvbl9wbGFuLnBkZg==,is_confidential, filetype YXBwbGljYXRpb24vcGRm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"filename":        "world_domination_plan.pdf",
+		"is_confidential": "",
+		"filetype":        "application/pdf",
+	}
+	if len(meta) != len(want) {
+		t.Fatalf("metadata %v, want %v", meta, want)
+	}
+	for k, v := range want {
+		if got, ok := meta[k]; !ok || got != v {
+			t.Errorf("metadata %s = %q, want %q", k, got, v)
+		}
+	}
+
+	if meta, err = ParseTusMetadata("  "); err != nil || len(meta) != 0 {
+		t.Errorf("empty header: %v, %v", meta, err)
+	}
+}
+
+func TestParseTusMetadataInvalid(t *testing.T) {
+	for _, header := range []string{
+		"filename not-base64!",
+		"filename YQ== extra",
+		"filename YQ==,filename Yg==",
+		"filename YQ==,,filetype Yg==",
+	} {
+		if _, err := ParseTusMetadata(header); err != ErrInvalidMetadata {
+			t.Errorf("ParseTusMetadata(%q) = %v, want ErrInvalidMetadata", header, err)
+		}
+	}
+}
+
+func TestFormatTusMetadata(t *testing.T) {
+	meta := map[string]string{"filetype": "image/png", "filename": "a b.png", "private": ""}
+
+	header := FormatTusMetadata(meta)
+	if header != "filename YSBiLnBuZw==,filetype aW1hZ2UvcG5n,private" {
+		t.Errorf("FormatTusMetadata = %q", header)
+	}
+
+	parsed, err := ParseTusMetadata(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range meta {
+		if parsed[k] != v {
+			t.Errorf("round trip %s = %q, want %q", k, parsed[k], v)
+		}
+	}
+}
+
+func TestTusPendingKey(t *testing.T) {
+	key := TusPendingKey("UPL0123abcd", 15728640)
+	if key != "private/tus/UPL0123abcd/15728640" {
+		t.Errorf("TusPendingKey = %q", key)
+	}
+	// the pending bytes are never served by the storage route
+	if !strings.HasPrefix(key, "private/") {
+		t.Errorf("pending key %q isn't private", key)
+	}
+}
@@ -7,6 +7,14 @@ var (
 	// actor type for register and login
 	User = "user"
 
+	// role of the user, the permissions of each role are stored in role_permissions
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+
+	// sign-in provider
+	Google   = "google"
+	Facebook = "facebook"
+
 	// verification type
 	VerifyRegistration = "verify_registration"
 	ForgotPassword     = "forgot_password"
@@ -18,4 +26,15 @@ var (
 	TypeRoute        = "&type="
 
 	VerificationType = []string{VerifyRegistration, ForgotPassword, UpdateEmail}
+
+	// domain events written to the outbox, the event type is the routing key
+	EventUserRegistered    = "user.registered"
+	EventUserEmailVerified = "user.email_verified"
+	EventAddressCreated    = "address.created"
+	EventSettingUpdated    = "setting.updated"
+
+	// aggregate type of the events
+	AggregateUser    = "user"
+	AggregateAddress = "address"
+	AggregateSetting = "setting"
 )
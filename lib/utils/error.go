@@ -5,6 +5,8 @@ var (
 	EmptyData                          = "Data not found"
 	ErrNotFoundPage                    = "Sorry. We couldn't find that page"
 	ErrSystemError                     = "Something error with our system. Please contact our administrator"
+	ErrRequestTimeout                  = "The request took too long, please try again"
+	ErrRequestCanceled                 = "The request was cancelled"
 	ErrInvalidTokenChannel             = "Invalid token channel"
 	ErrConfigKeyNotFound               = "Config ['app.key'] doesn't exists"
 	ErrEmailAlreadyRegistered          = "Your email has been registered. Please change to a new email"
@@ -25,8 +27,14 @@ var (
 	ErrSendingUpdateEmail              = "Error sending email for update email"
 	ErrInvalidSendingEmailType         = "Type must be one of the following: (verify_registration | forgot_password | update_email)"
 	ErrInvalidTypeQueryParameter       = "Type query parameter is missing"
+	ErrInvalidQueryParameter           = "The query parameters are invalid"
 	ErrPasswordMismatch                = "Password does not match"
 	ErrHashingPassword                 = "Error hashing the new password"
+	ErrSessionRevoked                  = "Session has been revoked"
+	ErrRefreshTokenReused              = "Refresh token has been used, please login again"
+	ErrCreatingSession                 = "Error creating session"
+	ErrRefreshingSession               = "Error refreshing session"
+	ErrRevokingSession                 = "Error revoking session"
 	ErrInvalidTypeError                = "Incorrect error type provided for 'err' parameter. It must be an instance of 'validator.ValidationErrors' or 'error'"
 
 	// Error for module AMQP
@@ -44,6 +52,22 @@ var (
 	ErrUpdatingUserProfile            = "Error updating user profile"
 	ErrRetrievingUserByUserIdentifier = "Error retrieving user by user identifier"
 	ErrGettingUserByEmail             = "Error getting user by email"
+	ErrGettingUserIdentity            = "Error getting user identity"
+	ErrLinkingUserIdentity            = "Error linking user identity"
+	ErrSocialEmailNotVerified         = "Email is not verified by the sign-in provider"
+	ErrInvalidTwoFactorCode           = "Two-factor authentication code is invalid"
+	ErrTwoFactorAlreadyEnabled        = "Two-factor authentication is already enabled"
+	ErrTwoFactorNotEnabled            = "Two-factor authentication is not enabled"
+	ErrTwoFactorNotEnrolled           = "Two-factor authentication has not been enrolled"
+	ErrEnrollingTwoFactor             = "Error enrolling two-factor authentication"
+	ErrUpdatingTwoFactor              = "Error updating two-factor authentication"
+	ErrTwoFactorChallengeInvalidated  = "Too many invalid codes, please log in again"
+	ErrAccountLocked                  = "Too many failed logins, the account is temporarily locked"
+	ErrTooManyRequests                = "Too many requests, please try again later"
+	ErrGettingPermissions             = "Error getting role permissions"
+	ErrPermissionDenied               = "You don't have permission to access this resource"
+	ErrOldPasswordIncorrect           = "Old password is incorrect"
+	ErrInvalidSettingContentType      = "Wrong content type value for settings (json_arr|json_obj|bool|string)"
 
 	// Error for module user address
 	ErrGettingUserAddresses      = "Error getting user addresses by user ID"
@@ -62,4 +86,48 @@ var (
 	ErrGettingSettingByCode = "Error getting setting by code"
 	ErrUpdatingSetting      = "Error updating setting"
 	ErrGettingSettingByKey  = "Error getting setting by key"
+
+	// Error for module mail
+	ErrCountingListMail  = "Error counting list mail"
+	ErrGettingListMail   = "Error getting list mail"
+	ErrScanningListMail  = "Error scanning list mail"
+	ErrGettingMailByCode = "Error getting mail by code"
+	ErrGettingDeliveries = "Error getting mail deliveries"
+	ErrResendingMail     = "Error resending mail"
+	ErrMailNotResendable = "Only a failed mail can be resent"
+	ErrMailHasToken      = "The link of the mail has expired, the user has to request a new one"
+
+	// Error for module file
+	ErrInsertingFile       = "Error inserting file"
+	ErrGettingFileByCode   = "Error getting file by code"
+	ErrGettingFileByHash   = "Error getting file by hash"
+	ErrCountingListFile    = "Error counting list file"
+	ErrGettingListFile     = "Error getting list file"
+	ErrScanningListFile    = "Error scanning list file"
+	ErrDeletingFile        = "Error deleting file"
+	ErrHashingFile         = "Error hashing file"
+	ErrProcessingImage     = "The image can't be processed, upload a valid jpg, png or webp image"
+	ErrInvalidAvatarFile   = "The avatar must be a public image uploaded by the user"
+	ErrInvalidFileVariant  = "The variant doesn't exist for this file"
+	ErrInvalidVisibility   = "Visibility must be one of the following: (public | private)"
+	ErrPresignNotSupported = "The storage doesn't support presigned urls, download the file instead"
+	ErrPresigningFileURL   = "Error presigning file url"
+	ErrFileTooLarge        = "The file is larger than the maximum size"
+	ErrInvalidUploadForm   = "The upload must be a multipart form with the file field"
+
+	// Error for module resumable upload
+	ErrUnsupportedTusVersion    = "The tus version isn't supported, use 1.0.0"
+	ErrInvalidUploadLength      = "Upload-Length must be a positive number, deferred lengths aren't supported"
+	ErrInvalidUploadMetadata    = "Upload-Metadata must be comma separated keys with base64 values"
+	ErrInvalidUploadOffset      = "Upload-Offset must be a number"
+	ErrInvalidUploadContentType = "Content-Type must be application/offset+octet-stream"
+	ErrUploadOffsetMismatch     = "Upload-Offset doesn't match the offset of the upload, resume from the offset of HEAD"
+	ErrUploadLocked             = "The upload is written by another request"
+	ErrUploadExpired            = "The upload has expired, start a new upload"
+	ErrInsertingFileUpload      = "Error inserting file upload"
+	ErrGettingFileUploadByCode  = "Error getting file upload by code"
+	ErrLockingFileUpload        = "Error locking file upload"
+	ErrUpdatingFileUpload       = "Error updating file upload"
+	ErrDeletingFileUpload       = "Error deleting file upload"
+	ErrWritingFileUpload        = "Error writing the upload content"
 )
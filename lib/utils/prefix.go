@@ -9,6 +9,9 @@ import (
 const (
 	UserPrefix        = "USR"
 	UserAddressPrefix = "USRADR"
+	SessionPrefix     = "SES"
+	FilePrefix        = "FIL"
+	FileUploadPrefix  = "UPL"
 )
 
 func GeneratePrefixCode(prefix string) string {
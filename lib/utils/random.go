@@ -1,6 +1,8 @@
 package utils
 
 import (
+	crand "crypto/rand"
+	"encoding/base64"
 	"fmt"
 	"math/rand"
 	"os"
@@ -78,3 +80,13 @@ func alphabetSlice(from, to byte) string {
 func seedAndReturnRandom(n int) int {
 	return rand.Intn(n)
 }
+
+// RandomToken generate an url safe token from n bytes of crypto random data
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := crand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
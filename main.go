@@ -1,16 +1,24 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"go-skeleton/bootstrap"
+	"go-skeleton/lib/mail"
 	"go-skeleton/lib/psql"
+	"go-skeleton/lib/storage"
+	"go-skeleton/lib/tracing"
 	"go-skeleton/lib/utils"
 	"go-skeleton/services/api"
+	"go-skeleton/services/files"
+	"go-skeleton/services/migrate"
+	"go-skeleton/services/worker"
 	"log"
 	"os"
 
 	"path/filepath"
 	"runtime"
+	"time"
 
 	"github.com/urfave/cli/v2"
 )
@@ -40,9 +48,34 @@ func setup() {
 	config = utils.NewViperConfig(basepath, configFile)
 
 	debug = config.GetBool("app.debug")
+
+	// tracing is set up first, the db and redis clients are instrumented when they're created
+	if err := tracing.Setup(config); err != nil {
+		panic(err)
+	}
+
 	validator := bootstrap.SetupValidator(config)
 	cLog := bootstrap.SetupLogger(config)
 
+	// load the jwt signing and verification keys
+	jwtKeys, err := bootstrap.SetupJWTKeys(config)
+	if err != nil {
+		panic(err)
+	}
+
+	// the mail driver of mail.drive, shared by the mail contracts
+	mailer, err := mail.NewMailer(config)
+	if err != nil {
+		panic(err)
+	}
+	mail.SetDefault(mailer)
+
+	// the upload storage of storage.driver
+	store, err := storage.New(config)
+	if err != nil {
+		panic(err)
+	}
+
 	// connect to redis cache
 	rdCache, err := bootstrap.SetupRedis(
 		config.GetString("db.redis.addr"),
@@ -54,7 +87,11 @@ func setup() {
 	}
 
 	// connect to database
-	db, err := psql.Connect(config.GetString("db.psql_dsn"))
+	statementTimeout := config.GetInt("db.statement_timeout")
+	if statementTimeout < 1 {
+		statementTimeout = 15
+	}
+	db, err := psql.Connect(config.GetString("db.psql_dsn"), time.Duration(statementTimeout)*time.Second)
 	if err != nil {
 		panic(err)
 	}
@@ -66,6 +103,8 @@ func setup() {
 		Log:       cLog,
 		DB:        db,
 		Redis:     rdCache,
+		JWTKeys:   jwtKeys,
+		Storage:   store,
 	}
 }
 
@@ -75,6 +114,9 @@ func main() {
 
 	// add new service
 	app.AddService(api.Booting(app), "api", "API service")
+	app.AddService(migrate.Booting(app), "migrate", "Database migration service")
+	app.AddService(worker.Booting(app), "worker", "RabbitMQ consumer service")
+	app.AddService(files.Booting(app), "files", "Uploaded files maintenance")
 
 	cmd := &cli.App{
 		Name:     "Verein Core",
@@ -87,6 +129,18 @@ func main() {
 	}
 
 	err := cmd.Run(os.Args)
+
+	// export the spans still queued
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if tErr := tracing.Shutdown(ctx); tErr != nil {
+		log.Println("[tracing] " + tErr.Error())
+	}
+	cancel()
+	if mailer := mail.Default(); mailer != nil {
+		_ = mailer.Close()
+	}
+	app.Log.Close()
+
 	if err != nil {
 		log.Fatal(err)
 	}
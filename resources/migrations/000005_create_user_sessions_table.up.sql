@@ -0,0 +1,19 @@
+CREATE TABLE user_sessions (
+	id SERIAL PRIMARY KEY,
+	session_identifier varchar(50) NOT NULL UNIQUE,
+	user_id bigint references users (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	expired_date timestamptz(0) NOT NULL,
+	revoked_date timestamptz(0) NULL,
+	created_date timestamptz(0) NOT NULL DEFAULT NOW(),
+    updated_date timestamptz(0) NULL
+);
+
+CREATE TABLE refresh_tokens (
+	id SERIAL PRIMARY KEY,
+	session_id bigint references user_sessions (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	token_hash varchar(64) NOT NULL UNIQUE, -- sha256 of the opaque refresh token
+	is_used bool DEFAULT false,
+	expired_date timestamptz(0) NOT NULL,
+	used_date timestamptz(0) NULL,
+	created_date timestamptz(0) NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,10 @@
+CREATE TABLE user_identities (
+	id SERIAL PRIMARY KEY,
+	user_id bigint references users (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	provider varchar(20) NOT NULL, -- google||facebook
+	provider_subject varchar(255) NOT NULL, -- user id on the provider
+	email varchar(100) NULL,
+	created_date timestamptz(0) NOT NULL DEFAULT NOW(),
+    updated_date timestamptz(0) NULL,
+	UNIQUE (provider, provider_subject)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_recovery_codes;
+ALTER TABLE users DROP COLUMN IF EXISTS two_factor_secret, DROP COLUMN IF EXISTS two_factor_enabled, DROP COLUMN IF EXISTS two_factor_last_step;
\ No newline at end of file
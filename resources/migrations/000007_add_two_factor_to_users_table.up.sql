@@ -0,0 +1,12 @@
+ALTER TABLE users
+	ADD COLUMN two_factor_secret varchar(64) NULL,
+	ADD COLUMN two_factor_enabled bool NOT NULL DEFAULT false,
+	ADD COLUMN two_factor_last_step bigint NULL; -- last accepted TOTP time step, to refuse a replayed code
+
+CREATE TABLE user_recovery_codes (
+	id SERIAL PRIMARY KEY,
+	user_id bigint references users (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	code_hash varchar(64) NOT NULL, -- sha256 of the recovery code
+	used_date timestamptz(0) NULL,
+	created_date timestamptz(0) NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,30 @@
+CREATE TABLE roles (
+	id SERIAL PRIMARY KEY,
+	role_code varchar(50) NOT NULL UNIQUE,
+	role_name varchar(100) NOT NULL,
+	created_date timestamptz(0) NOT NULL DEFAULT NOW(),
+    updated_date timestamptz(0) NULL
+);
+
+CREATE TABLE permissions (
+	id SERIAL PRIMARY KEY,
+	permission_code varchar(100) NOT NULL UNIQUE, -- resource:action, e.g. settings:write
+	description varchar(255) NOT NULL DEFAULT '',
+	created_date timestamptz(0) NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE role_permissions (
+	role_id bigint references roles (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	permission_id bigint references permissions (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	PRIMARY KEY (role_id, permission_id)
+);
+
+INSERT INTO roles (role_code, role_name) VALUES ('admin', 'Administrator'), ('user', 'User');
+INSERT INTO permissions (permission_code, description) VALUES
+	('settings:read', 'Read the settings in CMS'),
+	('settings:write', 'Create and update the settings');
+INSERT INTO role_permissions (role_id, permission_id)
+	SELECT r.id, p.id FROM roles r CROSS JOIN permissions p WHERE r.role_code = 'admin';
+
+ALTER TABLE users ADD COLUMN role_id bigint NULL references roles (id) ON DELETE SET NULL ON UPDATE CASCADE;
+UPDATE users SET role_id = (SELECT id FROM roles WHERE role_code = 'user');
@@ -0,0 +1,15 @@
+CREATE TABLE outbox_events (
+	id BIGSERIAL PRIMARY KEY,
+	event_identifier varchar(64) NOT NULL UNIQUE, -- message id, the consumers dedup on it
+	event_type varchar(100) NOT NULL, -- routing key, e.g. user.registered
+	aggregate_type varchar(50) NOT NULL,
+	aggregate_identifier varchar(100) NOT NULL,
+	payload jsonb NOT NULL,
+	attempts int NOT NULL DEFAULT 0,
+	last_error text NULL,
+	available_date timestamptz(3) NOT NULL DEFAULT NOW(),
+	published_date timestamptz(3) NULL,
+	created_date timestamptz(3) NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX outbox_events_pending_idx ON outbox_events (available_date, id) WHERE published_date IS NULL;
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE permission_code IN ('mails:read', 'mails:write');
+DROP TABLE IF EXISTS mail_deliveries;
+DROP TABLE IF EXISTS mail_queue;
@@ -0,0 +1,38 @@
+CREATE TABLE mail_queue (
+	id BIGSERIAL PRIMARY KEY,
+	mail_identifier varchar(64) NOT NULL UNIQUE,
+	template varchar(100) NOT NULL,
+	recipient varchar(255) NOT NULL,
+	subject varchar(255) NOT NULL,
+	data jsonb NOT NULL DEFAULT '{}',
+	status varchar(20) NOT NULL DEFAULT 'pending', -- pending, sending, sent, failed
+	attempts int NOT NULL DEFAULT 0,
+	max_attempts int NOT NULL DEFAULT 5,
+	last_error text NULL,
+	next_attempt_date timestamptz(3) NOT NULL DEFAULT NOW(),
+	sent_date timestamptz(3) NULL,
+	created_date timestamptz(3) NOT NULL DEFAULT NOW(),
+	updated_date timestamptz(3) NULL
+);
+
+CREATE INDEX mail_queue_pending_idx ON mail_queue (next_attempt_date, id) WHERE status IN ('pending', 'sending');
+CREATE INDEX mail_queue_status_idx ON mail_queue (status, id);
+
+-- one row per delivery attempt
+CREATE TABLE mail_deliveries (
+	id BIGSERIAL PRIMARY KEY,
+	mail_id bigint NOT NULL references mail_queue (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	attempt int NOT NULL,
+	status varchar(20) NOT NULL, -- sent, failed, resend
+	error text NULL,
+	created_date timestamptz(3) NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX mail_deliveries_mail_id_idx ON mail_deliveries (mail_id, id);
+
+INSERT INTO permissions (permission_code, description) VALUES
+	('mails:read', 'List the queued mails and their deliveries'),
+	('mails:write', 'Resend the failed mails');
+INSERT INTO role_permissions (role_id, permission_id)
+	SELECT r.id, p.id FROM roles r CROSS JOIN permissions p
+	WHERE r.role_code = 'admin' AND p.permission_code IN ('mails:read', 'mails:write');
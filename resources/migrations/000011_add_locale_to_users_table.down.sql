@@ -0,0 +1,2 @@
+ALTER TABLE mail_queue DROP COLUMN IF EXISTS locale;
+ALTER TABLE users DROP COLUMN IF EXISTS locale;
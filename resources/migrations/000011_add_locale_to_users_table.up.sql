@@ -0,0 +1,5 @@
+ALTER TABLE users
+	ADD COLUMN locale varchar(10) NULL; -- preferred language of the mails (en, id), app.locale when empty
+
+ALTER TABLE mail_queue
+	ADD COLUMN locale varchar(10) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE permission_code IN ('files:read');
+DROP TABLE IF EXISTS files;
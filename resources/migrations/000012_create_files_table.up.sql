@@ -0,0 +1,20 @@
+CREATE TABLE files (
+	id BIGSERIAL PRIMARY KEY,
+	file_identifier varchar(50) NOT NULL UNIQUE,
+	user_id int NOT NULL references users (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	storage_key varchar(500) NOT NULL,
+	original_name varchar(255) NOT NULL DEFAULT '',
+	mime_type varchar(100) NOT NULL DEFAULT '',
+	size bigint NOT NULL DEFAULT 0,
+	visibility varchar(10) NOT NULL DEFAULT 'public', -- public, private
+	created_date timestamptz(3) NOT NULL DEFAULT NOW(),
+	deleted_date timestamptz(3) NULL
+);
+
+CREATE INDEX files_user_id_idx ON files (user_id, id);
+
+INSERT INTO permissions (permission_code, description) VALUES
+	('files:read', 'Download the private files of every user');
+INSERT INTO role_permissions (role_id, permission_id)
+	SELECT r.id, p.id FROM roles r CROSS JOIN permissions p
+	WHERE r.role_code = 'admin' AND p.permission_code IN ('files:read');
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS files_deleted_date_idx;
+DROP INDEX IF EXISTS files_storage_key_idx;
+DROP INDEX IF EXISTS files_user_sha256_idx;
+ALTER TABLE files DROP COLUMN IF EXISTS sha256;
@@ -0,0 +1,7 @@
+ALTER TABLE files
+	ADD COLUMN sha256 varchar(64) NOT NULL DEFAULT ''; -- hex sha-256 of the content
+
+-- an owner has a single live file of a content and visibility
+CREATE UNIQUE INDEX files_user_sha256_idx ON files (user_id, sha256, visibility) WHERE deleted_date IS NULL AND sha256 <> '';
+CREATE INDEX files_storage_key_idx ON files (storage_key);
+CREATE INDEX files_deleted_date_idx ON files (deleted_date) WHERE deleted_date IS NOT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE users DROP COLUMN IF EXISTS avatar_file_id;
+ALTER TABLE files DROP COLUMN IF EXISTS variants;
+ALTER TABLE files DROP COLUMN IF EXISTS height;
+ALTER TABLE files DROP COLUMN IF EXISTS width;
@@ -0,0 +1,11 @@
+ALTER TABLE files
+	ADD COLUMN width int NULL; -- of the images
+
+ALTER TABLE files
+	ADD COLUMN height int NULL;
+
+ALTER TABLE files
+	ADD COLUMN variants jsonb NOT NULL DEFAULT '[]'; -- thumbnails of the images [{size, key, width, height, content_type}]
+
+ALTER TABLE users
+	ADD COLUMN avatar_file_id bigint NULL references files (id) ON DELETE SET NULL ON UPDATE CASCADE;
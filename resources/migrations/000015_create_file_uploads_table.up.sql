@@ -0,0 +1,22 @@
+CREATE TABLE file_uploads (
+	id BIGSERIAL PRIMARY KEY,
+	upload_identifier varchar(50) NOT NULL UNIQUE,
+	user_id int NOT NULL references users (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	storage_key varchar(500) NOT NULL, -- key of the object once completed
+	original_name varchar(255) NOT NULL DEFAULT '',
+	mime_type varchar(100) NOT NULL DEFAULT '', -- detected from the first bytes
+	visibility varchar(10) NOT NULL DEFAULT 'public',
+	upload_length bigint NOT NULL,
+	upload_offset bigint NOT NULL DEFAULT 0,
+	multipart_id varchar(1024) NOT NULL DEFAULT '', -- multipart upload of the storage, empty until the first part
+	parts jsonb NOT NULL DEFAULT '[]', -- uploaded parts [{number, etag, size}]
+	pending_key varchar(500) NOT NULL DEFAULT '', -- object of the bytes received after the last part
+	pending_size bigint NOT NULL DEFAULT 0,
+	hash_state bytea NULL, -- sha-256 state of the bytes up to the offset
+	locked_until timestamptz(3) NULL, -- a request is writing the upload
+	expires_date timestamptz(3) NOT NULL,
+	created_date timestamptz(3) NOT NULL DEFAULT NOW(),
+	updated_date timestamptz(3) NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX file_uploads_expires_date_idx ON file_uploads (expires_date);
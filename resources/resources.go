@@ -0,0 +1,9 @@
+// Package resources the files embedded in the binary
+package resources
+
+import "embed"
+
+// Templates the mail templates of templates/, see lib/mail
+//
+//go:embed templates
+var Templates embed.FS
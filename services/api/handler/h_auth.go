@@ -1,8 +1,11 @@
 package handler
 
 import (
-	"context"
 	"go-skeleton/bootstrap"
+	"go-skeleton/lib/apperr"
+	"go-skeleton/lib/facebook"
+	"go-skeleton/lib/google"
+	"go-skeleton/lib/mail"
 	"go-skeleton/lib/utils"
 	"go-skeleton/services/api/model"
 	"go-skeleton/services/api/request"
@@ -14,10 +17,9 @@ import (
 func (h *Contract) LoginUserAct(w http.ResponseWriter, r *http.Request) {
 	var (
 		err error
-		ctx = context.TODO()
+		ctx = r.Context()
 		m   = model.Contract{App: h.App}
 		req = request.LoginUserReq{}
-		res = response.LoginUserRes{}
 	)
 
 	// Bind and validate
@@ -26,33 +28,24 @@ func (h *Contract) LoginUserAct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dataUser, expAtUnix, jwtToken, err := m.UserLogin(h.DB, ctx, req.Email, req.Password)
+	dataUser, token, err := m.UserLogin(h.DB, ctx, req.Email, req.Password)
 	if err != nil {
-		h.SendBadRequest(w, err.Error())
+		if apperr.HasCode(err, apperr.CodeAccountLocked) {
+			h.SendTooManyRequests(w, err.Error(), m.LoginLockTTL(ctx, req.Email))
+			return
+		}
+		h.SendError(w, err)
 		return
 	}
 
-	// convert unix timestamp
-	expAt := time.Unix(expAtUnix, 0)
-	res = response.LoginUserRes{
-		Token:          jwtToken,
-		AvatarURL:      dataUser.AvatarURL.String,
-		UserIdentifier: dataUser.UserIdentifier,
-		FirstName:      dataUser.FirstName,
-		LastName:       dataUser.LastName.String,
-		Email:          dataUser.Email,
-		ExpiredAt:      expAt.Format(utils.DATE_TIME_FORMAT),
-		ActorType:      utils.User,
-		CreatedDate:    time.Now().In(time.UTC).Format(utils.DATE_TIME_FORMAT),
-	}
 	// Populate Response
-	h.SendSuccess(w, res, nil)
+	h.sendLogin(w, dataUser, token)
 }
 
 func (h *Contract) RegisterUserAct(w http.ResponseWriter, r *http.Request) {
 	var (
 		err error
-		ctx = context.TODO()
+		ctx = r.Context()
 		m   = model.Contract{App: h.App}
 		req = request.RegisterUserReq{}
 		res = response.RegisterUserRes{}
@@ -70,15 +63,21 @@ func (h *Contract) RegisterUserAct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userIdentifier, email, err := m.RegisterUser(h.DB, ctx, req.FirstName, req.LastName, req.Email, req.ConfirmPassword)
+	// the language of the mails, from the request or the Accept-Language of the client
+	locale := req.Locale
+	if len(locale) == 0 {
+		locale = mail.ParseLocale(r.Header.Get("Accept-Language"))
+	}
+
+	userIdentifier, email, err := m.RegisterUser(h.DB, ctx, req.FirstName, req.LastName, req.Email, req.ConfirmPassword, locale)
 	if err != nil {
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, err)
 		return
 	}
 
 	err = m.RequestVerifyEmailUser(h.DB, ctx, req.Email, utils.VerifyRegistration)
 	if err != nil {
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, err)
 		return
 	}
 
@@ -96,7 +95,7 @@ func (h *Contract) RequestVerifyEmailUserAct(w http.ResponseWriter, r *http.Requ
 	var (
 		err   error
 		check bool
-		ctx   = context.TODO()
+		ctx   = r.Context()
 		m     = model.Contract{App: h.App}
 		req   = request.RequestVerifyEmailReq{}
 	)
@@ -114,7 +113,7 @@ func (h *Contract) RequestVerifyEmailUserAct(w http.ResponseWriter, r *http.Requ
 
 	err = m.RequestVerifyEmailUser(h.DB, ctx, req.Email, req.Type)
 	if err != nil {
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, err)
 		return
 	}
 
@@ -124,14 +123,11 @@ func (h *Contract) RequestVerifyEmailUserAct(w http.ResponseWriter, r *http.Requ
 
 func (h *Contract) VerifyTokenUserAct(w http.ResponseWriter, r *http.Request) {
 	var (
-		err       error
-		ctx       = context.TODO()
-		m         = model.Contract{App: h.App}
-		jwtToken  string
-		expAt     time.Time
-		expAtUnix int64
-		dataUser  model.UserEnt
-		res       = response.LoginUserRes{}
+		err      error
+		ctx      = r.Context()
+		m        = model.Contract{App: h.App}
+		token    model.TokenEnt
+		dataUser model.UserEnt
 
 		// Initiate Query Param
 		param = map[string]interface{}{
@@ -156,35 +152,20 @@ func (h *Contract) VerifyTokenUserAct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dataUser, expAtUnix, jwtToken, err = m.CheckTokenAndExpiration(h.DB, ctx, param["type"].(string), utils.User, param["token"].(string))
+	dataUser, token, err = m.CheckTokenAndExpiration(h.DB, ctx, param["type"].(string), utils.User, param["token"].(string))
 	if err != nil {
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, err)
 		return
 	}
 
-	//convert unix timestamp
-	expAt = time.Unix(expAtUnix, 0)
-
 	// Populate response
-	res = response.LoginUserRes{
-		Token:          jwtToken,
-		AvatarURL:      dataUser.AvatarURL.String,
-		UserIdentifier: dataUser.UserIdentifier,
-		FirstName:      dataUser.FirstName,
-		LastName:       dataUser.LastName.String,
-		Email:          dataUser.Email,
-		ExpiredAt:      expAt.Format(utils.DATE_TIME_FORMAT),
-		ActorType:      utils.User,
-		CreatedDate:    time.Now().In(time.UTC).Format(utils.DATE_TIME_FORMAT),
-	}
-
-	h.SendSuccess(w, res, nil)
+	h.sendLogin(w, dataUser, token)
 }
 
 func (h *Contract) ResetPasswordUserAct(w http.ResponseWriter, r *http.Request) {
 	var (
 		err            error
-		ctx            = context.TODO()
+		ctx            = r.Context()
 		userIdentifier = bootstrap.GetUserIdentifierFromToken(ctx, r)
 		m              = model.Contract{App: h.App}
 		req            = request.ResetPasswordReq{}
@@ -196,12 +177,192 @@ func (h *Contract) ResetPasswordUserAct(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = m.ResetPassword(h.DB, ctx, userIdentifier, req.NewPassword, req.ConfirmPassword)
+	err = m.ResetPassword(h.DB, ctx, userIdentifier, h.GetSessionIdentifier(ctx), req.NewPassword, req.ConfirmPassword)
+	if err != nil {
+		h.SendError(w, err)
+		return
+	}
+
+	// Populate response
+	h.SendSuccess(w, nil, nil)
+}
+
+func (h *Contract) RefreshTokenUserAct(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+		ctx = r.Context()
+		m   = model.Contract{App: h.App}
+		req = request.RefreshTokenReq{}
+		res = response.LoginUserRes{}
+	)
+
+	// Bind and validate
+	if err = h.BindAndValidate(r, &req); err != nil {
+		h.SendBindAndValidateError(w, err)
+		return
+	}
+
+	dataUser, token, err := m.RefreshSession(h.DB, ctx, req.RefreshToken)
+	if err != nil {
+		h.SendError(w, err)
+		return
+	}
+
+	// Populate response
+	res = loginResponse(dataUser, token)
+	h.SendSuccess(w, res, nil)
+}
+
+func (h *Contract) LogoutUserAct(w http.ResponseWriter, r *http.Request) {
+	var (
+		err               error
+		ctx               = r.Context()
+		m                 = model.Contract{App: h.App}
+		sessionIdentifier = h.GetSessionIdentifier(r.Context())
+	)
+
+	err = m.RevokeSession(h.DB, ctx, sessionIdentifier)
 	if err != nil {
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, err)
 		return
 	}
 
 	// Populate response
 	h.SendSuccess(w, nil, nil)
 }
+
+func (h *Contract) GoogleLoginUserAct(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+		ctx = r.Context()
+		m   = model.Contract{App: h.App}
+		req = request.SocialLoginReq{}
+	)
+
+	// Bind and validate
+	if err = h.BindAndValidate(r, &req); err != nil {
+		h.SendBindAndValidateError(w, err)
+		return
+	}
+
+	profile, err := google.New(h.App).Verify(ctx, req.Token)
+	if err != nil {
+		h.SendError(w, err)
+		return
+	}
+
+	dataUser, token, err := m.SocialLogin(h.DB, ctx, model.SocialProfile{
+		Provider:      utils.Google,
+		Subject:       profile.Sub,
+		Email:         profile.Email,
+		EmailVerified: profile.EmailVerified == "true",
+		FirstName:     profile.GivenName,
+		LastName:      profile.FamilyName,
+		AvatarURL:     profile.Picture,
+	})
+	if err != nil {
+		h.SendError(w, err)
+		return
+	}
+
+	// Populate response
+	h.sendLogin(w, dataUser, token)
+}
+
+func (h *Contract) FacebookLoginUserAct(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+		ctx = r.Context()
+		m   = model.Contract{App: h.App}
+		req = request.SocialLoginReq{}
+	)
+
+	// Bind and validate
+	if err = h.BindAndValidate(r, &req); err != nil {
+		h.SendBindAndValidateError(w, err)
+		return
+	}
+
+	profile, err := facebook.New(h.App).Verify(ctx, req.Token)
+	if err != nil {
+		h.SendError(w, err)
+		return
+	}
+
+	// facebook has no verified flag of the email, so it's never linked to an existing account
+	dataUser, token, err := m.SocialLogin(h.DB, ctx, model.SocialProfile{
+		Provider:      utils.Facebook,
+		Subject:       profile.ID,
+		Email:         profile.Email,
+		EmailVerified: false,
+		FirstName:     profile.FirstName,
+		LastName:      profile.LastName,
+	})
+	if err != nil {
+		h.SendError(w, err)
+		return
+	}
+
+	// Populate response
+	h.sendLogin(w, dataUser, token)
+}
+
+func (h *Contract) VerifyTwoFactorUserAct(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+		ctx = r.Context()
+		m   = model.Contract{App: h.App}
+		req = request.TwoFactorVerifyReq{}
+		res = response.LoginUserRes{}
+	)
+
+	// Bind and validate
+	if err = h.BindAndValidate(r, &req); err != nil {
+		h.SendBindAndValidateError(w, err)
+		return
+	}
+
+	dataUser, token, err := m.VerifyTwoFactorLogin(h.DB, ctx, req.ChallengeToken, req.Code)
+	if err != nil {
+		h.SendError(w, err)
+		return
+	}
+
+	// Populate response
+	res = loginResponse(dataUser, token)
+	h.SendSuccess(w, res, nil)
+}
+
+// sendLogin send the session tokens, or the challenge token when the user has to pass the 2FA step
+func (h *Contract) sendLogin(w http.ResponseWriter, dataUser model.UserEnt, token model.TokenEnt) {
+	if len(token.ChallengeToken) > 0 {
+		h.SendSuccess(w, response.TwoFactorChallengeRes{
+			TwoFactorRequired: true,
+			ChallengeToken:    token.ChallengeToken,
+			ExpiredAt:         time.Unix(token.ExpiredAt, 0).In(time.UTC).Format(utils.DATE_TIME_FORMAT),
+		}, nil)
+		return
+	}
+
+	h.SendSuccess(w, loginResponse(dataUser, token), nil)
+}
+
+// loginResponse populate the login response from user data and its session token
+func loginResponse(dataUser model.UserEnt, token model.TokenEnt) response.LoginUserRes {
+	// convert unix timestamp
+	expAt := time.Unix(token.ExpiredAt, 0).In(time.UTC)
+
+	return response.LoginUserRes{
+		Token:            token.AccessToken,
+		RefreshToken:     token.RefreshToken,
+		AvatarURL:        dataUser.AvatarURL.String,
+		UserIdentifier:   dataUser.UserIdentifier,
+		FirstName:        dataUser.FirstName,
+		LastName:         dataUser.LastName.String,
+		Email:            dataUser.Email,
+		ExpiredAt:        expAt.Format(utils.DATE_TIME_FORMAT),
+		RefreshExpiredAt: token.RefreshExpiredAt.Format(utils.DATE_TIME_FORMAT),
+		ActorType:        utils.User,
+		CreatedDate:      time.Now().In(time.UTC).Format(utils.DATE_TIME_FORMAT),
+	}
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"go-skeleton/lib/apperr"
+	"go-skeleton/lib/utils"
+	"go-skeleton/services/api/model"
+	"go-skeleton/services/api/request"
+	"go-skeleton/services/api/response"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetMailListAct ...
+func (h *Contract) GetMailListAct(w http.ResponseWriter, r *http.Request) {
+	var (
+		err   error
+		ctx   = r.Context()
+		m     = model.Contract{App: h.App}
+		res   = make([]response.MailRes, 0)
+		param = request.MailParam{}
+	)
+
+	// Define urlQuery and Parse
+	err = param.ParseMail(r.URL.Query())
+	if err != nil {
+		h.SendError(w, apperr.Wrap(err, apperr.Validation, apperr.CodeBadRequest, utils.ErrInvalidQueryParameter))
+		return
+	}
+
+	data, err := m.GetMails(h.DB, ctx, &param)
+	if err != nil {
+		// if empty data still success response
+		if apperr.IsKind(err, apperr.NotFound) {
+			h.SendEmptyDataSuccess(w, res, param)
+			return
+		}
+
+		h.SendError(w, err)
+		return
+	}
+
+	// Populate response
+	for _, v := range data {
+		res = append(res, mailRes(v))
+	}
+
+	h.SendSuccess(w, res, param)
+}
+
+// GetMailDetailAct ...
+func (h *Contract) GetMailDetailAct(w http.ResponseWriter, r *http.Request) {
+	var (
+		err      error
+		mailCode = chi.URLParam(r, "code")
+		ctx      = r.Context()
+		m        = model.Contract{App: h.App}
+		res      = response.MailDetailRes{Deliveries: make([]response.MailDeliveryRes, 0)}
+	)
+
+	data, err := m.GetMailByCode(h.DB, ctx, mailCode)
+	if err != nil {
+		// if empty data still success response
+		if apperr.IsKind(err, apperr.NotFound) {
+			h.SendEmptyDataSuccess(w, res, nil)
+			return
+		}
+
+		h.SendError(w, err)
+		return
+	}
+
+	deliveries, err := m.GetMailDeliveries(h.DB, ctx, data.Id)
+	if err != nil {
+		h.SendError(w, err)
+		return
+	}
+
+	// Populate response
+	res.MailRes = mailRes(data)
+	for _, v := range deliveries {
+		res.Deliveries = append(res.Deliveries, response.MailDeliveryRes{
+			Attempt:     v.Attempt,
+			Status:      v.Status,
+			Error:       v.Error.String,
+			CreatedDate: v.CreatedDate,
+		})
+	}
+
+	h.SendSuccess(w, res, nil)
+}
+
+// ResendMailAct queue a sent or failed mail again
+func (h *Contract) ResendMailAct(w http.ResponseWriter, r *http.Request) {
+	var (
+		err      error
+		mailCode = chi.URLParam(r, "code")
+		ctx      = r.Context()
+		m        = model.Contract{App: h.App}
+	)
+
+	err = m.ResendMail(h.DB, ctx, mailCode)
+	if err != nil {
+		h.SendError(w, err)
+		return
+	}
+
+	h.SendSuccess(w, nil, nil)
+}
+
+func mailRes(v model.MailEnt) response.MailRes {
+	res := response.MailRes{
+		MailIdentifier:  v.MailIdentifier,
+		Template:        v.Template,
+		Locale:          v.Locale,
+		Recipient:       v.Recipient,
+		Subject:         v.Subject,
+		Status:          v.Status,
+		Attempts:        v.Attempts,
+		MaxAttempts:     v.MaxAttempts,
+		LastError:       v.LastError.String,
+		NextAttemptDate: v.NextAttemptDate,
+		CreatedDate:     v.CreatedDate,
+	}
+	if v.SentDate.Valid {
+		res.SentDate = &v.SentDate.Time
+	}
+
+	return res
+}
@@ -1,7 +1,7 @@
 package handler
 
 import (
-	"context"
+	"go-skeleton/lib/apperr"
 	"go-skeleton/lib/utils"
 	"go-skeleton/services/api/model"
 	"go-skeleton/services/api/request"
@@ -17,7 +17,7 @@ import (
 func (h *Contract) GetSettingListAct(w http.ResponseWriter, r *http.Request) {
 	var (
 		err   error
-		ctx   = context.TODO()
+		ctx   = r.Context()
 		m     = model.Contract{App: h.App}
 		res   = make([]response.SettingRes, 0)
 		param = request.SettingParam{}
@@ -26,19 +26,19 @@ func (h *Contract) GetSettingListAct(w http.ResponseWriter, r *http.Request) {
 	// Define urlQuery and Parse
 	err = param.ParseSetting(r.URL.Query())
 	if err != nil {
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, apperr.Wrap(err, apperr.Validation, apperr.CodeBadRequest, utils.ErrInvalidQueryParameter))
 		return
 	}
 
 	data, err := m.GetSetting(h.DB, ctx, param)
 	if err != nil {
 		// if empty data still success response
-		if err.Error() == utils.EmptyData {
+		if apperr.IsKind(err, apperr.NotFound) {
 			h.SendEmptyDataSuccess(w, res, param)
 			return
 		}
 
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, err)
 		return
 	}
 
@@ -64,7 +64,7 @@ func (h *Contract) AddSettingAct(w http.ResponseWriter, r *http.Request) {
 	var (
 		err error
 		req = request.SettingReq{}
-		ctx = context.TODO()
+		ctx = r.Context()
 		m   = model.Contract{App: h.App}
 	)
 
@@ -79,7 +79,7 @@ func (h *Contract) AddSettingAct(w http.ResponseWriter, r *http.Request) {
 	settingCode, _ := utils.Generate(`SET-[a-z0-9]{20}`)
 	err = m.AddSetting(h.DB, ctx, settingCode, req.SetGroup, req.SetLabel, req.SetOrder, req.ContentType, req.ContentValue, req.IsActive)
 	if err != nil {
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, err)
 		return
 	}
 
@@ -92,7 +92,7 @@ func (h *Contract) GetSettingDetailAct(w http.ResponseWriter, r *http.Request) {
 	var (
 		err         error
 		settingCode = chi.URLParam(r, "code")
-		ctx         = context.TODO()
+		ctx         = r.Context()
 		m           = model.Contract{App: h.App}
 		res         = response.SettingRes{}
 	)
@@ -100,10 +100,12 @@ func (h *Contract) GetSettingDetailAct(w http.ResponseWriter, r *http.Request) {
 	data, err := m.GetSettingByCode(h.DB, ctx, settingCode)
 	if err != nil {
 		// if empty data still success response
-		if err.Error() == utils.EmptyData {
+		if apperr.IsKind(err, apperr.NotFound) {
 			h.SendEmptyDataSuccess(w, res, nil)
 			return
 		}
+
+		h.SendError(w, err)
 		return
 	}
 	// Populate response
@@ -129,7 +131,7 @@ func (h *Contract) UpdateSettingAct(w http.ResponseWriter, r *http.Request) {
 		err         error
 		req         = request.SettingReq{}
 		settingCode = chi.URLParam(r, "code")
-		ctx         = context.TODO()
+		ctx         = r.Context()
 		m           = model.Contract{App: h.App}
 	)
 
@@ -141,7 +143,7 @@ func (h *Contract) UpdateSettingAct(w http.ResponseWriter, r *http.Request) {
 
 	err = m.UpdateSetting(h.DB, ctx, settingCode, req.SetLabel, req.SetOrder, req.ContentValue, req.IsActive)
 	if err != nil {
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, err)
 		return
 	}
 
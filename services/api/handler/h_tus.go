@@ -0,0 +1,718 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"go-skeleton/bootstrap"
+	"go-skeleton/lib/apperr"
+	"go-skeleton/lib/imaging"
+	"go-skeleton/lib/storage"
+	"go-skeleton/lib/upload"
+	"go-skeleton/lib/utils"
+	"go-skeleton/services/api/model"
+	"hash"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// defaults of the resumable uploads when upload.tus.* is empty
+const (
+	defaultTusMaxSize  = 1024 // MB
+	defaultTusPartSize = 8    // MB
+	defaultTusExpiry   = 24 * time.Hour
+)
+
+// pendingSaveTimeout of the save of the bytes received by a request that failed, the
+// request context can be done already
+const pendingSaveTimeout = 30 * time.Second
+
+// tusStatus the statuses of the tus protocol, the other errors have the status of their kind
+var tusStatus = map[string]int{
+	apperr.CodeUnsupportedTusVersion: http.StatusPreconditionFailed,
+	apperr.CodeInvalidContentType:    http.StatusUnsupportedMediaType,
+	apperr.CodeUploadOffsetMismatch:  http.StatusConflict,
+	apperr.CodeUploadLocked:          http.StatusLocked,
+	apperr.CodeUploadExpired:         http.StatusGone,
+	apperr.CodeFileTooLarge:          http.StatusRequestEntityTooLarge,
+}
+
+// tusOptions of upload.tus.{max_size, part_size, expiry_hours}
+type tusOptions struct {
+	// MaxSize of an upload in bytes
+	MaxSize int64
+	// PartSize of the parts sent to the storage, the bytes after the last part are kept in
+	// a pending object until the next request
+	PartSize int64
+	// Expiry of an upload after its last progress
+	Expiry time.Duration
+}
+
+func (h *Contract) tusOptions() tusOptions {
+	opts := tusOptions{
+		MaxSize:  defaultTusMaxSize * upload.MB,
+		PartSize: defaultTusPartSize * upload.MB,
+		Expiry:   defaultTusExpiry,
+	}
+	if size := h.Config.GetInt("upload.tus.max_size"); size > 0 {
+		opts.MaxSize = int64(size) * upload.MB
+	}
+	if size := h.Config.GetInt("upload.tus.part_size"); size > 0 {
+		opts.PartSize = int64(size) * upload.MB
+	}
+	if opts.PartSize < storage.MinPartSize {
+		opts.PartSize = storage.MinPartSize
+	}
+	if hours := h.Config.GetInt("upload.tus.expiry_hours"); hours > 0 {
+		opts.Expiry = time.Duration(hours) * time.Hour
+	}
+
+	return opts
+}
+
+// TusOptionsAct the tus version, extensions and maximum size of the server
+func (h *Contract) TusOptionsAct(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(upload.HeaderTusResumable, upload.TusVersion)
+	w.Header().Set(upload.HeaderTusVersion, upload.TusVersion)
+	w.Header().Set(upload.HeaderTusExtension, upload.TusExtensions)
+	w.Header().Set(upload.HeaderTusMaxSize, strconv.FormatInt(h.tusOptions().MaxSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TusCreateAct start a resumable upload of Upload-Length bytes, the Upload-Metadata keys are
+// filename (or name) and visibility. The content can be sent with the request
+// (creation-with-upload), then with PATCH requests to the Location of the upload.
+func (h *Contract) TusCreateAct(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx            = r.Context()
+		m              = model.Contract{App: h.App}
+		opts           = h.tusOptions()
+		userIdentifier = bootstrap.GetUserIdentifierFromToken(ctx, r)
+	)
+	if !h.tusPrecondition(w, r) {
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get(upload.HeaderUploadLength), 10, 64)
+	if err != nil || length <= 0 || len(r.Header.Get(upload.HeaderUploadDefer)) > 0 {
+		h.SendBadRequest(w, utils.ErrInvalidUploadLength)
+		return
+	}
+	if length > opts.MaxSize {
+		h.sendTusError(w, apperr.New(apperr.Validation, apperr.CodeFileTooLarge, utils.ErrFileTooLarge))
+		return
+	}
+
+	meta, err := upload.ParseTusMetadata(r.Header.Get(upload.HeaderUploadMeta))
+	if err != nil {
+		h.SendBadRequest(w, utils.ErrInvalidUploadMetadata)
+		return
+	}
+	filename := meta["filename"]
+	if len(filename) == 0 {
+		filename = meta["name"]
+	}
+	visibility, ok := h.uploadVisibility(meta["visibility"])
+	if !ok {
+		h.SendBadRequest(w, utils.ErrInvalidVisibility)
+		return
+	}
+
+	data, err := m.InsertFileUpload(h.DB, ctx, userIdentifier, model.FileUploadEnt{
+		// the extension is added once the type is detected from the content
+		StorageKey:   uploadKeyBase(visibility),
+		OriginalName: filename,
+		Visibility:   visibility,
+		Length:       length,
+		ExpiresDate:  time.Now().UTC().Add(opts.Expiry),
+	})
+	if err != nil {
+		h.SendError(w, err)
+		return
+	}
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+data.UploadIdentifier)
+
+	if r.Header.Get("Content-Type") == upload.TusContentType && r.ContentLength != 0 {
+		if err = m.LockFileUpload(h.DB, ctx, data.Id, lockUntil(ctx)); err != nil {
+			h.sendTusError(w, err)
+			return
+		}
+		defer m.UnlockFileUpload(h.DB, context.Background(), data.Id)
+
+		var file *model.FileEnt
+		data, file, err = h.writeUpload(ctx, r, data, opts)
+		if err != nil {
+			h.sendTusError(w, err)
+			return
+		}
+		if file != nil {
+			w.Header().Set(upload.HeaderFileIdentifier, file.FileIdentifier)
+		}
+	}
+
+	w.Header().Set(upload.HeaderUploadOffset, strconv.FormatInt(data.Offset, 10))
+	w.Header().Set(upload.HeaderUploadExpires, data.ExpiresDate.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// TusHeadAct the offset to resume the upload from
+func (h *Contract) TusHeadAct(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx            = r.Context()
+		m              = model.Contract{App: h.App}
+		uploadCode     = chi.URLParam(r, "code")
+		userIdentifier = bootstrap.GetUserIdentifierFromToken(ctx, r)
+	)
+	if !h.tusPrecondition(w, r) {
+		return
+	}
+
+	data, err := m.GetFileUploadByCode(h.DB, ctx, userIdentifier, uploadCode)
+	if err != nil {
+		h.sendTusError(w, err)
+		return
+	}
+	if time.Now().After(data.ExpiresDate) {
+		h.sendTusError(w, apperr.New(apperr.NotFound, apperr.CodeUploadExpired, utils.ErrUploadExpired))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set(upload.HeaderUploadOffset, strconv.FormatInt(data.Offset, 10))
+	w.Header().Set(upload.HeaderUploadLength, strconv.FormatInt(data.Length, 10))
+	w.Header().Set(upload.HeaderUploadExpires, data.ExpiresDate.Format(http.TimeFormat))
+	w.Header().Set(upload.HeaderUploadMeta, upload.FormatTusMetadata(map[string]string{
+		"filename":   data.OriginalName,
+		"visibility": data.Visibility,
+	}))
+	w.WriteHeader(http.StatusOK)
+}
+
+// TusPatchAct append the content to the upload at Upload-Offset, the file is recorded when
+// the last byte is received and its identifier is given in the Upload-File-Identifier header
+func (h *Contract) TusPatchAct(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx            = r.Context()
+		m              = model.Contract{App: h.App}
+		uploadCode     = chi.URLParam(r, "code")
+		userIdentifier = bootstrap.GetUserIdentifierFromToken(ctx, r)
+	)
+	if !h.tusPrecondition(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != upload.TusContentType {
+		h.sendTusError(w, apperr.New(apperr.Validation, apperr.CodeInvalidContentType, utils.ErrInvalidUploadContentType))
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get(upload.HeaderUploadOffset), 10, 64)
+	if err != nil || offset < 0 {
+		h.SendBadRequest(w, utils.ErrInvalidUploadOffset)
+		return
+	}
+
+	data, err := m.GetFileUploadByCode(h.DB, ctx, userIdentifier, uploadCode)
+	if err != nil {
+		h.sendTusError(w, err)
+		return
+	}
+	if time.Now().After(data.ExpiresDate) {
+		h.sendTusError(w, apperr.New(apperr.NotFound, apperr.CodeUploadExpired, utils.ErrUploadExpired))
+		return
+	}
+
+	if err = m.LockFileUpload(h.DB, ctx, data.Id, lockUntil(ctx)); err != nil {
+		h.sendTusError(w, err)
+		return
+	}
+	defer m.UnlockFileUpload(h.DB, context.Background(), data.Id)
+
+	// the offset saved by the request that held the lock before
+	data, err = m.GetFileUploadByCode(h.DB, ctx, userIdentifier, uploadCode)
+	if err != nil {
+		h.sendTusError(w, err)
+		return
+	}
+	if offset != data.Offset {
+		h.sendTusError(w, apperr.New(apperr.Conflict, apperr.CodeUploadOffsetMismatch, utils.ErrUploadOffsetMismatch))
+		return
+	}
+
+	data, file, err := h.writeUpload(ctx, r, data, h.tusOptions())
+	if err != nil {
+		h.sendTusError(w, err)
+		return
+	}
+	if file != nil {
+		w.Header().Set(upload.HeaderFileIdentifier, file.FileIdentifier)
+	}
+
+	w.Header().Set(upload.HeaderUploadOffset, strconv.FormatInt(data.Offset, 10))
+	w.Header().Set(upload.HeaderUploadExpires, data.ExpiresDate.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TusDeleteAct terminate the upload, its parts are discarded
+func (h *Contract) TusDeleteAct(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx            = r.Context()
+		m              = model.Contract{App: h.App}
+		uploadCode     = chi.URLParam(r, "code")
+		userIdentifier = bootstrap.GetUserIdentifierFromToken(ctx, r)
+	)
+	if !h.tusPrecondition(w, r) {
+		return
+	}
+
+	data, err := m.GetFileUploadByCode(h.DB, ctx, userIdentifier, uploadCode)
+	if err != nil {
+		h.sendTusError(w, err)
+		return
+	}
+	if err = m.LockFileUpload(h.DB, ctx, data.Id, lockUntil(ctx)); err != nil {
+		h.sendTusError(w, err)
+		return
+	}
+
+	if err = h.tusWriter(h.tusOptions()).discard(ctx, data); err != nil {
+		_ = m.UnlockFileUpload(h.DB, context.Background(), data.Id)
+		h.sendTusError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tusPrecondition set the Tus-Resumable header of the response, false when the request isn't
+// of the supported version and the error is sent
+func (h *Contract) tusPrecondition(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set(upload.HeaderTusResumable, upload.TusVersion)
+	if r.Header.Get(upload.HeaderTusResumable) == upload.TusVersion {
+		return true
+	}
+
+	w.Header().Set(upload.HeaderTusVersion, upload.TusVersion)
+	h.sendTusError(w, apperr.New(apperr.Validation, apperr.CodeUnsupportedTusVersion, utils.ErrUnsupportedTusVersion))
+
+	return false
+}
+
+// sendTusError send the error with its tus status
+func (h *Contract) sendTusError(w http.ResponseWriter, err error) {
+	if appErr, ok := apperr.As(err); ok {
+		if status, ok := tusStatus[appErr.Code]; ok {
+			h.RespondWithJSON(w, status, "ERR:"+appErr.Code, appErr.Message, h.EmptyJSONArr(), h.EmptyJSONArr())
+			return
+		}
+	}
+
+	h.SendError(w, err)
+}
+
+// lockUntil the end of the lock of a request writing an upload, after its timeout
+func lockUntil(ctx context.Context) time.Time {
+	if deadline, ok := ctx.Deadline(); ok {
+		return deadline.Add(time.Minute)
+	}
+
+	return time.Now().Add(time.Hour)
+}
+
+// tusStore the records of the uploads, the progress is saved in it after every part and when
+// the body of a request ends
+type tusStore interface {
+	UpdateFileUploadProgress(ctx context.Context, data model.FileUploadEnt) error
+	DeleteFileUpload(ctx context.Context, id int64) error
+}
+
+// dbTusStore the records of the uploads in the database
+type dbTusStore struct {
+	*bootstrap.App
+}
+
+func (s dbTusStore) UpdateFileUploadProgress(ctx context.Context, data model.FileUploadEnt) error {
+	m := model.Contract{App: s.App}
+	return m.UpdateFileUploadProgress(s.DB, ctx, data)
+}
+
+func (s dbTusStore) DeleteFileUpload(ctx context.Context, id int64) error {
+	m := model.Contract{App: s.App}
+	return m.DeleteFileUpload(s.DB, ctx, id)
+}
+
+// tusWriter write the content of the uploads to the storage by parts and save their progress
+type tusWriter struct {
+	Storage storage.Storage
+	Store   tusStore
+	Options tusOptions
+	// MaxImageSize of an image upload in bytes, the image pipeline works in memory
+	MaxImageSize int64
+}
+
+func (h *Contract) tusWriter(opts tusOptions) tusWriter {
+	return tusWriter{
+		Storage:      h.Storage,
+		Store:        dbTusStore{h.App},
+		Options:      opts,
+		MaxImageSize: h.uploadMaxSize() * upload.MB,
+	}
+}
+
+// writeUpload append the body of the request to the locked upload, the file is recorded
+// when the upload is complete. The upload is removed once its object is assembled, a
+// failure after it starts a new upload.
+func (h *Contract) writeUpload(ctx context.Context, r *http.Request, data model.FileUploadEnt, opts tusOptions) (model.FileUploadEnt, *model.FileEnt, error) {
+	tw := h.tusWriter(opts)
+
+	data, sha, err := tw.write(ctx, r.Body, data)
+	if err != nil || len(sha) == 0 {
+		return data, nil, err
+	}
+
+	file, err := h.recordUpload(ctx, data, sha)
+	if dErr := tw.discard(context.Background(), data); dErr != nil && err == nil {
+		err = dErr
+	}
+	if err != nil {
+		return data, nil, err
+	}
+
+	return data, &file, nil
+}
+
+// write append body to the upload. The content is sent to the storage by parts of PartSize,
+// the bytes after the last part are kept in a pending object and sent with the next part.
+// The progress is saved after every part and when the body ends, so a request cut by the
+// network keeps what it received. It returns the sha-256 of the content once the object of
+// the upload is assembled, empty while the upload goes on.
+func (tw tusWriter) write(ctx context.Context, r io.Reader, data model.FileUploadEnt) (model.FileUploadEnt, string, error) {
+	// the hash of the bytes up to the offset is saved with the progress
+	sum, err := resumeHash(data.HashState)
+	if err != nil {
+		return data, "", apperr.Wrap(err, apperr.Internal, apperr.CodeInternal, utils.ErrWritingFileUpload)
+	}
+
+	// the part being filled, it starts with the pending bytes
+	left := data.Length - data.Offset
+	part := make([]byte, partBufferSize(tw.Options.PartSize, data.PendingSize, left))
+	filled := 0
+	if data.PendingSize > 0 {
+		body, _, err := tw.Storage.Get(ctx, data.PendingKey)
+		if err != nil {
+			return data, "", err
+		}
+		// a request that failed before saving its progress can have stored more bytes
+		filled, err = io.ReadFull(body, part[:data.PendingSize])
+		body.Close()
+		if err != nil {
+			return data, "", err
+		}
+	}
+
+	body := io.TeeReader(io.LimitReader(r, left), sum)
+	filled, readErr, err := fillParts(body, left, part, filled, func(content []byte) error {
+		// the type is found from the first bytes
+		if len(data.MimeType) > 0 {
+			return nil
+		}
+		if err := tw.checkType(&data, content); err != nil {
+			_ = tw.discard(ctx, data)
+			return err
+		}
+		return nil
+	}, func(content []byte) error {
+		return tw.uploadPart(ctx, &data, content, sum)
+	})
+	if err != nil {
+		return data, "", err
+	}
+
+	if data.PartsSize()+int64(filled) == data.Length {
+		if err = tw.assemble(ctx, &data, part[:filled], sum); err != nil {
+			return data, "", err
+		}
+		return data, hex.EncodeToString(sum.Sum(nil)), nil
+	}
+
+	// the bytes received since the last progress are saved even when the client has gone
+	if int64(filled) > data.PendingSize {
+		saveCtx, cancel := context.WithTimeout(context.Background(), pendingSaveTimeout)
+		defer cancel()
+
+		key := upload.TusPendingKey(data.UploadIdentifier, data.PartsSize())
+		err := tw.Storage.Put(saveCtx, key, bytes.NewReader(part[:filled]), storage.PutOptions{Size: int64(filled)})
+		if err != nil {
+			return data, "", err
+		}
+
+		data.PendingKey, data.PendingSize = key, int64(filled)
+		if err = tw.saveProgress(saveCtx, &data, sum); err != nil {
+			return data, "", err
+		}
+	}
+
+	if readErr != nil && !errors.Is(readErr, io.EOF) && !errors.Is(readErr, io.ErrUnexpectedEOF) {
+		if ctxErr, ok := apperr.FromContext(ctx.Err()); ok {
+			return data, "", ctxErr
+		}
+		return data, "", apperr.Wrap(readErr, apperr.Validation, apperr.CodeBadRequest, utils.ErrWritingFileUpload)
+	}
+
+	return data, "", nil
+}
+
+// resumeHash the sha-256 of the bytes up to the offset from its saved state, a new one when
+// nothing was received yet
+func resumeHash(state []byte) (hash.Hash, error) {
+	sum := sha256.New()
+	if len(state) > 0 {
+		if err := sum.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+			return nil, err
+		}
+	}
+
+	return sum, nil
+}
+
+// partBufferSize the buffer of the part being filled: a part of partSize, or the pending bytes
+// when they're more because upload.tus.part_size was lowered during the upload, but never more
+// than the pending bytes with the bytes left of the upload
+func partBufferSize(partSize, pendingSize, left int64) int64 {
+	size := partSize
+	if pendingSize > size {
+		size = pendingSize
+	}
+	if pendingSize+left < size {
+		size = pendingSize + left
+	}
+
+	return size
+}
+
+// fillParts read body, the left bytes of the upload, into part after its filled bytes. Every
+// time part is full and the upload goes on, it's given to flush and filled again. check gets
+// the filled bytes after every read. It returns the bytes left in part, the last part of the
+// upload or its pending bytes, the error of body and the error of check or flush.
+func fillParts(body io.Reader, left int64, part []byte, filled int, check, flush func([]byte) error) (int, error, error) {
+	for {
+		n, readErr := io.ReadFull(body, part[filled:])
+		filled += n
+		left -= int64(n)
+
+		if filled > 0 {
+			if err := check(part[:filled]); err != nil {
+				return filled, readErr, err
+			}
+		}
+		// the end of the upload is sent as the last part when it's completed
+		if filled < len(part) || left <= 0 {
+			return filled, readErr, nil
+		}
+
+		if err := flush(part); err != nil {
+			return filled, readErr, err
+		}
+		filled = 0
+	}
+}
+
+// checkType set the type of the upload and the extension of its key from its first bytes,
+// the upload is refused when it's not an allowed type or it's an image larger than
+// MaxImageSize
+func (tw tusWriter) checkType(data *model.FileUploadEnt, content []byte) error {
+	if len(content) > 512 {
+		content = content[:512]
+	}
+
+	mime, ext := upload.DetectContentType(content, "")
+	if !utils.StringContainsArray(allowedUploadExt, ext) {
+		return apperr.New(apperr.Validation, apperr.CodeFileTypeNotAllowed, utils.ErrContentTypeNotAllowed)
+	}
+	if imaging.Supported(mime) && data.Length > tw.MaxImageSize {
+		return apperr.New(apperr.Validation, apperr.CodeFileTooLarge, utils.ErrFileTooLarge)
+	}
+	data.MimeType = mime
+	data.StorageKey += "." + ext
+
+	return nil
+}
+
+// uploadPart send the content as the next part of the upload and save the progress
+func (tw tusWriter) uploadPart(ctx context.Context, data *model.FileUploadEnt, content []byte, sum hash.Hash) error {
+	mp, ok := tw.Storage.(storage.Multipart)
+	if !ok {
+		return apperr.New(apperr.Internal, apperr.CodeInternal, utils.ErrWritingFileUpload)
+	}
+
+	// the multipart upload is started by the first part, the id is saved at once so an
+	// expired upload can abort it
+	if len(data.MultipartID) == 0 {
+		id, err := mp.CreateMultipart(ctx, data.StorageKey, uploadPutOptions(*data))
+		if err != nil {
+			return err
+		}
+		data.MultipartID = id
+		if err = tw.Store.UpdateFileUploadProgress(ctx, *data); err != nil {
+			return err
+		}
+	}
+
+	part, err := mp.UploadPart(ctx, data.StorageKey, data.MultipartID, len(data.Parts)+1, bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return err
+	}
+
+	pendingKey := data.PendingKey
+	data.Parts = append(data.Parts, part)
+	data.PendingKey, data.PendingSize = "", 0
+	if err = tw.saveProgress(ctx, data, sum); err != nil {
+		return err
+	}
+
+	if len(pendingKey) > 0 {
+		_ = tw.Storage.Delete(ctx, pendingKey)
+	}
+
+	return nil
+}
+
+// saveProgress save the offset of the parts and the pending bytes with the hash of the
+// content up to it, the expiry of the upload is pushed back
+func (tw tusWriter) saveProgress(ctx context.Context, data *model.FileUploadEnt, sum hash.Hash) error {
+	state, err := sum.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return apperr.Wrap(err, apperr.Internal, apperr.CodeInternal, utils.ErrWritingFileUpload)
+	}
+
+	data.HashState = state
+	data.Offset = data.PartsSize() + data.PendingSize
+	data.ExpiresDate = time.Now().UTC().Add(tw.Options.Expiry)
+
+	return tw.Store.UpdateFileUploadProgress(ctx, *data)
+}
+
+// assemble the object of the upload with the last bytes, a small upload is stored as is
+func (tw tusWriter) assemble(ctx context.Context, data *model.FileUploadEnt, last []byte, sum hash.Hash) error {
+	if len(data.Parts) == 0 {
+		putOpts := uploadPutOptions(*data)
+		putOpts.Size = int64(len(last))
+		if err := tw.Storage.Put(ctx, data.StorageKey, bytes.NewReader(last), putOpts); err != nil {
+			return err
+		}
+	} else {
+		if len(last) > 0 {
+			if err := tw.uploadPart(ctx, data, last, sum); err != nil {
+				return err
+			}
+		}
+		if err := tw.Storage.(storage.Multipart).CompleteMultipart(ctx, data.StorageKey, data.MultipartID, data.Parts); err != nil {
+			return err
+		}
+	}
+	data.Offset = data.Length
+	data.MultipartID = ""
+
+	return nil
+}
+
+// recordUpload the file record of the assembled object, the existing file of the user when
+// the content was uploaded already
+func (h *Contract) recordUpload(ctx context.Context, data model.FileUploadEnt, sha string) (model.FileEnt, error) {
+	m := model.Contract{App: h.App}
+
+	existing, err := m.GetFileByHash(h.DB, ctx, data.UserIdentifier, sha, data.Visibility)
+	if err == nil {
+		h.deleteObjects([]string{data.StorageKey})
+		return existing, nil
+	}
+	if !apperr.IsKind(err, apperr.NotFound) {
+		h.deleteObjects([]string{data.StorageKey})
+		return existing, err
+	}
+
+	record := model.FileEnt{
+		StorageKey:   data.StorageKey,
+		OriginalName: data.OriginalName,
+		MimeType:     data.MimeType,
+		Size:         data.Length,
+		Visibility:   data.Visibility,
+		Sha256:       sha,
+	}
+	stored := []string{data.StorageKey}
+
+	if imaging.Supported(data.MimeType) {
+		body, _, err := h.Storage.Get(ctx, data.StorageKey)
+		if err != nil {
+			h.deleteObjects(stored)
+			return record, err
+		}
+		base := strings.TrimSuffix(data.StorageKey, path.Ext(data.StorageKey))
+		images, err := h.storeImage(ctx, body, base, storage.PutOptions{Public: data.Visibility == model.FileVisibilityPublic}, &record)
+		body.Close()
+		if err != nil {
+			h.deleteObjects(append(stored, images...))
+			if errors.Is(err, imaging.ErrNotImage) || errors.Is(err, imaging.ErrTooLarge) {
+				return record, apperr.Wrap(err, apperr.Validation, apperr.CodeBadRequest, utils.ErrProcessingImage)
+			}
+			return record, err
+		}
+
+		// the processed original replaces the uploaded one
+		if record.StorageKey != data.StorageKey {
+			h.deleteObjects(stored)
+		}
+		stored = images
+	}
+
+	return h.saveFile(ctx, data.UserIdentifier, record, stored)
+}
+
+// discard abort the multipart upload, delete the pending objects and the upload
+func (tw tusWriter) discard(ctx context.Context, data model.FileUploadEnt) error {
+	if len(data.MultipartID) > 0 {
+		if mp, ok := tw.Storage.(storage.Multipart); ok {
+			if err := mp.AbortMultipart(ctx, data.StorageKey, data.MultipartID); err != nil {
+				return err
+			}
+		}
+	}
+
+	var pending []string
+	err := tw.Storage.List(ctx, upload.TusPendingPrefix+data.UploadIdentifier+"/", func(obj storage.Object) error {
+		pending = append(pending, obj.Key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range pending {
+		if err = tw.Storage.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	return tw.Store.DeleteFileUpload(ctx, data.Id)
+}
+
+// uploadPutOptions the options of the object of the upload, the images are processed before
+// they're served so only the other files are downloaded as attachment
+func uploadPutOptions(data model.FileUploadEnt) storage.PutOptions {
+	opts := storage.PutOptions{
+		ContentType: data.MimeType,
+		Size:        -1,
+		Public:      data.Visibility == model.FileVisibilityPublic,
+	}
+	if !imaging.Supported(data.MimeType) {
+		opts.ContentDisposition = "attachment"
+	}
+
+	return opts
+}
@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"go-skeleton/lib/apperr"
+	"go-skeleton/lib/storage"
+	"go-skeleton/lib/upload"
+	"go-skeleton/services/api/model"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestPartBufferSize(t *testing.T) {
+	tests := []struct {
+		name                    string
+		partSize, pending, left int64
+		want                    int64
+	}{
+		{"small upload", 10, 0, 4, 4},
+		{"large upload", 10, 0, 100, 10},
+		{"upload of a part", 10, 0, 10, 10},
+		{"resume with pending bytes", 10, 3, 100, 10},
+		{"resume near the end", 10, 3, 2, 5},
+		{"part size lowered during the upload", 4, 6, 10, 6},
+		{"nothing left", 10, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		if got := partBufferSize(tt.partSize, tt.pending, tt.left); got != tt.want {
+			t.Errorf("%s: partBufferSize(%d, %d, %d) = %d, want %d", tt.name, tt.partSize, tt.pending, tt.left, got, tt.want)
+		}
+	}
+}
+
+var errCut = errors.New("connection reset")
+
+// cutReader the body of a request cut by the network after its content
+type cutReader struct {
+	r io.Reader
+}
+
+func (c cutReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err == io.EOF {
+		return n, errCut
+	}
+	return n, err
+}
+
+// memoryTusStore the records of the uploads in memory, a request starts from the record saved
+// by the requests before it as TusPatchAct does
+type memoryTusStore struct {
+	uploads map[int64]model.FileUploadEnt
+}
+
+func (s *memoryTusStore) UpdateFileUploadProgress(ctx context.Context, data model.FileUploadEnt) error {
+	if _, ok := s.uploads[data.Id]; !ok {
+		return errors.New("upload not found")
+	}
+	s.uploads[data.Id] = data
+	return nil
+}
+
+func (s *memoryTusStore) DeleteFileUpload(ctx context.Context, id int64) error {
+	delete(s.uploads, id)
+	return nil
+}
+
+// newTusWriter a writer to a local storage of the test with an upload of length bytes
+func newTusWriter(t *testing.T, partSize, length int64) (tusWriter, *memoryTusStore) {
+	t.Helper()
+
+	local, err := storage.NewLocal(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &memoryTusStore{uploads: map[int64]model.FileUploadEnt{
+		1: {
+			Id:               1,
+			UploadIdentifier: "upload-1",
+			StorageKey:       "private/uploads/upload-1",
+			Visibility:       model.FileVisibilityPrivate,
+			Length:           length,
+		},
+	}}
+
+	return tusWriter{
+		Storage:      local,
+		Store:        store,
+		Options:      tusOptions{MaxSize: 1 << 20, PartSize: partSize, Expiry: time.Hour},
+		MaxImageSize: 1 << 20,
+	}, store
+}
+
+// patch send the chunk from the saved record of the upload, every request but the last one
+// is cut by the network
+func patch(t *testing.T, tw tusWriter, store *memoryTusStore, chunk []byte, last bool) (model.FileUploadEnt, string) {
+	t.Helper()
+
+	var body io.Reader = bytes.NewReader(chunk)
+	if !last {
+		body = cutReader{body}
+	}
+	data, sha, err := tw.write(context.Background(), body, store.uploads[1])
+	if last && err != nil {
+		t.Fatal(err)
+	}
+	if !last && !errors.Is(err, errCut) {
+		t.Fatalf("error %v of a cut request, want %v", err, errCut)
+	}
+
+	return data, sha
+}
+
+// readObject the content of the object at key
+func readObject(t *testing.T, tw tusWriter, key string) []byte {
+	t.Helper()
+
+	body, _, err := tw.Storage.Get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+
+	content, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+// pdfContent a pdf of size bytes, the type of the upload is found from its first bytes
+func pdfContent(size int) []byte {
+	content := make([]byte, size)
+	n := copy(content, "%PDF-1.4\n")
+	for i := n; i < size; i++ {
+		content[i] = byte(i)
+	}
+	return content
+}
+
+func TestWriteUploadResume(t *testing.T) {
+	content := pdfContent(47)
+	sha := sha256.Sum256(content)
+
+	tests := []struct {
+		name     string
+		partSize int64
+		// the bytes sent by each request, every request but the last one is cut
+		chunks []int
+	}{
+		{"single request", 10, []int{47}},
+		{"cut inside a part", 10, []int{13, 34}},
+		{"cut on a part boundary", 10, []int{20, 27}},
+		{"small pieces", 10, []int{5, 4, 5, 6, 7, 8, 12}},
+		{"cut in the last part", 10, []int{45, 2}},
+		{"upload smaller than a part", 64, []int{30, 17}},
+	}
+
+	for _, tt := range tests {
+		tw, store := newTusWriter(t, tt.partSize, int64(len(content)))
+
+		var (
+			data model.FileUploadEnt
+			sum  string
+			sent int
+		)
+		for i, n := range tt.chunks {
+			if offset := store.uploads[1].Offset; offset != int64(sent) {
+				t.Fatalf("%s: offset %d saved before request %d, want %d", tt.name, offset, i, sent)
+			}
+
+			last := i == len(tt.chunks)-1
+			data, sum = patch(t, tw, store, content[sent:sent+n], last)
+			sent += n
+		}
+
+		if sum != hex.EncodeToString(sha[:]) {
+			t.Errorf("%s: sha256 %s, want %x", tt.name, sum, sha)
+		}
+		if data.StorageKey != "private/uploads/upload-1.pdf" || data.MimeType != upload.ContentTypePDF {
+			t.Errorf("%s: stored at %s as %s, want the key and type of a pdf", tt.name, data.StorageKey, data.MimeType)
+		}
+		// the last part has the end of the upload
+		for j := 0; j+1 < len(data.Parts); j++ {
+			if data.Parts[j].Size != tt.partSize {
+				t.Errorf("%s: part %d is %d bytes, want %d", tt.name, j+1, data.Parts[j].Size, tt.partSize)
+			}
+		}
+		if got := readObject(t, tw, data.StorageKey); !bytes.Equal(got, content) {
+			t.Errorf("%s: stored object %v, want %v", tt.name, got, content)
+		}
+
+		// the pending objects and the record are removed with the upload
+		if err := tw.discard(context.Background(), data); err != nil {
+			t.Fatal(err)
+		}
+		err := tw.Storage.List(context.Background(), upload.TusPendingPrefix, func(obj storage.Object) error {
+			t.Errorf("%s: pending object %s left", tt.name, obj.Key)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := store.uploads[1]; ok {
+			t.Errorf("%s: upload record left", tt.name)
+		}
+	}
+}
+
+func TestWriteUploadLoweredPartSize(t *testing.T) {
+	content := pdfContent(20)
+	sha := sha256.Sum256(content)
+
+	// 6 pending bytes received with a part size of 10, the part size is now 4
+	tw, store := newTusWriter(t, 10, int64(len(content)))
+	patch(t, tw, store, content[:6], false)
+	if saved := store.uploads[1]; saved.PendingSize != 6 || saved.Offset != 6 {
+		t.Fatalf("pending %d bytes at offset %d, want 6", saved.PendingSize, saved.Offset)
+	}
+
+	tw.Options.PartSize = 4
+	data, sum := patch(t, tw, store, content[6:], true)
+
+	if len(data.Parts) == 0 || data.Parts[0].Size != 6 {
+		t.Fatalf("first part %v, want the 6 pending bytes", data.Parts)
+	}
+	if sum != hex.EncodeToString(sha[:]) {
+		t.Errorf("sha256 %s, want %x", sum, sha)
+	}
+	if got := readObject(t, tw, data.StorageKey); !bytes.Equal(got, content) {
+		t.Errorf("stored object %q, want %q", got, content)
+	}
+}
+
+func TestWriteUploadTypeNotAllowed(t *testing.T) {
+	content := []byte("a plain text file, not an allowed type")
+
+	tw, store := newTusWriter(t, 10, int64(len(content)))
+	_, _, err := tw.write(context.Background(), bytes.NewReader(content), store.uploads[1])
+
+	if e, ok := apperr.As(err); !ok || e.Code != apperr.CodeFileTypeNotAllowed {
+		t.Fatalf("error %v, want %s", err, apperr.CodeFileTypeNotAllowed)
+	}
+	if _, ok := store.uploads[1]; ok {
+		t.Error("the refused upload isn't removed")
+	}
+	err = tw.Storage.List(context.Background(), "", func(obj storage.Object) error {
+		t.Errorf("object %s stored for the refused upload", obj.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFillPartsCheck(t *testing.T) {
+	errType := errors.New("type not allowed")
+	flushed := 0
+
+	part := make([]byte, 4)
+	_, _, err := fillParts(bytes.NewReader([]byte("0123456789")), 10, part, 0, func(content []byte) error {
+		return errType
+	}, func([]byte) error {
+		flushed++
+		return nil
+	})
+	if !errors.Is(err, errType) {
+		t.Errorf("error %v, want %v", err, errType)
+	}
+	if flushed > 0 {
+		t.Errorf("%d parts flushed after the check failed", flushed)
+	}
+}
+
+func TestResumeHash(t *testing.T) {
+	if _, err := resumeHash([]byte("not a hash state")); err == nil {
+		t.Error("resumeHash accepted an invalid state")
+	}
+
+	sum, err := resumeHash(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sum.Sum(nil), sha256.Sum256(nil); !bytes.Equal(got, want[:]) {
+		t.Errorf("empty hash %x, want %x", got, want)
+	}
+}
@@ -1,39 +1,480 @@
 package handler
 
 import (
-	"go-skeleton/lib/s3"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"go-skeleton/bootstrap"
+	"go-skeleton/lib/apperr"
+	"go-skeleton/lib/imaging"
+	"go-skeleton/lib/storage"
 	"go-skeleton/lib/upload"
+	"go-skeleton/lib/utils"
+	"go-skeleton/services/api/model"
+	"go-skeleton/services/api/request"
+	"go-skeleton/services/api/response"
+	"io"
+	"mime"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
 )
 
+// privateKeyPrefix the keys of the private files, they're never served by ServeStorageAct
+const privateKeyPrefix = "private/"
+
+// defaultPresignExpiry of the presigned urls when upload.presign_expiry is empty
+const defaultPresignExpiry = 5 * time.Minute
+
+// defaultMaxSize of an uploaded file in MB when upload.max_size is empty
+const defaultMaxSize = 10
+
+// allowedUploadExt the types of the uploaded files, detected from their content
+var allowedUploadExt = []string{"jpg", "png", "jpeg", "pdf", "webp"}
+
+// UploadFileAct store the file of the upload form field. The visibility form field is public
+// (default of upload.visibility) or private, a private file is only downloaded with
+// GetUploadAct or GetUploadURLAct by its owner or a user with the files:read permission.
 func (h *Contract) UploadFileAct(w http.ResponseWriter, r *http.Request) {
 	var (
-		resFileName string
-		info        = new(upload.Info)
-		name        = "upload"
-		allowedExt  = []string{"jpg", "png", "jpeg", "pdf", "webp"}
-
-		// Import contract s3
-		uploadContract = s3.New(h.App)
+		ctx            = r.Context()
+		m              = model.Contract{App: h.App}
+		info           = new(upload.Info)
+		name           = "upload"
+		userIdentifier = bootstrap.GetUserIdentifierFromToken(ctx, r)
 	)
-	info.MaxSize = 10
-	file, fileInfo, err := info.MultipartHandler(w, r, name, allowedExt)
+	info.MaxSize = h.uploadMaxSize()
+	file, fileInfo, err := info.MultipartHandler(w, r, name, allowedUploadExt)
 	if err != nil {
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, err)
 		return
 	}
 	defer file.Close()
 
-	fileHeader := make([]byte, fileInfo.FileSize)
-	if _, err := file.Read(fileHeader); err != nil {
-		h.SendBadRequest(w, err.Error())
+	visibility, ok := h.uploadVisibility(r.FormValue("visibility"))
+	if !ok {
+		h.SendBadRequest(w, utils.ErrInvalidVisibility)
+		return
+	}
+
+	// the same content uploaded again by the user is the file already stored
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		h.SendInternalServerErr(w, utils.ErrHashingFile)
+		return
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		h.SendInternalServerErr(w, utils.ErrHashingFile)
+		return
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	existing, err := m.GetFileByHash(h.DB, ctx, userIdentifier, sum, visibility)
+	if err == nil {
+		h.SendSuccess(w, h.fileRes(existing), nil)
+		return
+	}
+	if !apperr.IsKind(err, apperr.NotFound) {
+		h.SendError(w, err)
+		return
+	}
+
+	base := uploadKeyBase(visibility)
+	record := model.FileEnt{
+		OriginalName: fileInfo.Filename,
+		MimeType:     fileInfo.FileMime,
+		Size:         fileInfo.FileSize,
+		Visibility:   visibility,
+		Sha256:       sum,
+	}
+	opts := storage.PutOptions{Public: visibility == model.FileVisibilityPublic}
+
+	var stored []string
+	if imaging.Supported(fileInfo.FileMime) {
+		stored, err = h.storeImage(ctx, file, base, opts, &record)
+	} else {
+		// the extension is the detected type, the name given by the client could make it served as html
+		record.StorageKey = base + "." + fileInfo.FileExt
+		opts.ContentType, opts.ContentDisposition, opts.Size = fileInfo.FileMime, "attachment", fileInfo.FileSize
+		if err = h.Storage.Put(ctx, record.StorageKey, file, opts); err == nil {
+			stored = append(stored, record.StorageKey)
+		}
+	}
+	if err != nil {
+		h.deleteObjects(stored)
+		if errors.Is(err, imaging.ErrNotImage) || errors.Is(err, imaging.ErrTooLarge) {
+			h.SendBadRequest(w, utils.ErrProcessingImage)
+			return
+		}
+		h.SendError(w, err)
+		return
+	}
+
+	data, err := h.saveFile(ctx, userIdentifier, record, stored)
+	if err != nil {
+		h.SendError(w, err)
+		return
+	}
+
+	h.SendSuccess(w, h.fileRes(data), nil)
+}
+
+// uploadMaxSize the maximum size in MB of upload.max_size
+func (h *Contract) uploadMaxSize() int64 {
+	if size := h.Config.GetInt("upload.max_size"); size > 0 {
+		return int64(size)
+	}
+
+	return defaultMaxSize
+}
+
+// uploadVisibility the visibility of the upload, the default of upload.visibility when it's
+// empty, false when it's neither public nor private
+func (h *Contract) uploadVisibility(visibility string) (string, bool) {
+	if len(visibility) == 0 {
+		visibility = h.Config.GetString("upload.visibility")
+	}
+	if len(visibility) == 0 {
+		visibility = model.FileVisibilityPublic
+	}
+
+	return visibility, visibility == model.FileVisibilityPublic || visibility == model.FileVisibilityPrivate
+}
+
+// uploadKeyBase the key of a new upload without extension, the encoded upload time and a
+// random part. The variants of an image are stored next to it with their size.
+func uploadKeyBase(visibility string) string {
+	random := make([]byte, 4)
+	_, _ = rand.Read(random)
+	timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	base := "uploads/" + base64.RawURLEncoding.EncodeToString([]byte(timestamp)) + "-" + hex.EncodeToString(random)
+	if visibility == model.FileVisibilityPrivate {
+		base = privateKeyPrefix + base
+	}
+
+	return base
+}
+
+// saveFile insert the record of the stored objects, they're deleted when it fails. The same
+// content stored by a concurrent request of the user gives the existing record.
+func (h *Contract) saveFile(ctx context.Context, userIdentifier string, record model.FileEnt, stored []string) (model.FileEnt, error) {
+	m := model.Contract{App: h.App}
+
+	data, err := m.InsertFile(h.DB, ctx, userIdentifier, record)
+	if err != nil {
+		// the objects aren't reachable without their record
+		h.deleteObjects(stored)
+
+		if apperr.IsKind(err, apperr.Conflict) {
+			if existing, gErr := m.GetFileByHash(h.DB, ctx, userIdentifier, record.Sha256, record.Visibility); gErr == nil {
+				return existing, nil
+			}
+		}
+		return data, err
+	}
+
+	return data, nil
+}
+
+// storeImage store the image without its metadata, downscaled to upload.image.max_dimension,
+// and its variants. The keys of the stored objects are returned even on error.
+func (h *Contract) storeImage(ctx context.Context, r io.Reader, base string, opts storage.PutOptions, record *model.FileEnt) ([]string, error) {
+	var stored []string
+
+	res, err := imaging.Process(r, imaging.OptionsFromConfig(h.Config))
+	if err != nil {
+		return stored, err
+	}
+
+	put := func(key string, img imaging.Encoded) error {
+		o := opts
+		o.ContentType, o.Size = img.ContentType, int64(len(img.Data))
+		if err := h.Storage.Put(ctx, key, bytes.NewReader(img.Data), o); err != nil {
+			return err
+		}
+		stored = append(stored, key)
+		return nil
+	}
+
+	record.StorageKey = base + res.Original.Ext
+	if err = put(record.StorageKey, res.Original); err != nil {
+		return stored, err
+	}
+	record.MimeType, record.Size = res.Original.ContentType, int64(len(res.Original.Data))
+	record.Width, record.Height = res.Original.Width, res.Original.Height
+
+	for _, v := range res.Variants {
+		key := base + "_" + strconv.Itoa(v.Size) + v.Ext
+		if err = put(key, v.Encoded); err != nil {
+			return stored, err
+		}
+		record.Variants = append(record.Variants, model.FileVariant{
+			Size:        v.Size,
+			Key:         key,
+			Width:       v.Width,
+			Height:      v.Height,
+			ContentType: v.ContentType,
+		})
+	}
+
+	return stored, nil
+}
+
+// deleteObjects remove the objects of a failed upload
+func (h *Contract) deleteObjects(keys []string) {
+	for _, key := range keys {
+		_ = h.Storage.Delete(context.Background(), key)
+	}
+}
+
+// GetUploadListAct the files of the user
+func (h *Contract) GetUploadListAct(w http.ResponseWriter, r *http.Request) {
+	var (
+		err            error
+		ctx            = r.Context()
+		m              = model.Contract{App: h.App}
+		res            = make([]response.FileRes, 0)
+		param          = request.FileParam{}
+		userIdentifier = bootstrap.GetUserIdentifierFromToken(ctx, r)
+	)
+
+	// Define urlQuery and Parse
+	err = param.ParseFile(r.URL.Query())
+	if err != nil {
+		h.SendError(w, apperr.Wrap(err, apperr.Validation, apperr.CodeBadRequest, utils.ErrInvalidQueryParameter))
+		return
+	}
+
+	data, err := m.GetFilesByUser(h.DB, ctx, userIdentifier, &param)
+	if err != nil {
+		// if empty data still success response
+		if apperr.IsKind(err, apperr.NotFound) {
+			h.SendEmptyDataSuccess(w, res, param)
+			return
+		}
+
+		h.SendError(w, err)
+		return
+	}
+
+	// Populate response
+	for _, v := range data {
+		res = append(res, h.fileRes(v))
+	}
+
+	h.SendSuccess(w, res, param)
+}
+
+// DeleteUploadAct soft delete a file of the user
+func (h *Contract) DeleteUploadAct(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx            = r.Context()
+		m              = model.Contract{App: h.App}
+		fileCode       = chi.URLParam(r, "code")
+		userIdentifier = bootstrap.GetUserIdentifierFromToken(ctx, r)
+	)
+
+	err := m.DeleteFile(h.DB, ctx, userIdentifier, fileCode)
+	if err != nil {
+		h.SendError(w, err)
+		return
+	}
+
+	h.SendSuccess(w, nil, nil)
+}
+
+// GetUploadAct stream the file to its owner or a user with the files:read permission
+func (h *Contract) GetUploadAct(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx      = r.Context()
+		m        = model.Contract{App: h.App}
+		fileCode = chi.URLParam(r, "code")
+	)
+
+	data, err := m.GetFileByCode(h.DB, ctx, fileCode)
+	if err != nil {
+		h.SendError(w, err)
+		return
+	}
+	if !h.canReadFile(ctx, r, data) {
+		h.SendForbidden(w, utils.ErrPermissionDenied)
+		return
+	}
+	key, ok := fileKey(data, r.URL.Query().Get("variant"))
+	if !ok {
+		h.SendBadRequest(w, utils.ErrInvalidFileVariant)
+		return
+	}
+
+	body, obj, err := h.Storage.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotExist) {
+			h.SendError(w, apperr.Wrap(err, apperr.NotFound, apperr.CodeEmptyData, utils.EmptyData))
+			return
+		}
+		h.SendError(w, err)
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": data.OriginalName}))
+	w.Header().Set("Cache-Control", "private, no-store")
+	serveObject(w, r, body, obj)
+}
+
+// GetUploadURLAct a presigned url of the file valid for upload.presign_expiry seconds, for
+// the storages that support it
+func (h *Contract) GetUploadURLAct(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx      = r.Context()
+		m        = model.Contract{App: h.App}
+		fileCode = chi.URLParam(r, "code")
+		expiry   = time.Duration(h.Config.GetInt("upload.presign_expiry")) * time.Second
+	)
+	if expiry <= 0 {
+		expiry = defaultPresignExpiry
+	}
+
+	presigner, ok := h.Storage.(storage.Presigner)
+	if !ok {
+		h.SendBadRequest(w, utils.ErrPresignNotSupported)
 		return
 	}
-	resFileName, err = uploadContract.UploadFileS3(fileInfo.Filename, fileInfo.FileMime, fileInfo.FileSize, fileHeader)
+
+	data, err := m.GetFileByCode(h.DB, ctx, fileCode)
 	if err != nil {
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, err)
+		return
+	}
+	if !h.canReadFile(ctx, r, data) {
+		h.SendForbidden(w, utils.ErrPermissionDenied)
+		return
+	}
+	key, ok := fileKey(data, r.URL.Query().Get("variant"))
+	if !ok {
+		h.SendBadRequest(w, utils.ErrInvalidFileVariant)
+		return
+	}
+
+	expiredDate := time.Now().UTC().Add(expiry)
+	url, err := presigner.PresignGet(key, expiry, data.OriginalName)
+	if err != nil {
+		h.SendInternalServerErr(w, utils.ErrPresigningFileURL)
+		return
+	}
+
+	h.SendSuccess(w, response.FileURLRes{URL: url, ExpiredDate: expiredDate}, nil)
+}
+
+// ServeStorageAct the object of the storage, for the local driver when storage.local.serve is set
+func (h *Contract) ServeStorageAct(w http.ResponseWriter, r *http.Request) {
+	key, err := storage.CleanKey(strings.TrimPrefix(r.URL.Path, "/storage/"))
+	if err != nil || strings.HasPrefix(key, privateKeyPrefix) || hiddenKey(key) {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, obj, err := h.Storage.Get(r.Context(), key)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer body.Close()
+
+	// only the processed images are shown inline, the other files are downloaded
+	if !imaging.Supported(obj.ContentType) {
+		w.Header().Set("Content-Disposition", "attachment")
+	}
+	serveObject(w, r, body, obj)
+}
+
+// hiddenKey a key with a dot segment, e.g. the temporary files of the local driver, isn't an object
+func hiddenKey(key string) bool {
+	for _, segment := range strings.Split(key, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canReadFile the public files are readable by every user, the private ones by their owner
+// and the users with the files:read permission
+func (h *Contract) canReadFile(ctx context.Context, r *http.Request, file model.FileEnt) bool {
+	if file.Visibility == model.FileVisibilityPublic {
+		return true
+	}
+	if file.UserIdentifier == bootstrap.GetUserIdentifierFromToken(ctx, r) {
+		return true
+	}
+
+	return utils.Contains(h.GetUserPermissions(ctx), "files:read")
+}
+
+func (h *Contract) fileRes(v model.FileEnt) response.FileRes {
+	res := response.FileRes{
+		FileIdentifier: v.FileIdentifier,
+		OriginalName:   v.OriginalName,
+		MimeType:       v.MimeType,
+		Size:           v.Size,
+		Visibility:     v.Visibility,
+		Sha256:         v.Sha256,
+		Width:          v.Width,
+		Height:         v.Height,
+		Variants:       make([]response.FileVariantRes, 0, len(v.Variants)),
+		CreatedDate:    v.CreatedDate,
+	}
+	for _, variant := range v.Variants {
+		res.Variants = append(res.Variants, response.FileVariantRes{
+			Size:   variant.Size,
+			Width:  variant.Width,
+			Height: variant.Height,
+		})
+	}
+
+	// the private files have no public url, they're downloaded with ?variant=<size>
+	if v.Visibility == model.FileVisibilityPublic {
+		res.URL = h.Storage.URL(v.StorageKey)
+		for i, variant := range v.Variants {
+			res.Variants[i].URL = h.Storage.URL(variant.Key)
+		}
+	}
+
+	return res
+}
+
+// fileKey the key of the file or of its variant of the size, false when there is no such variant
+func fileKey(file model.FileEnt, variant string) (string, bool) {
+	if len(variant) == 0 {
+		return file.StorageKey, true
+	}
+	for _, v := range file.Variants {
+		if strconv.Itoa(v.Size) == variant {
+			return v.Key, true
+		}
+	}
+
+	return "", false
+}
+
+// serveObject write the content of the object, with range requests when the body can seek
+func serveObject(w http.ResponseWriter, r *http.Request, body io.ReadCloser, obj storage.Object) {
+	w.Header().Set("Content-Type", obj.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if seeker, ok := body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, path.Base(obj.Key), obj.ModTime, seeker)
 		return
 	}
 
-	h.SendSuccess(w, resFileName, nil)
+	w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	_, _ = io.Copy(w, body)
 }
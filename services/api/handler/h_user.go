@@ -1,8 +1,8 @@
 package handler
 
 import (
-	"context"
 	"go-skeleton/bootstrap"
+	"go-skeleton/lib/apperr"
 	"go-skeleton/lib/utils"
 	"go-skeleton/services/api/model"
 	"go-skeleton/services/api/request"
@@ -13,7 +13,7 @@ import (
 func (h *Contract) GetUserProfileAct(w http.ResponseWriter, r *http.Request) {
 	var (
 		err            error
-		ctx            = context.TODO()
+		ctx            = r.Context()
 		userIdentifier = bootstrap.GetUserIdentifierFromToken(ctx, r)
 		m              = model.Contract{App: h.App}
 		dataUser       model.UserEnt
@@ -22,20 +22,34 @@ func (h *Contract) GetUserProfileAct(w http.ResponseWriter, r *http.Request) {
 
 	dataUser, err = m.GetUserByUserIdentifier(h.DB, ctx, userIdentifier)
 	if err != nil {
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, err)
 		return
 	}
 
 	// Populate response
 	res = response.UserProfileRes{
-		UserIdentifier: dataUser.UserIdentifier,
-		FirstName:      dataUser.FirstName,
-		LastName:       dataUser.LastName.String,
-		Email:          dataUser.Email,
-		AvatarURL:      dataUser.AvatarURL.String,
-		IsVerified:     dataUser.IsVerified,
-		CreatedDate:    dataUser.CreatedDate.Format(utils.DATE_TIME_FORMAT),
-		UpdatedDate:    dataUser.UpdatedDate.Time.Format(utils.DATE_TIME_FORMAT),
+		UserIdentifier:   dataUser.UserIdentifier,
+		FirstName:        dataUser.FirstName,
+		LastName:         dataUser.LastName.String,
+		Email:            dataUser.Email,
+		AvatarURL:        dataUser.AvatarURL.String,
+		IsVerified:       dataUser.IsVerified,
+		TwoFactorEnabled: dataUser.TwoFactorEnabled,
+		Role:             dataUser.Role,
+		Locale:           dataUser.Locale.String,
+		CreatedDate:      dataUser.CreatedDate.Format(utils.DATE_TIME_FORMAT),
+		UpdatedDate:      dataUser.UpdatedDate.Time.Format(utils.DATE_TIME_FORMAT),
+		AvatarVariants:   make([]response.FileVariantRes, 0),
+	}
+	if dataUser.AvatarFileID.Valid {
+		avatar, err := m.GetFileByID(h.DB, ctx, dataUser.AvatarFileID.Int64)
+		if err != nil && !apperr.IsKind(err, apperr.NotFound) {
+			h.SendError(w, err)
+			return
+		}
+		if err == nil {
+			res.AvatarVariants = h.fileRes(avatar).Variants
+		}
 	}
 
 	h.SendSuccess(w, res, nil)
@@ -44,7 +58,7 @@ func (h *Contract) GetUserProfileAct(w http.ResponseWriter, r *http.Request) {
 func (h *Contract) UpdateUserProfileAct(w http.ResponseWriter, r *http.Request) {
 	var (
 		err            error
-		ctx            = context.TODO()
+		ctx            = r.Context()
 		req            = request.UpdateProfileUserReq{}
 		m              = model.Contract{App: h.App}
 		userIdentifier = bootstrap.GetUserIdentifierFromToken(ctx, r)
@@ -56,9 +70,24 @@ func (h *Contract) UpdateUserProfileAct(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = m.UpdateUserProfile(h.DB, ctx, userIdentifier, req.FirstName, req.LastName, req.Description, req.AvatarUrl)
+	// an uploaded avatar, its url and variants follow the file
+	avatarURL, avatarFileID := req.AvatarUrl, int64(0)
+	if len(req.AvatarFileIdentifier) > 0 {
+		file, err := m.GetFileByCode(h.DB, ctx, req.AvatarFileIdentifier)
+		if err != nil && !apperr.IsKind(err, apperr.NotFound) {
+			h.SendError(w, err)
+			return
+		}
+		if err != nil || file.UserIdentifier != userIdentifier || file.Visibility != model.FileVisibilityPublic || file.Width == 0 {
+			h.SendBadRequest(w, utils.ErrInvalidAvatarFile)
+			return
+		}
+		avatarURL, avatarFileID = h.Storage.URL(file.StorageKey), file.Id
+	}
+
+	err = m.UpdateUserProfile(h.DB, ctx, userIdentifier, req.FirstName, req.LastName, req.Description, avatarURL, req.Locale, avatarFileID)
 	if err != nil {
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, err)
 		return
 	}
 
@@ -68,7 +97,7 @@ func (h *Contract) UpdateUserProfileAct(w http.ResponseWriter, r *http.Request)
 func (h *Contract) UpdatePasswordUserAct(w http.ResponseWriter, r *http.Request) {
 	var (
 		err            error
-		ctx            = context.TODO()
+		ctx            = r.Context()
 		userIdentifier = bootstrap.GetUserIdentifierFromToken(ctx, r)
 		m              = model.Contract{App: h.App}
 		req            = request.UpdatePasswordReq{}
@@ -80,9 +109,84 @@ func (h *Contract) UpdatePasswordUserAct(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = m.UpdatePasswordUser(h.DB, ctx, userIdentifier, req.OldPassword, req.NewPassword, req.ConfirmPassword)
+	err = m.UpdatePasswordUser(h.DB, ctx, userIdentifier, h.GetSessionIdentifier(ctx), req.OldPassword, req.NewPassword, req.ConfirmPassword)
+	if err != nil {
+		h.SendError(w, err)
+		return
+	}
+
+	// Populate response
+	h.SendSuccess(w, nil, nil)
+}
+
+func (h *Contract) EnrollTwoFactorUserAct(w http.ResponseWriter, r *http.Request) {
+	var (
+		err            error
+		ctx            = r.Context()
+		userIdentifier = bootstrap.GetUserIdentifierFromToken(ctx, r)
+		m              = model.Contract{App: h.App}
+		res            = response.TwoFactorEnrollRes{}
+	)
+
+	enroll, err := m.EnrollTwoFactor(h.DB, ctx, userIdentifier)
+	if err != nil {
+		h.SendError(w, err)
+		return
+	}
+
+	// Populate response
+	res = response.TwoFactorEnrollRes{
+		Secret:        enroll.Secret,
+		OtpauthURI:    enroll.URI,
+		RecoveryCodes: enroll.RecoveryCodes,
+	}
+
+	h.SendSuccess(w, res, nil)
+}
+
+func (h *Contract) ConfirmTwoFactorUserAct(w http.ResponseWriter, r *http.Request) {
+	var (
+		err            error
+		ctx            = r.Context()
+		userIdentifier = bootstrap.GetUserIdentifierFromToken(ctx, r)
+		m              = model.Contract{App: h.App}
+		req            = request.TwoFactorCodeReq{}
+	)
+
+	// Bind and validate
+	if err = h.BindAndValidate(r, &req); err != nil {
+		h.SendBindAndValidateError(w, err)
+		return
+	}
+
+	err = m.ConfirmTwoFactor(h.DB, ctx, userIdentifier, req.Code)
+	if err != nil {
+		h.SendError(w, err)
+		return
+	}
+
+	// Populate response
+	h.SendSuccess(w, nil, nil)
+}
+
+func (h *Contract) DisableTwoFactorUserAct(w http.ResponseWriter, r *http.Request) {
+	var (
+		err            error
+		ctx            = r.Context()
+		userIdentifier = bootstrap.GetUserIdentifierFromToken(ctx, r)
+		m              = model.Contract{App: h.App}
+		req            = request.TwoFactorCodeReq{}
+	)
+
+	// Bind and validate
+	if err = h.BindAndValidate(r, &req); err != nil {
+		h.SendBindAndValidateError(w, err)
+		return
+	}
+
+	err = m.DisableTwoFactor(h.DB, ctx, userIdentifier, req.Code)
 	if err != nil {
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, err)
 		return
 	}
 
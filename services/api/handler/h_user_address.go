@@ -1,8 +1,8 @@
 package handler
 
 import (
-	"context"
 	"go-skeleton/bootstrap"
+	"go-skeleton/lib/apperr"
 	"go-skeleton/lib/utils"
 	"go-skeleton/services/api/model"
 	"go-skeleton/services/api/request"
@@ -15,7 +15,7 @@ import (
 func (h *Contract) GetAddressByAddressIdentifier(w http.ResponseWriter, r *http.Request) {
 	var (
 		err               error
-		ctx               = context.TODO()
+		ctx               = r.Context()
 		m                 = model.Contract{App: h.App}
 		dataUserAddress   = model.UserAddressEnt{}
 		res               = response.UserAddressRes{}
@@ -26,11 +26,11 @@ func (h *Contract) GetAddressByAddressIdentifier(w http.ResponseWriter, r *http.
 	dataUserAddress, err = m.GetAddressByAddressIdentifier(h.DB, ctx, addressIdentifier)
 	if err != nil {
 		// if empty data still success response
-		if err.Error() == utils.EmptyData {
+		if apperr.IsKind(err, apperr.NotFound) {
 			h.SendEmptyDataSuccess(w, res, nil)
 			return
 		}
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, err)
 		return
 	}
 
@@ -50,7 +50,7 @@ func (h *Contract) GetAddressByAddressIdentifier(w http.ResponseWriter, r *http.
 func (h *Contract) GetAllAddressesByUserIdentifier(w http.ResponseWriter, r *http.Request) {
 	var (
 		err            error
-		ctx            = context.TODO()
+		ctx            = r.Context()
 		m              = model.Contract{App: h.App}
 		dataUser       = model.UserEnt{}
 		res            = []response.UserAddressRes{}
@@ -59,7 +59,7 @@ func (h *Contract) GetAllAddressesByUserIdentifier(w http.ResponseWriter, r *htt
 
 	dataUser, err = m.GetUserByUserIdentifier(h.DB, ctx, userIdentifier)
 	if err != nil {
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, err)
 		return
 	}
 
@@ -67,11 +67,11 @@ func (h *Contract) GetAllAddressesByUserIdentifier(w http.ResponseWriter, r *htt
 	dataUserAddresses, err := m.GetUserAddressesByUserID(h.DB, ctx, int64(dataUser.ID))
 	if err != nil {
 		// if empty data still success response
-		if err.Error() == utils.EmptyData {
+		if apperr.IsKind(err, apperr.NotFound) {
 			h.SendEmptyDataSuccess(w, res, nil)
 			return
 		}
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, err)
 		return
 	}
 
@@ -93,7 +93,7 @@ func (h *Contract) GetAllAddressesByUserIdentifier(w http.ResponseWriter, r *htt
 func (h *Contract) InsertUserAddressAct(w http.ResponseWriter, r *http.Request) {
 	var (
 		err            error
-		ctx            = context.TODO()
+		ctx            = r.Context()
 		req            = request.UserAddressReq{}
 		m              = model.Contract{App: h.App}
 		userIdentifier = bootstrap.GetUserIdentifierFromToken(ctx, r)
@@ -108,7 +108,7 @@ func (h *Contract) InsertUserAddressAct(w http.ResponseWriter, r *http.Request)
 
 	dataUser, err = m.GetUserByUserIdentifier(h.DB, ctx, userIdentifier)
 	if err != nil {
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, err)
 		return
 	}
 
@@ -116,7 +116,7 @@ func (h *Contract) InsertUserAddressAct(w http.ResponseWriter, r *http.Request)
 	addressIdentifier := utils.GeneratePrefixCode(utils.UserAddressPrefix)
 	err = m.InsertUserAddress(h.DB, ctx, int64(dataUser.ID), addressIdentifier, req.Title, req.FullAddress)
 	if err != nil {
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, err)
 		return
 	}
 
@@ -127,7 +127,7 @@ func (h *Contract) InsertUserAddressAct(w http.ResponseWriter, r *http.Request)
 func (h *Contract) UpdateUserAddressAct(w http.ResponseWriter, r *http.Request) {
 	var (
 		err               error
-		ctx               = context.TODO()
+		ctx               = r.Context()
 		req               = request.UserAddressReq{}
 		m                 = model.Contract{App: h.App}
 		addressIdentifier = chi.URLParam(r, "code")
@@ -143,13 +143,13 @@ func (h *Contract) UpdateUserAddressAct(w http.ResponseWriter, r *http.Request)
 
 	dataUser, err = m.GetUserByUserIdentifier(h.DB, ctx, userIdentifier)
 	if err != nil {
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, err)
 		return
 	}
 
 	err = m.UpdateUserAddress(h.DB, ctx, int64(dataUser.ID), addressIdentifier, req.Title, req.FullAddress)
 	if err != nil {
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, err)
 		return
 	}
 
@@ -160,7 +160,7 @@ func (h *Contract) UpdateUserAddressAct(w http.ResponseWriter, r *http.Request)
 func (h *Contract) DeleteUserAddressAct(w http.ResponseWriter, r *http.Request) {
 	var (
 		err               error
-		ctx               = context.TODO()
+		ctx               = r.Context()
 		m                 = model.Contract{App: h.App}
 		addressIdentifier = chi.URLParam(r, "code")
 		userIdentifier    = bootstrap.GetUserIdentifierFromToken(ctx, r)
@@ -169,13 +169,13 @@ func (h *Contract) DeleteUserAddressAct(w http.ResponseWriter, r *http.Request)
 
 	dataUser, err = m.GetUserByUserIdentifier(h.DB, ctx, userIdentifier)
 	if err != nil {
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, err)
 		return
 	}
 
 	err = m.DeleteUserAddress(h.DB, ctx, int64(dataUser.ID), addressIdentifier)
 	if err != nil {
-		h.SendBadRequest(w, err.Error())
+		h.SendError(w, err)
 		return
 	}
 
@@ -1,27 +1,59 @@
 package model
 
 import (
+	"context"
 	"errors"
 	"go-skeleton/bootstrap"
+	"go-skeleton/lib/apperr"
+	"go-skeleton/lib/logger"
 	"go-skeleton/lib/utils"
 
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
 	"github.com/sirupsen/logrus"
 )
 
+// postgres error codes
+const (
+	pgUniqueViolation = "23505" // duplicate key
+	pgQueryCanceled   = "57014" // statement_timeout reached
+)
+
 type Contract struct {
 	*bootstrap.App
 }
 
-func (c *Contract) errHandler(funcName string, err error, returnMsg string) error {
+// errHandler turn a database error into an *apperr.Error with returnMsg as the user message,
+// an error that is already an *apperr.Error is returned as is. The unexpected errors are
+// logged with the request fields of ctx.
+func (c *Contract) errHandler(ctx context.Context, funcName string, err error, returnMsg string) error {
+	if _, ok := apperr.As(err); ok {
+		return err
+	}
+
 	if errors.Is(err, pgx.ErrNoRows) {
-		return errors.New(utils.EmptyData)
+		return apperr.Wrap(err, apperr.NotFound, apperr.CodeEmptyData, utils.EmptyData)
 	}
 
-	c.Log.FromDefault().WithFields(logrus.Fields{
+	// the request was cancelled by the client or reached its timeout
+	if ctxErr, ok := apperr.FromContext(err); ok {
+		return ctxErr
+	}
+
+	logger.FromContext(ctx).WithFields(logrus.Fields{
 		"functionName": funcName,
 		"error":        err,
 	}).Errorf("Error message : %s", err.Error())
 
-	return errors.New(returnMsg)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgUniqueViolation:
+			return apperr.Wrap(err, apperr.Conflict, apperr.CodeConflict, returnMsg)
+		case pgQueryCanceled:
+			return apperr.Wrap(err, apperr.Timeout, apperr.CodeTimeout, utils.ErrRequestTimeout)
+		}
+	}
+
+	return apperr.Wrap(err, apperr.Internal, apperr.CodeInternal, returnMsg)
 }
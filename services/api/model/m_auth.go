@@ -2,48 +2,51 @@ package model
 
 import (
 	"context"
-	"errors"
 	"go-skeleton/bootstrap"
+	"go-skeleton/lib/apperr"
 	"go-skeleton/lib/mail"
+	"go-skeleton/lib/outbox"
 	"go-skeleton/lib/utils"
 	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func (c *Contract) GenerateTokenJWT(userIdentifier, actorType, email string) (string, int64, error) {
+// GenerateTokenJWT sign the access token of the session, the role and its permissions are
+// carried in the claims so they're refreshed with the token
+func (c *Contract) GenerateTokenJWT(user UserEnt, actorType, sessionIdentifier string, permissions []string) (string, int64, error) {
 	var (
 		token string
 		expAt int64
 		err   error
 	)
 
-	key := c.Config.GetString("app.key")
-	if len(key) == 0 {
-		return token, expAt, errors.New(utils.ErrConfigKeyNotFound)
-	}
-	// 7 month duration
-	expAt = time.Now().UTC().AddDate(7, 0, 0).Unix()
+	// short lived access token, renewed with the refresh token
+	expAt = time.Now().UTC().Add(c.accessTokenTTL()).Unix()
 	claims := &bootstrap.CustomUserClaims{
-		UserIdentifier: userIdentifier,
-		Email:          email,
+		UserIdentifier:    user.UserIdentifier,
+		Email:             user.Email,
+		SessionIdentifier: sessionIdentifier,
+		Role:              user.Role,
+		Permissions:       permissions,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expAt,
 			Issuer:    actorType,
 		},
 	}
-	rawToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	token, err = rawToken.SignedString([]byte(key))
+	token, err = c.JWTKeys.Sign(claims)
 	if err != nil {
 		return token, expAt, err
 	}
 	return token, expAt, nil
 }
 
-func (c *Contract) RegisterUser(db *pgxpool.Pool, ctx context.Context, firstName, lastName, email, password string) (string, string, error) {
+// RegisterUser create the user, locale is the preferred language of its mails (empty for app.locale)
+func (c *Contract) RegisterUser(db *pgxpool.Pool, ctx context.Context, firstName, lastName, email, password, locale string) (string, string, error) {
 	var (
 		err           error
 		id            int64
@@ -56,65 +59,97 @@ func (c *Contract) RegisterUser(db *pgxpool.Pool, ctx context.Context, firstName
 		passwordHash, _ = bcrypt.GenerateFromPassword([]byte(password), 14)
 	)
 
+	// the user and its user.registered event are committed together
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return userIdentifier, email, c.errHandler(ctx, "model.RegisterUser", err, utils.ErrBeginningTransaction)
+	}
+	defer tx.Rollback(ctx)
+
 	// Insert user data into 'users' table
-	userInsertSQL = `INSERT INTO users (user_identifier, first_name, last_name, email, password, is_verify, created_date) 
-        VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id`
-	err = db.QueryRow(ctx, userInsertSQL, userIdentifier, firstName, lastName, email, passwordHash, false, time.Now().In(time.UTC)).Scan(&id)
+	userInsertSQL = `INSERT INTO users (user_identifier, first_name, last_name, email, password, is_verify, created_date, role_id, locale) 
+        VALUES($1, $2, $3, $4, $5, $6, $7, (SELECT id FROM roles WHERE role_code = $8), NULLIF($9, '')) RETURNING id`
+	err = tx.QueryRow(ctx, userInsertSQL, userIdentifier, firstName, lastName, email, passwordHash, false, time.Now().In(time.UTC), utils.RoleUser, locale).Scan(&id)
 	if err != nil {
 		// Handle specific error cases
 		switch {
 		case strings.Contains(err.Error(), "users_email_key"):
-			return userIdentifier, email, errors.New(utils.ErrEmailAlreadyRegistered)
+			return userIdentifier, email, apperr.New(apperr.Conflict, apperr.CodeEmailAlreadyRegistered, utils.ErrEmailAlreadyRegistered)
 		// Add other specific error cases here if needed
 		default:
-			return userIdentifier, email, c.errHandler("model.RegisterUser", err, utils.ErrInsertingUser)
+			return userIdentifier, email, c.errHandler(ctx, "model.RegisterUser", err, utils.ErrInsertingUser)
 		}
 	}
 
+	err = outbox.Add(ctx, tx, outbox.Event{
+		Type:          utils.EventUserRegistered,
+		AggregateType: utils.AggregateUser,
+		AggregateID:   userIdentifier,
+		Data: map[string]interface{}{
+			"user_identifier": userIdentifier,
+			"email":           email,
+			"first_name":      firstName,
+			"last_name":       lastName,
+		},
+	})
+	if err != nil {
+		return userIdentifier, email, c.errHandler(ctx, "model.RegisterUser", err, utils.ErrInsertingUser)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return userIdentifier, email, c.errHandler(ctx, "model.RegisterUser", err, utils.ErrCommittingTransaction)
+	}
+
 	return userIdentifier, email, nil
 }
 
-func (c *Contract) UserLogin(db *pgxpool.Pool, ctx context.Context, email, password string) (UserEnt, int64, string, error) {
+func (c *Contract) UserLogin(db *pgxpool.Pool, ctx context.Context, email, password string) (UserEnt, TokenEnt, error) {
 	var (
 		err      error
 		userData UserEnt
-		expAt    int64
-		jwtToken string
+		token    TokenEnt
 	)
 
+	// Refuse the login while the account is locked by too many failed attempts
+	if c.LoginLockTTL(ctx, email) > 0 {
+		return userData, token, apperr.New(apperr.TooManyRequests, apperr.CodeAccountLocked, utils.ErrAccountLocked)
+	}
+
 	// Get user data by email
 	userData, err = c.GetUserByEmail(db, ctx, email)
 	if err != nil {
-		if err.Error() == utils.EmptyData {
-			return userData, expAt, jwtToken, errors.New(utils.ErrInvalidEmailPassword)
+		if apperr.IsKind(err, apperr.NotFound) {
+			c.registerLoginFailure(ctx, email)
+			return userData, token, apperr.New(apperr.Unauthorized, apperr.CodeInvalidCredentials, utils.ErrInvalidEmailPassword)
 		}
-		return userData, expAt, jwtToken, c.errHandler("model.UserLogin", err, err.Error())
+		return userData, token, c.errHandler(ctx, "model.UserLogin", err, err.Error())
 	}
 
 	// If email is not verified
 	if !userData.IsVerified {
-		return userData, expAt, jwtToken, errors.New(utils.ErrEmailNotVerified)
+		return userData, token, apperr.New(apperr.Forbidden, apperr.CodeEmailNotVerified, utils.ErrEmailNotVerified)
 	}
 
 	dataPassword := []byte(userData.Password)
 	err = bcrypt.CompareHashAndPassword(dataPassword, []byte(password))
 	if err != nil {
-		return userData, expAt, jwtToken, errors.New(utils.ErrInvalidEmailPassword)
+		c.registerLoginFailure(ctx, email)
+		return userData, token, apperr.New(apperr.Unauthorized, apperr.CodeInvalidCredentials, utils.ErrInvalidEmailPassword)
 	}
+	c.resetLoginFailure(ctx, email)
 
-	// Generate JWT Token
-	jwtToken, expAt, err = c.GenerateTokenJWT(userData.UserIdentifier, utils.User, email)
+	// Create session with access and refresh token, or the 2FA challenge
+	token, err = c.loginToken(db, ctx, userData, utils.User)
 	if err != nil {
-		return userData, expAt, jwtToken, c.errHandler("model.UserLogin", err, utils.ErrGeneratingJWT)
+		return userData, token, err
 	}
 
-	return userData, expAt, jwtToken, nil
+	return userData, token, nil
 }
 
-func (c *Contract) CheckTokenAndExpiration(db *pgxpool.Pool, ctx context.Context, verificationType, actorType, token string) (UserEnt, int64, string, error) {
+func (c *Contract) CheckTokenAndExpiration(db *pgxpool.Pool, ctx context.Context, verificationType, actorType, token string) (UserEnt, TokenEnt, error) {
 	var (
-		jwtToken                string
-		expAt                   int64
+		sessionToken            TokenEnt
 		checkVerificationSQL    string
 		updateVerificationSQL   string
 		email                   string
@@ -128,35 +163,30 @@ func (c *Contract) CheckTokenAndExpiration(db *pgxpool.Pool, ctx context.Context
 	checkVerificationSQL = `SELECT email, expired_date, is_used FROM verifications WHERE token = $1 AND verification_type = $2`
 	err = db.QueryRow(ctx, checkVerificationSQL, token, verificationType).Scan(&email, &expiredDateVerification, &isUsedData)
 	if err != nil {
-		return dataUser, expAt, jwtToken, c.errHandler("model.CheckTokenAndExpiredForgotPassword", err, utils.ErrGettingVerificationsData)
+		return dataUser, sessionToken, c.errHandler(ctx, "model.CheckTokenAndExpiredForgotPassword", err, utils.ErrGettingVerificationsData)
 	}
 
 	// Check if token is used
 	if isUsedData {
-		return dataUser, expAt, jwtToken, errors.New(utils.ErrTokenUsed)
+		return dataUser, sessionToken, apperr.New(apperr.Validation, apperr.CodeTokenUsed, utils.ErrTokenUsed)
 	}
 
 	// Check if token is expired
 	if expiredDateVerification.Before(time.Now().UTC()) {
-		return dataUser, expAt, jwtToken, errors.New(utils.ErrTokenExpired)
+		return dataUser, sessionToken, apperr.New(apperr.Unauthorized, apperr.CodeTokenExpired, utils.ErrTokenExpired)
 	}
 
 	if actorType == utils.User {
 		// Get data user for create jwt token
 		dataUser, err = c.GetUserByEmail(db, ctx, email)
 		if err != nil {
-			return dataUser, expAt, jwtToken, c.errHandler("model.CheckTokenAndExpiration", err, utils.ErrGettingUserData)
+			return dataUser, sessionToken, c.errHandler(ctx, "model.CheckTokenAndExpiration", err, utils.ErrGettingUserData)
 		}
 	}
-	// Generate JWT Token
-	jwtToken, expAt, err = c.GenerateTokenJWT(dataUser.UserIdentifier, utils.User, email)
-	if err != nil {
-		return dataUser, expAt, jwtToken, c.errHandler("model.CheckTokenAndExpiration", err, utils.ErrGeneratingJWT)
-	}
 	// Start a transaction
 	tx, err := db.Begin(ctx)
 	if err != nil {
-		return dataUser, expAt, jwtToken, c.errHandler("model.CheckTokenAndExpiration", err, utils.ErrBeginningTransaction)
+		return dataUser, sessionToken, c.errHandler(ctx, "model.CheckTokenAndExpiration", err, utils.ErrBeginningTransaction)
 	}
 
 	// Update the verification record to mark it as used
@@ -164,7 +194,7 @@ func (c *Contract) CheckTokenAndExpiration(db *pgxpool.Pool, ctx context.Context
 	_, err = tx.Exec(ctx, updateVerificationSQL, true, token)
 	if err != nil {
 		tx.Rollback(ctx)
-		return dataUser, expAt, jwtToken, c.errHandler("model.CheckTokenAndExpiredForgotPassword", err, utils.ErrMarkingToken)
+		return dataUser, sessionToken, c.errHandler(ctx, "model.CheckTokenAndExpiredForgotPassword", err, utils.ErrMarkingToken)
 	}
 
 	switch verificationType {
@@ -179,7 +209,7 @@ func (c *Contract) CheckTokenAndExpiration(db *pgxpool.Pool, ctx context.Context
 		_, err := tx.Exec(ctx, sql, email, true, dataUser.UserIdentifier)
 		if err != nil {
 			tx.Rollback(ctx)
-			return dataUser, expAt, jwtToken, c.errHandler("model.CheckTokenAndExpiredForgotPassword", err, utils.ErrUpdatingUserEmail)
+			return dataUser, sessionToken, c.errHandler(ctx, "model.CheckTokenAndExpiredForgotPassword", err, utils.ErrUpdatingUserEmail)
 		}
 	// Check is type of verify email
 	case utils.VerifyRegistration:
@@ -192,17 +222,41 @@ func (c *Contract) CheckTokenAndExpiration(db *pgxpool.Pool, ctx context.Context
 		_, err := tx.Exec(ctx, sql, true, dataUser.UserIdentifier)
 		if err != nil {
 			tx.Rollback(ctx)
-			return dataUser, expAt, jwtToken, c.errHandler("model.CheckTokenAndExpiredForgotPassword", err, utils.ErrUpdatingUserEmailStatus)
+			return dataUser, sessionToken, c.errHandler(ctx, "model.CheckTokenAndExpiredForgotPassword", err, utils.ErrUpdatingUserEmailStatus)
+		}
+	}
+
+	// the new or registered email is verified
+	if verificationType == utils.UpdateEmail || verificationType == utils.VerifyRegistration {
+		err = outbox.Add(ctx, tx, outbox.Event{
+			Type:          utils.EventUserEmailVerified,
+			AggregateType: utils.AggregateUser,
+			AggregateID:   dataUser.UserIdentifier,
+			Data: map[string]interface{}{
+				"user_identifier":   dataUser.UserIdentifier,
+				"email":             email,
+				"verification_type": verificationType,
+			},
+		})
+		if err != nil {
+			tx.Rollback(ctx)
+			return dataUser, sessionToken, c.errHandler(ctx, "model.CheckTokenAndExpiration", err, utils.ErrUpdatingUserEmailStatus)
 		}
 	}
 
 	// Commit the transaction
 	if err := tx.Commit(ctx); err != nil {
 		tx.Rollback(ctx)
-		return dataUser, expAt, jwtToken, c.errHandler("model.CheckTokenAndExpiredForgotPassword", err, utils.ErrCommittingTransaction)
+		return dataUser, sessionToken, c.errHandler(ctx, "model.CheckTokenAndExpiredForgotPassword", err, utils.ErrCommittingTransaction)
+	}
+
+	// Create session with access and refresh token, or the 2FA challenge
+	sessionToken, err = c.loginToken(db, ctx, dataUser, utils.User)
+	if err != nil {
+		return dataUser, sessionToken, err
 	}
 
-	return dataUser, expAt, jwtToken, nil
+	return dataUser, sessionToken, nil
 }
 
 func (c *Contract) RequestForgotPassword(db *pgxpool.Pool, ctx context.Context, email string) error {
@@ -224,19 +278,29 @@ func (c *Contract) RequestForgotPassword(db *pgxpool.Pool, ctx context.Context,
 	// Check email and get user data
 	userData, err := c.GetUserByEmail(db, ctx, email)
 	if err != nil {
-		return c.errHandler("model.RequestForgotPassword", err, utils.ErrInvalidEmailPassword)
+		return c.errHandler(ctx, "model.RequestForgotPassword", err, utils.ErrInvalidEmailPassword)
 	}
 
-	// Sending Forgot Password Mail
-	err = mailContract.SendMail(mail.UserForgotPassword, mail.MailSubj[mail.UserForgotPassword], email, mail.EmailData{Name: userData.FirstName, Email: email, Link: linkNewPass})
+	tx, err := db.Begin(ctx)
 	if err != nil {
-		return c.errHandler("model.RequestForgotPassword", err, utils.ErrSendingResetPasswordEmail)
+		return c.errHandler(ctx, "model.RequestForgotPassword", err, utils.ErrBeginningTransaction)
 	}
+	defer tx.Rollback(ctx)
 
 	// Insert verification data into 'verifications' table
-	err = c.insertVerificationData(db, ctx, utils.User, utils.ForgotPassword, email, token, false, expAt)
+	err = c.insertVerificationData(tx, ctx, utils.User, utils.ForgotPassword, email, token, false, expAt)
 	if err != nil {
-		return c.errHandler("model.RequestForgotPassword", err, utils.ErrAddingResetPasswordVerification)
+		return c.errHandler(ctx, "model.RequestForgotPassword", err, utils.ErrAddingResetPasswordVerification)
+	}
+
+	// Queue the Forgot Password Mail, it's sent by the mail sender
+	err = mailContract.Enqueue(ctx, tx, mail.UserForgotPassword, mailContract.Locale(userData.Locale.String), email, mail.EmailData{Name: userData.FirstName, Email: email, Link: linkNewPass})
+	if err != nil {
+		return c.errHandler(ctx, "model.RequestForgotPassword", err, utils.ErrSendingResetPasswordEmail)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return c.errHandler(ctx, "model.RequestForgotPassword", err, utils.ErrCommittingTransaction)
 	}
 
 	return nil
@@ -261,73 +325,100 @@ func (c *Contract) RequestVerifyEmailUser(db *pgxpool.Pool, ctx context.Context,
 	// Check email and get user data
 	userData, err := c.GetUserByEmail(db, ctx, email)
 	if err != nil {
-		return c.errHandler("model.RequestVerifyEmailUser", err, utils.ErrInvalidEmailPassword)
+		return c.errHandler(ctx, "model.RequestVerifyEmailUser", err, utils.ErrInvalidEmailPassword)
 	}
 
+	var (
+		usedFor string
+		errMsg  string
+	)
 	switch types {
 	case utils.VerifyRegistration:
-		err = mailContract.SendMail(mail.UserVerifyEmail, mail.MailSubj[mail.UserVerifyEmail], email, mail.EmailData{Name: userData.FirstName, Email: email, Link: link})
-		if err != nil {
-			return c.errHandler("model.RequestVerifyEmailUser", err, utils.ErrSendingVerifyEmail)
-		}
+		usedFor, errMsg = mail.UserVerifyEmail, utils.ErrSendingVerifyEmail
 	case utils.ForgotPassword:
-		err = mailContract.SendMail(mail.UserForgotPassword, mail.MailSubj[mail.UserForgotPassword], email, mail.EmailData{Name: userData.FirstName, Email: email, Link: link})
-		if err != nil {
-			return c.errHandler("model.RequestVerifyEmailUser", err, utils.ErrSendingForgotPasswordEmail)
-		}
+		usedFor, errMsg = mail.UserForgotPassword, utils.ErrSendingForgotPasswordEmail
 	case utils.UpdateEmail:
-		err = mailContract.SendMail(mail.UserUpdateEmail, mail.MailSubj[mail.UserUpdateEmail], email, mail.EmailData{Name: userData.FirstName, Email: email, Link: link})
-		if err != nil {
-			return c.errHandler("model.RequestVerifyEmailUser", err, utils.ErrSendingUpdateEmail)
-		}
+		usedFor, errMsg = mail.UserUpdateEmail, utils.ErrSendingUpdateEmail
 	default:
-		return errors.New(utils.ErrInvalidSendingEmailType)
+		return apperr.New(apperr.Validation, apperr.CodeInvalidEmailType, utils.ErrInvalidSendingEmailType)
 	}
 
-	err = c.insertVerificationData(db, ctx, utils.User, types, email, token, false, expAt)
+	tx, err := db.Begin(ctx)
 	if err != nil {
-		return c.errHandler("model.RequestVerifyEmailUser", err, utils.ErrAddingResetPasswordVerification)
+		return c.errHandler(ctx, "model.RequestVerifyEmailUser", err, utils.ErrBeginningTransaction)
+	}
+	defer tx.Rollback(ctx)
+
+	err = c.insertVerificationData(tx, ctx, utils.User, types, email, token, false, expAt)
+	if err != nil {
+		return c.errHandler(ctx, "model.RequestVerifyEmailUser", err, utils.ErrAddingResetPasswordVerification)
+	}
+
+	// Queue the mail, it's sent by the mail sender
+	err = mailContract.Enqueue(ctx, tx, usedFor, mailContract.Locale(userData.Locale.String), email, mail.EmailData{Name: userData.FirstName, Email: email, Link: link})
+	if err != nil {
+		return c.errHandler(ctx, "model.RequestVerifyEmailUser", err, errMsg)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return c.errHandler(ctx, "model.RequestVerifyEmailUser", err, utils.ErrCommittingTransaction)
 	}
 
 	return nil
 }
 
-func (c *Contract) ResetPassword(db *pgxpool.Pool, ctx context.Context, userIdentifier, NewPassword, ConfirmPassword string) error {
+func (c *Contract) ResetPassword(db *pgxpool.Pool, ctx context.Context, userIdentifier, sessionIdentifier, NewPassword, ConfirmPassword string) error {
 	var (
 		err      error
 		dataUser UserEnt
 	)
 	// Check if new password matches the confirmation
 	if NewPassword != ConfirmPassword {
-		return errors.New(utils.ErrPasswordMismatch)
+		return apperr.New(apperr.Validation, apperr.CodePasswordMismatch, utils.ErrPasswordMismatch)
 	}
 
 	dataUser, err = c.GetUserByUserIdentifier(db, ctx, userIdentifier)
 	if err != nil {
-		return c.errHandler("model.UpdatePassword", err, utils.ErrFetchingUserPassword)
+		return c.errHandler(ctx, "model.UpdatePassword", err, utils.ErrFetchingUserPassword)
 	}
 
 	// Hash the new password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(NewPassword), 14)
 	if err != nil {
-		return c.errHandler("model.UpdatePassword", err, utils.ErrHashingPassword)
+		return c.errHandler(ctx, "model.UpdatePassword", err, utils.ErrHashingPassword)
 	}
 
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return c.errHandler(ctx, "model.UpdatePassword", err, utils.ErrBeginningTransaction)
+	}
+	defer tx.Rollback(ctx)
+
 	// Update the user's password in the database
 	sql := "UPDATE users SET password = $1, updated_date = $3 WHERE id = $2"
-	_, err = db.Exec(ctx, sql, string(hashedPassword), dataUser.ID, time.Now().UTC())
+	_, err = tx.Exec(ctx, sql, string(hashedPassword), dataUser.ID, time.Now().UTC())
+	if err != nil {
+		return c.errHandler(ctx, "model.UpdatePassword", err, utils.ErrUpdatingUserPassword)
+	}
+
+	// the other sessions, e.g. of a stolen refresh token, don't survive the new password
+	err = c.revokeOtherSessions(tx, ctx, dataUser.ID, sessionIdentifier)
 	if err != nil {
-		return c.errHandler("model.UpdatePassword", err, utils.ErrUpdatingUserPassword)
+		return c.errHandler(ctx, "model.UpdatePassword", err, utils.ErrRevokingSession)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return c.errHandler(ctx, "model.UpdatePassword", err, utils.ErrCommittingTransaction)
 	}
 
 	return nil
 }
 
-func (c *Contract) insertVerificationData(db *pgxpool.Pool, ctx context.Context, actorType, verificationType, email, token string, isUsed bool, expiredDate time.Time) error {
+func (c *Contract) insertVerificationData(tx pgx.Tx, ctx context.Context, actorType, verificationType, email, token string, isUsed bool, expiredDate time.Time) error {
 	sql := `INSERT INTO verifications(actor_type, verification_type, email, token, is_used, expired_date, created_date)
         VALUES($1, $2, $3, $4, $5, $6, $7)`
 
-	_, err := db.Exec(ctx, sql, actorType, verificationType, email, token, isUsed, expiredDate, time.Now().In(time.UTC))
+	_, err := tx.Exec(ctx, sql, actorType, verificationType, email, token, isUsed, expiredDate, time.Now().In(time.UTC))
 	if err != nil {
 		return err
 	}
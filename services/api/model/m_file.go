@@ -0,0 +1,250 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"go-skeleton/lib/apperr"
+	"go-skeleton/lib/utils"
+	"go-skeleton/services/api/request"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Visibility of the files
+const (
+	FileVisibilityPublic  = "public"
+	FileVisibilityPrivate = "private"
+)
+
+type FileEnt struct {
+	Id             int64         `db:"id"`
+	FileIdentifier string        `db:"file_identifier"`
+	UserId         int64         `db:"user_id"`
+	UserIdentifier string        `db:"user_identifier"`
+	StorageKey     string        `db:"storage_key"`
+	OriginalName   string        `db:"original_name"`
+	MimeType       string        `db:"mime_type"`
+	Size           int64         `db:"size"`
+	Visibility     string        `db:"visibility"`
+	Sha256         string        `db:"sha256"`
+	Width          int           `db:"width"`
+	Height         int           `db:"height"`
+	Variants       []FileVariant `db:"variants"`
+	CreatedDate    time.Time     `db:"created_date"`
+	DeletedDate    sql.NullTime  `db:"deleted_date"`
+}
+
+// FileVariant a thumbnail of an image file, stored next to it
+type FileVariant struct {
+	Size        int    `json:"size"`
+	Key         string `json:"key"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"content_type"`
+}
+
+const fileColumns = `f.id, f.file_identifier, f.user_id, u.user_identifier, f.storage_key, f.original_name, f.mime_type,
+		f.size, f.visibility, f.sha256, COALESCE(f.width, 0), COALESCE(f.height, 0), f.variants, f.created_date, f.deleted_date`
+
+// scanFile the row of fileColumns
+func scanFile(row pgx.Row) (FileEnt, error) {
+	var (
+		data     FileEnt
+		variants []byte
+	)
+
+	err := row.Scan(&data.Id, &data.FileIdentifier, &data.UserId, &data.UserIdentifier, &data.StorageKey, &data.OriginalName,
+		&data.MimeType, &data.Size, &data.Visibility, &data.Sha256, &data.Width, &data.Height, &variants, &data.CreatedDate, &data.DeletedDate)
+	if err != nil {
+		return data, err
+	}
+	if err = json.Unmarshal(variants, &data.Variants); err != nil {
+		return data, err
+	}
+
+	return data, nil
+}
+
+// InsertFile record the file uploaded by the user, a Conflict error when the user already has
+// a live file of the same content and visibility
+func (c *Contract) InsertFile(db *pgxpool.Pool, ctx context.Context, userIdentifier string, file FileEnt) (FileEnt, error) {
+	var (
+		err error
+		sql = `INSERT INTO files (file_identifier, user_id, storage_key, original_name, mime_type, size, visibility, sha256,
+			width, height, variants, created_date)
+		SELECT $1, id, $3, $4, $5, $6, $7, $8, NULLIF($9, 0), NULLIF($10, 0), $11, $12 FROM users WHERE user_identifier = $2 AND deleted_date IS NULL
+		RETURNING id, user_id`
+	)
+
+	if file.Variants == nil {
+		file.Variants = []FileVariant{}
+	}
+	variants, err := json.Marshal(file.Variants)
+	if err != nil {
+		return file, c.errHandler(ctx, "model.InsertFile", err, utils.ErrInsertingFile)
+	}
+
+	file.FileIdentifier = utils.GeneratePrefixCode(utils.FilePrefix)
+	file.UserIdentifier = userIdentifier
+	file.CreatedDate = time.Now().UTC()
+
+	err = db.QueryRow(ctx, sql, file.FileIdentifier, userIdentifier, file.StorageKey, file.OriginalName, file.MimeType,
+		file.Size, file.Visibility, file.Sha256, file.Width, file.Height, variants, file.CreatedDate).Scan(&file.Id, &file.UserId)
+	if err != nil {
+		return file, c.errHandler(ctx, "model.InsertFile", err, utils.ErrInsertingFile)
+	}
+
+	return file, nil
+}
+
+func (c *Contract) GetFileByCode(db *pgxpool.Pool, ctx context.Context, code string) (FileEnt, error) {
+	var (
+		err  error
+		data FileEnt
+		sql  = `SELECT ` + fileColumns + `
+		FROM files f
+		JOIN users u ON u.id = f.user_id
+		WHERE f.file_identifier = $1 AND f.deleted_date IS NULL`
+	)
+
+	data, err = scanFile(db.QueryRow(ctx, sql, code))
+	if err != nil {
+		return data, c.errHandler(ctx, "model.GetFileByCode", err, utils.ErrGettingFileByCode)
+	}
+
+	return data, nil
+}
+
+func (c *Contract) GetFileByID(db *pgxpool.Pool, ctx context.Context, id int64) (FileEnt, error) {
+	var (
+		err  error
+		data FileEnt
+		sql  = `SELECT ` + fileColumns + `
+		FROM files f
+		JOIN users u ON u.id = f.user_id
+		WHERE f.id = $1 AND f.deleted_date IS NULL`
+	)
+
+	data, err = scanFile(db.QueryRow(ctx, sql, id))
+	if err != nil {
+		return data, c.errHandler(ctx, "model.GetFileByID", err, utils.ErrGettingFileByCode)
+	}
+
+	return data, nil
+}
+
+// GetFileByHash the live file of the user with the content and visibility
+func (c *Contract) GetFileByHash(db *pgxpool.Pool, ctx context.Context, userIdentifier, sha256, visibility string) (FileEnt, error) {
+	var (
+		err  error
+		data FileEnt
+		sql  = `SELECT ` + fileColumns + `
+		FROM files f
+		JOIN users u ON u.id = f.user_id
+		WHERE u.user_identifier = $1 AND f.sha256 = $2 AND f.visibility = $3 AND f.deleted_date IS NULL`
+	)
+
+	data, err = scanFile(db.QueryRow(ctx, sql, userIdentifier, sha256, visibility))
+	if err != nil {
+		return data, c.errHandler(ctx, "model.GetFileByHash", err, utils.ErrGettingFileByHash)
+	}
+
+	return data, nil
+}
+
+// GetFilesByUser the live files of the user
+func (c *Contract) GetFilesByUser(db *pgxpool.Pool, ctx context.Context, userIdentifier string, param *request.FileParam) ([]FileEnt, error) {
+	var (
+		err        error
+		list       []FileEnt
+		where      = []string{"u.user_identifier = $1", "f.deleted_date IS NULL"}
+		paramQuery = []interface{}{userIdentifier}
+		totalData  int
+
+		query = `SELECT ` + fileColumns + ` FROM files f JOIN users u ON u.id = f.user_id`
+	)
+
+	// Populate Search
+	if len(param.Keyword) > 0 {
+		paramQuery = append(paramQuery, "%"+param.Keyword+"%")
+		where = append(where, fmt.Sprintf("f.original_name iLIKE $%d", len(paramQuery)))
+	}
+	if len(param.Visibility) > 0 {
+		paramQuery = append(paramQuery, param.Visibility)
+		where = append(where, fmt.Sprintf("f.visibility = $%d", len(paramQuery)))
+	}
+	if len(param.MimeType) > 0 {
+		paramQuery = append(paramQuery, param.MimeType)
+		where = append(where, fmt.Sprintf("f.mime_type = $%d", len(paramQuery)))
+	}
+
+	// Append All Where Conditions
+	query += " WHERE " + strings.Join(where, " AND ")
+
+	{
+		newQcount := `SELECT COUNT(*) FROM ( ` + query + ` ) AS data`
+		err := db.QueryRow(ctx, newQcount, paramQuery...).Scan(&totalData)
+		if err != nil {
+			return list, c.errHandler(ctx, "model.GetFilesByUser", err, utils.ErrCountingListFile)
+		}
+		param.Count = totalData
+	}
+
+	// Select Max Page
+	if param.Count > param.Limit && param.Page > int(param.Count/param.Limit) {
+		param.Page = int(math.Ceil(float64(param.Count) / float64(param.Limit)))
+	}
+
+	// Limit and Offset
+	param.Offset = (param.Page - 1) * param.Limit
+	query += " ORDER BY f." + param.Order + " " + param.Sort + " "
+
+	paramQuery = append(paramQuery, param.Offset)
+	query += fmt.Sprintf("offset $%d ", len(paramQuery))
+
+	paramQuery = append(paramQuery, param.Limit)
+	query += fmt.Sprintf("limit $%d ", len(paramQuery))
+
+	rows, err := db.Query(ctx, query, paramQuery...)
+	if err != nil {
+		return list, c.errHandler(ctx, "model.GetFilesByUser", err, utils.ErrGettingListFile)
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		data, err := scanFile(rows)
+		if err != nil {
+			return list, c.errHandler(ctx, "model.GetFilesByUser", err, utils.ErrScanningListFile)
+		}
+		list = append(list, data)
+	}
+	if err = rows.Err(); err != nil {
+		return list, c.errHandler(ctx, "model.GetFilesByUser", err, utils.ErrScanningListFile)
+	}
+
+	return list, nil
+}
+
+// DeleteFile soft delete the file of the user, the object is removed from the storage by the
+// files cleanup command after the retention period
+func (c *Contract) DeleteFile(db *pgxpool.Pool, ctx context.Context, userIdentifier, code string) error {
+	sql := `UPDATE files f SET deleted_date = $3
+		FROM users u
+		WHERE u.id = f.user_id AND u.user_identifier = $1 AND f.file_identifier = $2 AND f.deleted_date IS NULL`
+
+	tag, err := db.Exec(ctx, sql, userIdentifier, code, time.Now().UTC())
+	if err != nil {
+		return c.errHandler(ctx, "model.DeleteFile", err, utils.ErrDeletingFile)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperr.New(apperr.NotFound, apperr.CodeEmptyData, utils.EmptyData)
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package model
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"go-skeleton/lib/apperr"
+	"go-skeleton/lib/storage"
+	"go-skeleton/lib/utils"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// FileUploadEnt a resumable upload in progress, the offset is the size of the parts plus the
+// pending bytes received after the last part
+type FileUploadEnt struct {
+	Id               int64          `db:"id"`
+	UploadIdentifier string         `db:"upload_identifier"`
+	UserId           int64          `db:"user_id"`
+	UserIdentifier   string         `db:"user_identifier"`
+	StorageKey       string         `db:"storage_key"`
+	OriginalName     string         `db:"original_name"`
+	MimeType         string         `db:"mime_type"`
+	Visibility       string         `db:"visibility"`
+	Length           int64          `db:"upload_length"`
+	Offset           int64          `db:"upload_offset"`
+	MultipartID      string         `db:"multipart_id"`
+	Parts            []storage.Part `db:"parts"`
+	PendingKey       string         `db:"pending_key"`
+	PendingSize      int64          `db:"pending_size"`
+	HashState        []byte         `db:"hash_state"`
+	ExpiresDate      time.Time      `db:"expires_date"`
+	CreatedDate      time.Time      `db:"created_date"`
+	UpdatedDate      time.Time      `db:"updated_date"`
+}
+
+// PartsSize the bytes stored in the parts
+func (u FileUploadEnt) PartsSize() int64 {
+	var size int64
+	for _, p := range u.Parts {
+		size += p.Size
+	}
+
+	return size
+}
+
+// InsertFileUpload start the resumable upload of the user
+func (c *Contract) InsertFileUpload(db *pgxpool.Pool, ctx context.Context, userIdentifier string, upload FileUploadEnt) (FileUploadEnt, error) {
+	sql := `INSERT INTO file_uploads (upload_identifier, user_id, storage_key, original_name, visibility, upload_length,
+			expires_date, created_date, updated_date)
+		SELECT $1, id, $3, $4, $5, $6, $7, $8, $8 FROM users WHERE user_identifier = $2 AND deleted_date IS NULL
+		RETURNING id, user_id`
+
+	upload.UploadIdentifier = newUploadIdentifier()
+	upload.UserIdentifier = userIdentifier
+	upload.Parts = []storage.Part{}
+	upload.CreatedDate = time.Now().UTC()
+	upload.UpdatedDate = upload.CreatedDate
+
+	err := db.QueryRow(ctx, sql, upload.UploadIdentifier, userIdentifier, upload.StorageKey, upload.OriginalName, upload.Visibility,
+		upload.Length, upload.ExpiresDate, upload.CreatedDate).Scan(&upload.Id, &upload.UserId)
+	if err != nil {
+		return upload, c.errHandler(ctx, "model.InsertFileUpload", err, utils.ErrInsertingFileUpload)
+	}
+
+	return upload, nil
+}
+
+// newUploadIdentifier the identifier of an upload is in its url, it's random so it can't be guessed
+func newUploadIdentifier() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return utils.FileUploadPrefix + hex.EncodeToString(b)
+}
+
+// GetFileUploadByCode the upload of the user, expired or not
+func (c *Contract) GetFileUploadByCode(db *pgxpool.Pool, ctx context.Context, userIdentifier, code string) (FileUploadEnt, error) {
+	var (
+		data  FileUploadEnt
+		parts []byte
+		sql   = `SELECT fu.id, fu.upload_identifier, fu.user_id, u.user_identifier, fu.storage_key, fu.original_name, fu.mime_type,
+				fu.visibility, fu.upload_length, fu.upload_offset, fu.multipart_id, fu.parts, fu.pending_key, fu.pending_size,
+				fu.hash_state, fu.expires_date, fu.created_date, fu.updated_date
+			FROM file_uploads fu
+			JOIN users u ON u.id = fu.user_id
+			WHERE u.user_identifier = $1 AND fu.upload_identifier = $2`
+	)
+
+	err := db.QueryRow(ctx, sql, userIdentifier, code).Scan(&data.Id, &data.UploadIdentifier, &data.UserId, &data.UserIdentifier,
+		&data.StorageKey, &data.OriginalName, &data.MimeType, &data.Visibility, &data.Length, &data.Offset, &data.MultipartID,
+		&parts, &data.PendingKey, &data.PendingSize, &data.HashState, &data.ExpiresDate, &data.CreatedDate, &data.UpdatedDate)
+	if err == nil {
+		err = json.Unmarshal(parts, &data.Parts)
+	}
+	if err != nil {
+		return data, c.errHandler(ctx, "model.GetFileUploadByCode", err, utils.ErrGettingFileUploadByCode)
+	}
+
+	return data, nil
+}
+
+// LockFileUpload reserve the upload to a request until the lock is released or until is
+// reached, a Conflict error when another request holds it
+func (c *Contract) LockFileUpload(db *pgxpool.Pool, ctx context.Context, id int64, until time.Time) error {
+	sql := `UPDATE file_uploads SET locked_until = $2
+		WHERE id = $1 AND (locked_until IS NULL OR locked_until < NOW())`
+
+	tag, err := db.Exec(ctx, sql, id, until)
+	if err != nil {
+		return c.errHandler(ctx, "model.LockFileUpload", err, utils.ErrLockingFileUpload)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperr.New(apperr.Conflict, apperr.CodeUploadLocked, utils.ErrUploadLocked)
+	}
+
+	return nil
+}
+
+// UnlockFileUpload release the lock of LockFileUpload
+func (c *Contract) UnlockFileUpload(db *pgxpool.Pool, ctx context.Context, id int64) error {
+	_, err := db.Exec(ctx, `UPDATE file_uploads SET locked_until = NULL WHERE id = $1`, id)
+	if err != nil {
+		return c.errHandler(ctx, "model.UnlockFileUpload", err, utils.ErrLockingFileUpload)
+	}
+
+	return nil
+}
+
+// UpdateFileUploadProgress save the parts, the pending bytes and the offset after they're
+// stored, the expiry is pushed back by every progress
+func (c *Contract) UpdateFileUploadProgress(db *pgxpool.Pool, ctx context.Context, upload FileUploadEnt) error {
+	sql := `UPDATE file_uploads SET mime_type = $2, upload_offset = $3, multipart_id = $4, parts = $5, pending_key = $6,
+			pending_size = $7, hash_state = $8, expires_date = $9, updated_date = $10, storage_key = $11
+		WHERE id = $1`
+
+	if upload.Parts == nil {
+		upload.Parts = []storage.Part{}
+	}
+	parts, err := json.Marshal(upload.Parts)
+	if err != nil {
+		return c.errHandler(ctx, "model.UpdateFileUploadProgress", err, utils.ErrUpdatingFileUpload)
+	}
+
+	_, err = db.Exec(ctx, sql, upload.Id, upload.MimeType, upload.Offset, upload.MultipartID, parts, upload.PendingKey,
+		upload.PendingSize, upload.HashState, upload.ExpiresDate, time.Now().UTC(), upload.StorageKey)
+	if err != nil {
+		return c.errHandler(ctx, "model.UpdateFileUploadProgress", err, utils.ErrUpdatingFileUpload)
+	}
+
+	return nil
+}
+
+// DeleteFileUpload remove the upload once completed or terminated, its objects are removed
+// by the caller
+func (c *Contract) DeleteFileUpload(db *pgxpool.Pool, ctx context.Context, id int64) error {
+	_, err := db.Exec(ctx, `DELETE FROM file_uploads WHERE id = $1`, id)
+	if err != nil {
+		return c.errHandler(ctx, "model.DeleteFileUpload", err, utils.ErrDeletingFileUpload)
+	}
+
+	return nil
+}
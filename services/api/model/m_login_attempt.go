@@ -0,0 +1,104 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// default lockout policy when it isn't set in config
+	defaultLockoutMaxAttempts = 5
+	defaultLockoutWindow      = 900 // seconds
+	defaultLockoutDuration    = 900 // seconds
+)
+
+// loginFailureScript count a failed login and start the window with the first one,
+// in one script so the counter can't be left without expiry
+var loginFailureScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`)
+
+func loginFailKey(email string) string {
+	return fmt.Sprintf("login_fail:%s", strings.ToLower(strings.TrimSpace(email)))
+}
+
+func loginLockKey(email string) string {
+	return fmt.Sprintf("login_lock:%s", strings.ToLower(strings.TrimSpace(email)))
+}
+
+func (c *Contract) lockoutSetting() (maxAttempts int, window, duration time.Duration) {
+	maxAttempts = c.Config.GetInt("auth.lockout.max_attempts")
+	if maxAttempts < 1 {
+		maxAttempts = defaultLockoutMaxAttempts
+	}
+
+	w := c.Config.GetInt("auth.lockout.window")
+	if w < 1 {
+		w = defaultLockoutWindow
+	}
+
+	d := c.Config.GetInt("auth.lockout.duration")
+	if d < 1 {
+		d = defaultLockoutDuration
+	}
+
+	return maxAttempts, time.Duration(w) * time.Second, time.Duration(d) * time.Second
+}
+
+// LoginLockTTL remaining time of the lockout of the account, zero when it isn't locked.
+// A redis error is treated as not locked so the login keeps working without the cache.
+func (c *Contract) LoginLockTTL(ctx context.Context, email string) time.Duration {
+	if c.Redis == nil {
+		return 0
+	}
+
+	ttl, err := c.Redis.PTTL(ctx, loginLockKey(email)).Result()
+	if err != nil || ttl < 0 {
+		return 0
+	}
+
+	return ttl
+}
+
+// registerLoginFailure count a failed login of the account and lock it
+// once the max attempts is reached in the window
+func (c *Contract) registerLoginFailure(ctx context.Context, email string) {
+	if c.Redis == nil {
+		return
+	}
+
+	maxAttempts, window, duration := c.lockoutSetting()
+
+	key := loginFailKey(email)
+	count, err := loginFailureScript.Run(ctx, c.Redis, []string{key}, window.Milliseconds()).Int64()
+	if err != nil {
+		_ = c.errHandler(ctx, "model.registerLoginFailure", err, err.Error())
+		return
+	}
+
+	if count >= int64(maxAttempts) {
+		pipe := c.Redis.TxPipeline()
+		pipe.Set(ctx, loginLockKey(email), count, duration)
+		pipe.Del(ctx, key)
+		if _, err = pipe.Exec(ctx); err != nil {
+			_ = c.errHandler(ctx, "model.registerLoginFailure", err, err.Error())
+		}
+	}
+}
+
+// resetLoginFailure forget the failed logins after a successful one
+func (c *Contract) resetLoginFailure(ctx context.Context, email string) {
+	if c.Redis == nil {
+		return
+	}
+
+	c.Redis.Del(ctx, loginFailKey(email))
+}
@@ -0,0 +1,219 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-skeleton/lib/apperr"
+	"go-skeleton/lib/mail"
+	"go-skeleton/lib/utils"
+	"go-skeleton/services/api/request"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type MailEnt struct {
+	Id              int64          `db:"id"`
+	MailIdentifier  string         `db:"mail_identifier"`
+	Template        string         `db:"template"`
+	Locale          string         `db:"locale"`
+	Recipient       string         `db:"recipient"`
+	Subject         string         `db:"subject"`
+	Status          string         `db:"status"`
+	Attempts        int            `db:"attempts"`
+	MaxAttempts     int            `db:"max_attempts"`
+	LastError       sql.NullString `db:"last_error"`
+	NextAttemptDate time.Time      `db:"next_attempt_date"`
+	SentDate        sql.NullTime   `db:"sent_date"`
+	CreatedDate     time.Time      `db:"created_date"`
+}
+
+type MailDeliveryEnt struct {
+	Id          int64          `db:"id"`
+	MailId      int64          `db:"mail_id"`
+	Attempt     int            `db:"attempt"`
+	Status      string         `db:"status"`
+	Error       sql.NullString `db:"error"`
+	CreatedDate time.Time      `db:"created_date"`
+}
+
+const mailColumns = `id, mail_identifier, template, locale, recipient, subject, status, attempts, max_attempts,
+		last_error, next_attempt_date, sent_date, created_date`
+
+func (c *Contract) GetMails(db *pgxpool.Pool, ctx context.Context, param *request.MailParam) ([]MailEnt, error) {
+	var (
+		err        error
+		list       []MailEnt
+		where      []string
+		paramQuery []interface{}
+		totalData  int
+
+		query = `SELECT ` + mailColumns + ` FROM mail_queue`
+	)
+
+	// Populate Search
+	if len(param.Keyword) > 0 {
+		var orWhere []string
+		paramQuery = append(paramQuery, "%"+param.Keyword+"%")
+		orWhere = append(orWhere, fmt.Sprintf("recipient iLIKE $%d", len(paramQuery)))
+		orWhere = append(orWhere, fmt.Sprintf("subject iLIKE $%d", len(paramQuery)))
+		where = append(where, "("+strings.Join(orWhere, " OR ")+")")
+	}
+	if len(param.Status) > 0 {
+		paramQuery = append(paramQuery, param.Status)
+		where = append(where, fmt.Sprintf("status = $%d", len(paramQuery)))
+	}
+	if len(param.Template) > 0 {
+		paramQuery = append(paramQuery, param.Template)
+		where = append(where, fmt.Sprintf("template = $%d", len(paramQuery)))
+	}
+
+	// Append All Where Conditions
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	{
+		newQcount := `SELECT COUNT(*) FROM ( ` + query + ` ) AS data`
+		err := db.QueryRow(ctx, newQcount, paramQuery...).Scan(&totalData)
+		if err != nil {
+			return list, c.errHandler(ctx, "model.GetMails", err, utils.ErrCountingListMail)
+		}
+		param.Count = totalData
+	}
+
+	// Select Max Page
+	if param.Count > param.Limit && param.Page > int(param.Count/param.Limit) {
+		param.Page = int(math.Ceil(float64(param.Count) / float64(param.Limit)))
+	}
+
+	// Limit and Offset
+	param.Offset = (param.Page - 1) * param.Limit
+	query += " ORDER BY " + param.Order + " " + param.Sort + " "
+
+	paramQuery = append(paramQuery, param.Offset)
+	query += fmt.Sprintf("offset $%d ", len(paramQuery))
+
+	paramQuery = append(paramQuery, param.Limit)
+	query += fmt.Sprintf("limit $%d ", len(paramQuery))
+
+	rows, err := db.Query(ctx, query, paramQuery...)
+	if err != nil {
+		return list, c.errHandler(ctx, "model.GetMails", err, utils.ErrGettingListMail)
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var data MailEnt
+		err = rows.Scan(&data.Id, &data.MailIdentifier, &data.Template, &data.Locale, &data.Recipient, &data.Subject, &data.Status,
+			&data.Attempts, &data.MaxAttempts, &data.LastError, &data.NextAttemptDate, &data.SentDate, &data.CreatedDate)
+		if err != nil {
+			return list, c.errHandler(ctx, "model.GetMails", err, utils.ErrScanningListMail)
+		}
+		list = append(list, data)
+	}
+	return list, nil
+}
+
+func (c *Contract) GetMailByCode(db *pgxpool.Pool, ctx context.Context, code string) (MailEnt, error) {
+	var (
+		err  error
+		data MailEnt
+		sql  = `SELECT ` + mailColumns + ` FROM mail_queue WHERE mail_identifier = $1`
+	)
+	err = db.QueryRow(ctx, sql, code).Scan(&data.Id, &data.MailIdentifier, &data.Template, &data.Locale, &data.Recipient, &data.Subject, &data.Status,
+		&data.Attempts, &data.MaxAttempts, &data.LastError, &data.NextAttemptDate, &data.SentDate, &data.CreatedDate)
+	if err != nil {
+		return data, c.errHandler(ctx, "model.GetMailByCode", err, utils.ErrGettingMailByCode)
+	}
+
+	return data, nil
+}
+
+// GetMailDeliveries the attempts of the mail, oldest first
+func (c *Contract) GetMailDeliveries(db *pgxpool.Pool, ctx context.Context, mailID int64) ([]MailDeliveryEnt, error) {
+	var (
+		list []MailDeliveryEnt
+		sql  = `SELECT id, mail_id, attempt, status, error, created_date
+		FROM mail_deliveries
+		WHERE mail_id = $1
+		ORDER BY id`
+	)
+	rows, err := db.Query(ctx, sql, mailID)
+	if err != nil {
+		return list, c.errHandler(ctx, "model.GetMailDeliveries", err, utils.ErrGettingDeliveries)
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var data MailDeliveryEnt
+		err = rows.Scan(&data.Id, &data.MailId, &data.Attempt, &data.Status, &data.Error, &data.CreatedDate)
+		if err != nil {
+			return list, c.errHandler(ctx, "model.GetMailDeliveries", err, utils.ErrGettingDeliveries)
+		}
+		list = append(list, data)
+	}
+	if err = rows.Err(); err != nil {
+		return list, c.errHandler(ctx, "model.GetMailDeliveries", err, utils.ErrGettingDeliveries)
+	}
+
+	return list, nil
+}
+
+// ResendMail queue a failed mail again with a new set of attempts, the resend is written in
+// the deliveries. The data of a sent mail isn't kept, and a mail with a verification token
+// isn't resent: its link has expired, the user requests a new one.
+func (c *Contract) ResendMail(db *pgxpool.Pool, ctx context.Context, code string) error {
+	var (
+		err    error
+		mailID int64
+		sql    = `UPDATE mail_queue
+		SET status = $1, attempts = 0, last_error = NULL, next_attempt_date = $2, updated_date = $2
+		WHERE mail_identifier = $3 AND status = $4
+		RETURNING id`
+	)
+
+	data, err := c.GetMailByCode(db, ctx, code)
+	if err != nil {
+		return err
+	}
+	if mail.HasToken(data.Template) {
+		return apperr.New(apperr.Conflict, apperr.CodeConflict, utils.ErrMailHasToken)
+	}
+	if data.Status != mail.StatusFailed {
+		return apperr.New(apperr.Conflict, apperr.CodeConflict, utils.ErrMailNotResendable)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return c.errHandler(ctx, "model.ResendMail", err, utils.ErrBeginningTransaction)
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now().UTC()
+	err = tx.QueryRow(ctx, sql, mail.StatusPending, now, code, mail.StatusFailed).Scan(&mailID)
+	if err != nil {
+		// resent by another request in the meantime
+		if errors.Is(err, pgx.ErrNoRows) {
+			return apperr.New(apperr.Conflict, apperr.CodeConflict, utils.ErrMailNotResendable)
+		}
+		return c.errHandler(ctx, "model.ResendMail", err, utils.ErrResendingMail)
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO mail_deliveries (mail_id, attempt, status, created_date) VALUES($1, $2, $3, $4)`,
+		mailID, data.Attempts, mail.DeliveryResend, now)
+	if err != nil {
+		return c.errHandler(ctx, "model.ResendMail", err, utils.ErrResendingMail)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return c.errHandler(ctx, "model.ResendMail", err, utils.ErrCommittingTransaction)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"go-skeleton/lib/utils"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type RoleEnt struct {
+	ID          int64        `db:"id"`
+	RoleCode    string       `db:"role_code"`
+	RoleName    string       `db:"role_name"`
+	CreatedDate time.Time    `db:"created_date"`
+	UpdatedDate sql.NullTime `db:"updated_date"`
+}
+
+// GetRolePermissions list the permission codes granted to the role, a user without role has none
+func (c *Contract) GetRolePermissions(db *pgxpool.Pool, ctx context.Context, roleID sql.NullInt64) ([]string, error) {
+	res := []string{}
+
+	if !roleID.Valid {
+		return res, nil
+	}
+
+	sql := `SELECT p.permission_code
+		FROM role_permissions rp
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE rp.role_id = $1
+		ORDER BY p.permission_code`
+
+	rows, err := db.Query(ctx, sql, roleID.Int64)
+	if err != nil {
+		return res, c.errHandler(ctx, "model.GetRolePermissions", err, utils.ErrGettingPermissions)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var code string
+		if err = rows.Scan(&code); err != nil {
+			return res, c.errHandler(ctx, "model.GetRolePermissions", err, utils.ErrGettingPermissions)
+		}
+		res = append(res, code)
+	}
+
+	if err = rows.Err(); err != nil {
+		return res, c.errHandler(ctx, "model.GetRolePermissions", err, utils.ErrGettingPermissions)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,249 @@
+package model
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"go-skeleton/lib/apperr"
+	"go-skeleton/lib/utils"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// default lifetime of the tokens when it isn't set in config
+	defaultAccessTokenTTL  = 15  // minutes
+	defaultRefreshTokenTTL = 720 // hours
+)
+
+type SessionEnt struct {
+	ID                int64        `db:"id"`
+	SessionIdentifier string       `db:"session_identifier"`
+	UserID            int64        `db:"user_id"`
+	ExpiredDate       time.Time    `db:"expired_date"`
+	RevokedDate       sql.NullTime `db:"revoked_date"`
+	CreatedDate       time.Time    `db:"created_date"`
+	UpdatedDate       sql.NullTime `db:"updated_date"`
+}
+
+// TokenEnt access and refresh token of a session. When the user has enabled
+// two-factor authentication only ChallengeToken and ExpiredAt are set.
+type TokenEnt struct {
+	SessionIdentifier string
+	AccessToken       string
+	ExpiredAt         int64
+	RefreshToken      string
+	RefreshExpiredAt  time.Time
+	ChallengeToken    string
+}
+
+func (c *Contract) accessTokenTTL() time.Duration {
+	ttl := c.Config.GetInt("jwt.access_ttl")
+	if ttl < 1 {
+		ttl = defaultAccessTokenTTL
+	}
+
+	return time.Duration(ttl) * time.Minute
+}
+
+func (c *Contract) refreshTokenTTL() time.Duration {
+	ttl := c.Config.GetInt("jwt.refresh_ttl")
+	if ttl < 1 {
+		ttl = defaultRefreshTokenTTL
+	}
+
+	return time.Duration(ttl) * time.Hour
+}
+
+// hashToken only the hash of refresh tokens and recovery codes is stored in database
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSession start a new session (token family) for the user and issue the first token pair
+func (c *Contract) CreateSession(db *pgxpool.Pool, ctx context.Context, user UserEnt, actorType string) (TokenEnt, error) {
+	var (
+		err       error
+		sessionID int64
+		now       = time.Now().UTC()
+		res       = TokenEnt{
+			SessionIdentifier: utils.GeneratePrefixCode(utils.SessionPrefix),
+			RefreshExpiredAt:  now.Add(c.refreshTokenTTL()),
+		}
+	)
+
+	res.RefreshToken, err = utils.RandomToken(32)
+	if err != nil {
+		return res, c.errHandler(ctx, "model.CreateSession", err, utils.ErrCreatingSession)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return res, c.errHandler(ctx, "model.CreateSession", err, utils.ErrBeginningTransaction)
+	}
+	defer tx.Rollback(ctx)
+
+	sessionSQL := `INSERT INTO user_sessions (session_identifier, user_id, expired_date, created_date)
+		VALUES($1, $2, $3, $4) RETURNING id`
+	err = tx.QueryRow(ctx, sessionSQL, res.SessionIdentifier, user.ID, res.RefreshExpiredAt, now).Scan(&sessionID)
+	if err != nil {
+		return res, c.errHandler(ctx, "model.CreateSession", err, utils.ErrCreatingSession)
+	}
+
+	err = c.insertRefreshToken(tx, ctx, sessionID, res.RefreshToken, res.RefreshExpiredAt)
+	if err != nil {
+		return res, c.errHandler(ctx, "model.CreateSession", err, utils.ErrCreatingSession)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return res, c.errHandler(ctx, "model.CreateSession", err, utils.ErrCommittingTransaction)
+	}
+
+	permissions, err := c.GetRolePermissions(db, ctx, user.RoleID)
+	if err != nil {
+		return res, err
+	}
+
+	res.AccessToken, res.ExpiredAt, err = c.GenerateTokenJWT(user, actorType, res.SessionIdentifier, permissions)
+	if err != nil {
+		return res, c.errHandler(ctx, "model.CreateSession", err, utils.ErrGeneratingJWT)
+	}
+
+	return res, nil
+}
+
+// RefreshSession rotate the refresh token, a refresh token can only be used once.
+// Reusing an already rotated token revokes the whole session.
+func (c *Contract) RefreshSession(db *pgxpool.Pool, ctx context.Context, refreshToken string) (UserEnt, TokenEnt, error) {
+	var (
+		err            error
+		tokenID        int64
+		isUsed         bool
+		tokenExpiredAt time.Time
+		session        SessionEnt
+		user           UserEnt
+		now            = time.Now().UTC()
+		res            = TokenEnt{RefreshExpiredAt: now.Add(c.refreshTokenTTL())}
+	)
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return user, res, c.errHandler(ctx, "model.RefreshSession", err, utils.ErrBeginningTransaction)
+	}
+	defer tx.Rollback(ctx)
+
+	// lock the token and its session, so concurrent refreshes are serialized
+	checkSQL := `SELECT rt.id, rt.is_used, rt.expired_date, s.id, s.session_identifier, s.user_id, s.revoked_date
+		FROM refresh_tokens rt
+		JOIN user_sessions s ON s.id = rt.session_id
+		WHERE rt.token_hash = $1
+		FOR UPDATE OF rt, s`
+	err = tx.QueryRow(ctx, checkSQL, hashToken(refreshToken)).Scan(
+		&tokenID, &isUsed, &tokenExpiredAt, &session.ID, &session.SessionIdentifier, &session.UserID, &session.RevokedDate,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return user, res, apperr.New(apperr.Unauthorized, apperr.CodeInvalidToken, utils.ErrInvalidToken)
+		}
+		return user, res, c.errHandler(ctx, "model.RefreshSession", err, utils.ErrRefreshingSession)
+	}
+
+	if session.RevokedDate.Valid {
+		return user, res, apperr.New(apperr.Unauthorized, apperr.CodeSessionRevoked, utils.ErrSessionRevoked)
+	}
+
+	// reuse detected: the token was already rotated, revoke the whole token family
+	if isUsed {
+		_, err = tx.Exec(ctx, `UPDATE user_sessions SET revoked_date = $1, updated_date = $1 WHERE id = $2`, now, session.ID)
+		if err != nil {
+			return user, res, c.errHandler(ctx, "model.RefreshSession", err, utils.ErrRevokingSession)
+		}
+		if err = tx.Commit(ctx); err != nil {
+			return user, res, c.errHandler(ctx, "model.RefreshSession", err, utils.ErrCommittingTransaction)
+		}
+
+		return user, res, apperr.New(apperr.Unauthorized, apperr.CodeRefreshTokenReused, utils.ErrRefreshTokenReused)
+	}
+
+	if tokenExpiredAt.Before(now) {
+		return user, res, apperr.New(apperr.Unauthorized, apperr.CodeTokenExpired, utils.ErrTokenExpired)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE refresh_tokens SET is_used = true, used_date = $1 WHERE id = $2`, now, tokenID)
+	if err != nil {
+		return user, res, c.errHandler(ctx, "model.RefreshSession", err, utils.ErrRefreshingSession)
+	}
+
+	res.RefreshToken, err = utils.RandomToken(32)
+	if err != nil {
+		return user, res, c.errHandler(ctx, "model.RefreshSession", err, utils.ErrRefreshingSession)
+	}
+
+	err = c.insertRefreshToken(tx, ctx, session.ID, res.RefreshToken, res.RefreshExpiredAt)
+	if err != nil {
+		return user, res, c.errHandler(ctx, "model.RefreshSession", err, utils.ErrRefreshingSession)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE user_sessions SET expired_date = $1, updated_date = $2 WHERE id = $3`, res.RefreshExpiredAt, now, session.ID)
+	if err != nil {
+		return user, res, c.errHandler(ctx, "model.RefreshSession", err, utils.ErrRefreshingSession)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return user, res, c.errHandler(ctx, "model.RefreshSession", err, utils.ErrCommittingTransaction)
+	}
+
+	user, err = c.GetUserByID(db, ctx, session.UserID)
+	if err != nil {
+		return user, res, err
+	}
+
+	res.SessionIdentifier = session.SessionIdentifier
+	permissions, err := c.GetRolePermissions(db, ctx, user.RoleID)
+	if err != nil {
+		return user, res, err
+	}
+
+	res.AccessToken, res.ExpiredAt, err = c.GenerateTokenJWT(user, utils.User, session.SessionIdentifier, permissions)
+	if err != nil {
+		return user, res, c.errHandler(ctx, "model.RefreshSession", err, utils.ErrGeneratingJWT)
+	}
+
+	return user, res, nil
+}
+
+// RevokeSession revoke the session, its access and refresh tokens can't be used anymore
+func (c *Contract) RevokeSession(db *pgxpool.Pool, ctx context.Context, sessionIdentifier string) error {
+	sql := `UPDATE user_sessions SET revoked_date = $1, updated_date = $1
+		WHERE session_identifier = $2 AND revoked_date IS NULL`
+
+	_, err := db.Exec(ctx, sql, time.Now().UTC(), sessionIdentifier)
+	if err != nil {
+		return c.errHandler(ctx, "model.RevokeSession", err, utils.ErrRevokingSession)
+	}
+
+	return nil
+}
+
+// revokeOtherSessions revoke every session of the user except the current one,
+// e.g. after a password change a stolen refresh token can't be used anymore
+func (c *Contract) revokeOtherSessions(tx pgx.Tx, ctx context.Context, userID int, currentSessionIdentifier string) error {
+	sql := `UPDATE user_sessions SET revoked_date = $1, updated_date = $1
+		WHERE user_id = $2 AND session_identifier <> $3 AND revoked_date IS NULL`
+
+	_, err := tx.Exec(ctx, sql, time.Now().UTC(), userID, currentSessionIdentifier)
+	return err
+}
+
+func (c *Contract) insertRefreshToken(tx pgx.Tx, ctx context.Context, sessionID int64, token string, expiredDate time.Time) error {
+	sql := `INSERT INTO refresh_tokens (session_id, token_hash, is_used, expired_date, created_date)
+		VALUES($1, $2, $3, $4, $5)`
+
+	_, err := tx.Exec(ctx, sql, sessionID, hashToken(token), false, expiredDate, time.Now().UTC())
+	return err
+}
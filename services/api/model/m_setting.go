@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"go-skeleton/lib/apperr"
+	"go-skeleton/lib/outbox"
 	"go-skeleton/lib/utils"
 	"go-skeleton/services/api/request"
 	"math"
@@ -72,7 +74,7 @@ func (c *Contract) GetSetting(db *pgxpool.Pool, ctx context.Context, param reque
 		newQcount := `SELECT COUNT(*) FROM ( ` + query + ` ) AS data`
 		err := db.QueryRow(ctx, newQcount, paramQuery...).Scan(&totalData)
 		if err != nil {
-			return list, c.errHandler("model.GetSetting", err, utils.ErrCountingListSetting)
+			return list, c.errHandler(ctx, "model.GetSetting", err, utils.ErrCountingListSetting)
 		}
 		param.Count = totalData
 	}
@@ -94,7 +96,7 @@ func (c *Contract) GetSetting(db *pgxpool.Pool, ctx context.Context, param reque
 
 	rows, err := db.Query(ctx, query, paramQuery...)
 	if err != nil {
-		return list, c.errHandler("model.GetSetting", err, utils.ErrGettingListSetting)
+		return list, c.errHandler(ctx, "model.GetSetting", err, utils.ErrGettingListSetting)
 	}
 
 	defer rows.Close()
@@ -102,7 +104,7 @@ func (c *Contract) GetSetting(db *pgxpool.Pool, ctx context.Context, param reque
 		var data SettingEnt
 		err = rows.Scan(&data.Id, &data.SettingCode, &data.SetGroup, &data.SetKey, &data.SetLabel, &data.SetOrder, &data.ContentType, &data.ContentValue, &data.IsActive)
 		if err != nil {
-			return list, c.errHandler("model.GetSetting", err, utils.ErrScanningListSetting)
+			return list, c.errHandler(ctx, "model.GetSetting", err, utils.ErrScanningListSetting)
 		}
 		list = append(list, data)
 	}
@@ -119,7 +121,7 @@ func (c *Contract) GetSettingByCode(db *pgxpool.Pool, ctx context.Context, code
 	)
 	err = db.QueryRow(ctx, sql, code).Scan(&data.Id, &data.SettingCode, &data.SetGroup, &data.SetKey, &data.SetLabel, &data.SetOrder, &data.ContentType, &data.ContentValue, &data.IsActive)
 	if err != nil {
-		return data, c.errHandler("model.GetSettingByCode", err, utils.ErrGettingSettingByCode)
+		return data, c.errHandler(ctx, "model.GetSettingByCode", err, utils.ErrGettingSettingByCode)
 	}
 
 	return data, nil
@@ -135,7 +137,7 @@ func (c *Contract) GetSettingValueByKey(db *pgxpool.Pool, ctx context.Context, k
 	)
 	err = db.QueryRow(ctx, sql, key).Scan(&res)
 	if err != nil {
-		return res, c.errHandler("model.GetSettingValueByKey", err, utils.ErrGettingSettingByKey)
+		return res, c.errHandler(ctx, "model.GetSettingValueByKey", err, utils.ErrGettingSettingByKey)
 	}
 
 	return res, nil
@@ -143,7 +145,7 @@ func (c *Contract) GetSettingValueByKey(db *pgxpool.Pool, ctx context.Context, k
 
 func (c *Contract) AddSetting(db *pgxpool.Pool, ctx context.Context, code, group, label string, order int, contentType, content string, isActive bool) error {
 	if !utils.Contains(setType, contentType) {
-		return fmt.Errorf("%s", "wrong content type value for settings(json_arr|json_obj|bool|string")
+		return apperr.New(apperr.Validation, apperr.CodeInvalidContentType, utils.ErrInvalidSettingContentType)
 	}
 
 	sql := `INSERT INTO settings(setting_code, set_group, set_key, set_label, set_order, content_type, content_value, is_active, created_date)
@@ -151,7 +153,7 @@ func (c *Contract) AddSetting(db *pgxpool.Pool, ctx context.Context, code, group
 
 	_, err := db.Exec(ctx, sql, code, group, content, label, order, contentType, content, isActive, time.Now().In(time.UTC))
 	if err != nil {
-		return c.errHandler("model.AddSetting", err, utils.ErrAddingSetting)
+		return c.errHandler(ctx, "model.AddSetting", err, utils.ErrAddingSetting)
 	}
 
 	return nil
@@ -164,9 +166,36 @@ func (c *Contract) UpdateSetting(db *pgxpool.Pool, ctx context.Context, code, la
 		SET set_key=$1,set_label=$2,set_order=$3,content_value=$4,is_active=$5,updated_date=$6
 		WHERE setting_code=$7`
 	)
-	_, err = db.Exec(ctx, sql, content, label, order, content, isActive, time.Now().In(time.UTC), code)
+	tx, err := db.Begin(ctx)
 	if err != nil {
-		return c.errHandler("model.UpdateSetting", err, utils.ErrUpdatingSetting)
+		return c.errHandler(ctx, "model.UpdateSetting", err, utils.ErrBeginningTransaction)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, sql, content, label, order, content, isActive, time.Now().In(time.UTC), code)
+	if err != nil {
+		return c.errHandler(ctx, "model.UpdateSetting", err, utils.ErrUpdatingSetting)
+	}
+
+	if tag.RowsAffected() > 0 {
+		err = outbox.Add(ctx, tx, outbox.Event{
+			Type:          utils.EventSettingUpdated,
+			AggregateType: utils.AggregateSetting,
+			AggregateID:   code,
+			Data: map[string]interface{}{
+				"setting_code": code,
+				"label":        label,
+				"order":        order,
+				"is_active":    isActive,
+			},
+		})
+		if err != nil {
+			return c.errHandler(ctx, "model.UpdateSetting", err, utils.ErrUpdatingSetting)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return c.errHandler(ctx, "model.UpdateSetting", err, utils.ErrCommittingTransaction)
 	}
 
 	return nil
@@ -0,0 +1,361 @@
+package model
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"go-skeleton/bootstrap"
+	"go-skeleton/lib/apperr"
+	"go-skeleton/lib/totp"
+	"go-skeleton/lib/utils"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	twoFactorChallengeTTL = 5 * time.Minute
+	recoveryCodeCount     = 10
+
+	// default invalid codes allowed for a challenge when it isn't set in config
+	defaultTwoFactorMaxAttempts = 5
+)
+
+// TwoFactorEnrollEnt secret of a new enrollment, shown only once to the user
+type TwoFactorEnrollEnt struct {
+	Secret        string
+	URI           string
+	RecoveryCodes []string
+}
+
+// loginToken create the session of the user, or a challenge token when the user
+// has enabled two-factor authentication
+func (c *Contract) loginToken(db *pgxpool.Pool, ctx context.Context, user UserEnt, actorType string) (TokenEnt, error) {
+	var (
+		err   error
+		token TokenEnt
+	)
+
+	if !user.TwoFactorEnabled {
+		return c.CreateSession(db, ctx, user, actorType)
+	}
+
+	// the id of the challenge counts its invalid codes
+	challengeID, err := utils.RandomToken(16)
+	if err != nil {
+		return token, c.errHandler(ctx, "model.loginToken", err, utils.ErrGeneratingJWT)
+	}
+
+	token.ExpiredAt = time.Now().UTC().Add(twoFactorChallengeTTL).Unix()
+	claims := &bootstrap.CustomUserClaims{
+		UserIdentifier: user.UserIdentifier,
+		Email:          user.Email,
+		Purpose:        bootstrap.PurposeTwoFactor,
+		StandardClaims: jwt.StandardClaims{
+			Id:        challengeID,
+			ExpiresAt: token.ExpiredAt,
+			Issuer:    actorType,
+		},
+	}
+
+	token.ChallengeToken, err = c.JWTKeys.Sign(claims)
+	if err != nil {
+		return token, c.errHandler(ctx, "model.loginToken", err, utils.ErrGeneratingJWT)
+	}
+
+	return token, nil
+}
+
+// VerifyTwoFactorLogin exchange the challenge token and a TOTP or recovery code for a session
+func (c *Contract) VerifyTwoFactorLogin(db *pgxpool.Pool, ctx context.Context, challengeToken, code string) (UserEnt, TokenEnt, error) {
+	var (
+		err    error
+		user   UserEnt
+		token  TokenEnt
+		claims = &bootstrap.CustomUserClaims{}
+	)
+
+	_, err = jwt.ParseWithClaims(challengeToken, claims, c.JWTKeys.Keyfunc)
+	if err != nil || claims.Purpose != bootstrap.PurposeTwoFactor || len(claims.Id) == 0 {
+		return user, token, apperr.New(apperr.Unauthorized, apperr.CodeInvalidToken, utils.ErrInvalidToken)
+	}
+
+	user, err = c.GetUserByUserIdentifier(db, ctx, claims.UserIdentifier)
+	if err != nil {
+		return user, token, err
+	}
+
+	if !user.TwoFactorEnabled {
+		return user, token, apperr.New(apperr.Unauthorized, apperr.CodeInvalidToken, utils.ErrInvalidToken)
+	}
+
+	// the challenge is invalidated after too many invalid codes or once it's exchanged
+	if c.challengeAttempts(ctx, claims.Id) >= c.twoFactorMaxAttempts() {
+		return user, token, apperr.New(apperr.Unauthorized, apperr.CodeTwoFactorChallengeUsed, utils.ErrTwoFactorChallengeInvalidated)
+	}
+
+	valid, err := c.checkTwoFactorCode(db, ctx, user, code)
+	if err != nil {
+		return user, token, err
+	}
+	if !valid {
+		c.registerChallengeFailure(ctx, claims.Id)
+		return user, token, apperr.New(apperr.Unauthorized, apperr.CodeInvalidTwoFactorCode, utils.ErrInvalidTwoFactorCode)
+	}
+	c.invalidateChallenge(ctx, claims.Id)
+
+	// Create session with access and refresh token
+	token, err = c.CreateSession(db, ctx, user, claims.Issuer)
+	if err != nil {
+		return user, token, err
+	}
+
+	return user, token, nil
+}
+
+func twoFactorChallengeKey(challengeID string) string {
+	return fmt.Sprintf("two_factor_challenge:%s", challengeID)
+}
+
+func (c *Contract) twoFactorMaxAttempts() int {
+	maxAttempts := c.Config.GetInt("auth.two_factor.max_attempts")
+	if maxAttempts < 1 {
+		maxAttempts = defaultTwoFactorMaxAttempts
+	}
+
+	return maxAttempts
+}
+
+// challengeAttempts invalid codes sent with the challenge, a redis error is treated
+// as no attempt so the 2FA step keeps working without the cache
+func (c *Contract) challengeAttempts(ctx context.Context, challengeID string) int {
+	if c.Redis == nil {
+		return 0
+	}
+
+	count, err := c.Redis.Get(ctx, twoFactorChallengeKey(challengeID)).Int()
+	if err != nil {
+		return 0
+	}
+
+	return count
+}
+
+// registerChallengeFailure count an invalid code of the challenge until the challenge expires
+func (c *Contract) registerChallengeFailure(ctx context.Context, challengeID string) {
+	if c.Redis == nil {
+		return
+	}
+
+	pipe := c.Redis.TxPipeline()
+	pipe.Incr(ctx, twoFactorChallengeKey(challengeID))
+	pipe.Expire(ctx, twoFactorChallengeKey(challengeID), twoFactorChallengeTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		_ = c.errHandler(ctx, "model.registerChallengeFailure", err, err.Error())
+	}
+}
+
+// invalidateChallenge the challenge can't be exchanged again once a session is created with it
+func (c *Contract) invalidateChallenge(ctx context.Context, challengeID string) {
+	if c.Redis == nil {
+		return
+	}
+
+	err := c.Redis.Set(ctx, twoFactorChallengeKey(challengeID), c.twoFactorMaxAttempts(), twoFactorChallengeTTL).Err()
+	if err != nil {
+		_ = c.errHandler(ctx, "model.invalidateChallenge", err, err.Error())
+	}
+}
+
+// EnrollTwoFactor generate a new pending secret and recovery codes, it's enabled after ConfirmTwoFactor
+func (c *Contract) EnrollTwoFactor(db *pgxpool.Pool, ctx context.Context, userIdentifier string) (TwoFactorEnrollEnt, error) {
+	var (
+		err error
+		res TwoFactorEnrollEnt
+		now = time.Now().UTC()
+	)
+
+	user, err := c.GetUserByUserIdentifier(db, ctx, userIdentifier)
+	if err != nil {
+		return res, err
+	}
+
+	if user.TwoFactorEnabled {
+		return res, apperr.New(apperr.Conflict, apperr.CodeTwoFactorAlreadyEnabled, utils.ErrTwoFactorAlreadyEnabled)
+	}
+
+	res.Secret, err = totp.GenerateSecret()
+	if err != nil {
+		return res, c.errHandler(ctx, "model.EnrollTwoFactor", err, utils.ErrEnrollingTwoFactor)
+	}
+	res.URI = totp.URI(c.issuer(), user.Email, res.Secret)
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return res, c.errHandler(ctx, "model.EnrollTwoFactor", err, utils.ErrBeginningTransaction)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `UPDATE users SET two_factor_secret = $1, two_factor_last_step = NULL, updated_date = $2 WHERE id = $3`, res.Secret, now, user.ID)
+	if err != nil {
+		return res, c.errHandler(ctx, "model.EnrollTwoFactor", err, utils.ErrEnrollingTwoFactor)
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, user.ID)
+	if err != nil {
+		return res, c.errHandler(ctx, "model.EnrollTwoFactor", err, utils.ErrEnrollingTwoFactor)
+	}
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return res, c.errHandler(ctx, "model.EnrollTwoFactor", err, utils.ErrEnrollingTwoFactor)
+		}
+
+		sql := `INSERT INTO user_recovery_codes (user_id, code_hash, created_date) VALUES($1, $2, $3)`
+		_, err = tx.Exec(ctx, sql, user.ID, hashToken(code), now)
+		if err != nil {
+			return res, c.errHandler(ctx, "model.EnrollTwoFactor", err, utils.ErrEnrollingTwoFactor)
+		}
+		res.RecoveryCodes = append(res.RecoveryCodes, code)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return res, c.errHandler(ctx, "model.EnrollTwoFactor", err, utils.ErrCommittingTransaction)
+	}
+
+	return res, nil
+}
+
+// ConfirmTwoFactor enable two-factor authentication once the user proves the authenticator app is set
+func (c *Contract) ConfirmTwoFactor(db *pgxpool.Pool, ctx context.Context, userIdentifier, code string) error {
+	user, err := c.GetUserByUserIdentifier(db, ctx, userIdentifier)
+	if err != nil {
+		return err
+	}
+
+	if user.TwoFactorEnabled {
+		return apperr.New(apperr.Conflict, apperr.CodeTwoFactorAlreadyEnabled, utils.ErrTwoFactorAlreadyEnabled)
+	}
+	if !user.TwoFactorSecret.Valid {
+		return apperr.New(apperr.Validation, apperr.CodeTwoFactorNotEnrolled, utils.ErrTwoFactorNotEnrolled)
+	}
+
+	step, ok := totp.Validate(user.TwoFactorSecret.String, code, time.Now(), 1)
+	if !ok {
+		return apperr.New(apperr.Unauthorized, apperr.CodeInvalidTwoFactorCode, utils.ErrInvalidTwoFactorCode)
+	}
+
+	sql := `UPDATE users SET two_factor_enabled = true, two_factor_last_step = $1, updated_date = $2 WHERE id = $3`
+	_, err = db.Exec(ctx, sql, step, time.Now().UTC(), user.ID)
+	if err != nil {
+		return c.errHandler(ctx, "model.ConfirmTwoFactor", err, utils.ErrUpdatingTwoFactor)
+	}
+
+	return nil
+}
+
+// DisableTwoFactor turn off two-factor authentication, it requires a valid TOTP or recovery code
+func (c *Contract) DisableTwoFactor(db *pgxpool.Pool, ctx context.Context, userIdentifier, code string) error {
+	user, err := c.GetUserByUserIdentifier(db, ctx, userIdentifier)
+	if err != nil {
+		return err
+	}
+
+	if !user.TwoFactorEnabled {
+		return apperr.New(apperr.Validation, apperr.CodeTwoFactorNotEnabled, utils.ErrTwoFactorNotEnabled)
+	}
+
+	valid, err := c.checkTwoFactorCode(db, ctx, user, code)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return apperr.New(apperr.Unauthorized, apperr.CodeInvalidTwoFactorCode, utils.ErrInvalidTwoFactorCode)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return c.errHandler(ctx, "model.DisableTwoFactor", err, utils.ErrBeginningTransaction)
+	}
+	defer tx.Rollback(ctx)
+
+	sql := `UPDATE users SET two_factor_enabled = false, two_factor_secret = NULL, two_factor_last_step = NULL, updated_date = $1 WHERE id = $2`
+	_, err = tx.Exec(ctx, sql, time.Now().UTC(), user.ID)
+	if err != nil {
+		return c.errHandler(ctx, "model.DisableTwoFactor", err, utils.ErrUpdatingTwoFactor)
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, user.ID)
+	if err != nil {
+		return c.errHandler(ctx, "model.DisableTwoFactor", err, utils.ErrUpdatingTwoFactor)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return c.errHandler(ctx, "model.DisableTwoFactor", err, utils.ErrCommittingTransaction)
+	}
+
+	return nil
+}
+
+// checkTwoFactorCode accept a TOTP code that hasn't been used yet or an unused recovery code
+func (c *Contract) checkTwoFactorCode(db *pgxpool.Pool, ctx context.Context, user UserEnt, code string) (bool, error) {
+	now := time.Now().UTC()
+
+	last := int64(-1)
+	if user.TwoFactorLastStep.Valid {
+		last = user.TwoFactorLastStep.Int64
+	}
+	if step, ok := totp.ValidateAfter(user.TwoFactorSecret.String, code, now, 1, last); ok {
+		// only a newer time step is accepted, so a code can't be replayed by a concurrent request
+		sql := `UPDATE users SET two_factor_last_step = $1
+			WHERE id = $2 AND (two_factor_last_step IS NULL OR two_factor_last_step < $1)`
+		tag, err := db.Exec(ctx, sql, step, user.ID)
+		if err != nil {
+			return false, c.errHandler(ctx, "model.checkTwoFactorCode", err, utils.ErrUpdatingTwoFactor)
+		}
+
+		return tag.RowsAffected() == 1, nil
+	}
+
+	sql := `UPDATE user_recovery_codes SET used_date = $1
+		WHERE user_id = $2 AND code_hash = $3 AND used_date IS NULL`
+	tag, err := db.Exec(ctx, sql, now, user.ID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, c.errHandler(ctx, "model.checkTwoFactorCode", err, utils.ErrUpdatingTwoFactor)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// issuer the name shown in the authenticator app
+func (c *Contract) issuer() string {
+	if name := c.Config.GetString("app.name"); len(name) > 0 {
+		return name
+	}
+
+	return "go-skeleton"
+}
+
+// generateRecoveryCode create a random code formatted as xxxxx-xxxxx
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if len(code) == 10 {
+		code = code[:5] + "-" + code[5:]
+	}
+
+	return code
+}
@@ -3,7 +3,7 @@ package model
 import (
 	"context"
 	"database/sql"
-	"errors"
+	"go-skeleton/lib/apperr"
 	"go-skeleton/lib/utils"
 	"time"
 
@@ -24,12 +24,26 @@ type UserEnt struct {
 	CreatedDate    time.Time      `db:"created_date"`
 	UpdatedDate    sql.NullTime   `db:"updated_date"`
 	DeletedDate    sql.NullTime   `db:"deleted_date"`
+
+	TwoFactorEnabled  bool           `db:"two_factor_enabled"`
+	TwoFactorSecret   sql.NullString `db:"two_factor_secret"`
+	TwoFactorLastStep sql.NullInt64  `db:"two_factor_last_step"`
+
+	// Locale preferred language of the mails, empty for app.locale
+	Locale sql.NullString `db:"locale"`
+	// AvatarFileID the uploaded file of the avatar, null for an external avatar_url
+	AvatarFileID sql.NullInt64 `db:"avatar_file_id"`
+
+	RoleID sql.NullInt64 `db:"role_id"`
+	Role   string        `db:"role_code"`
 }
 
 func (c *Contract) GetUserByEmail(db *pgxpool.Pool, ctx context.Context, email string) (UserEnt, error) {
 	var res UserEnt
 
-	sql := `SELECT id, user_identifier, first_name, last_name, email, avatar_url, description, password, is_verify, created_date, updated_date, deleted_date
+	sql := `SELECT id, user_identifier, first_name, last_name, email, avatar_url, description, password, is_verify, created_date, updated_date, deleted_date,
+            two_factor_enabled, two_factor_secret, two_factor_last_step, locale, avatar_file_id,
+            role_id, COALESCE((SELECT role_code FROM roles WHERE id = users.role_id), '')
             FROM users
             WHERE email = $1 AND deleted_date IS NULL`
 
@@ -46,10 +60,17 @@ func (c *Contract) GetUserByEmail(db *pgxpool.Pool, ctx context.Context, email s
 		&res.CreatedDate,
 		&res.UpdatedDate,
 		&res.DeletedDate,
+		&res.TwoFactorEnabled,
+		&res.TwoFactorSecret,
+		&res.TwoFactorLastStep,
+		&res.Locale,
+		&res.AvatarFileID,
+		&res.RoleID,
+		&res.Role,
 	)
 
 	if err != nil {
-		return res, c.errHandler("model.GetUserByEmail", err, utils.ErrGettingUserByEmail)
+		return res, c.errHandler(ctx, "model.GetUserByEmail", err, utils.ErrGettingUserByEmail)
 	}
 
 	return res, nil
@@ -58,7 +79,9 @@ func (c *Contract) GetUserByEmail(db *pgxpool.Pool, ctx context.Context, email s
 func (c *Contract) GetUserByUserIdentifier(db *pgxpool.Pool, ctx context.Context, userIdentifier string) (UserEnt, error) {
 	var res UserEnt
 
-	sql := `SELECT id, user_identifier, first_name, last_name, email, avatar_url, description, password, is_verify, created_date, updated_date, deleted_date
+	sql := `SELECT id, user_identifier, first_name, last_name, email, avatar_url, description, password, is_verify, created_date, updated_date, deleted_date,
+            two_factor_enabled, two_factor_secret, two_factor_last_step, locale, avatar_file_id,
+            role_id, COALESCE((SELECT role_code FROM roles WHERE id = users.role_id), '')
             FROM users
             WHERE user_identifier = $1 AND deleted_date IS NULL`
 
@@ -75,25 +98,73 @@ func (c *Contract) GetUserByUserIdentifier(db *pgxpool.Pool, ctx context.Context
 		&res.CreatedDate,
 		&res.UpdatedDate,
 		&res.DeletedDate,
+		&res.TwoFactorEnabled,
+		&res.TwoFactorSecret,
+		&res.TwoFactorLastStep,
+		&res.Locale,
+		&res.AvatarFileID,
+		&res.RoleID,
+		&res.Role,
 	)
 
 	if err != nil {
-		return res, c.errHandler("model.GetUserByUserIdentifier", err, utils.ErrRetrievingUserByUserIdentifier)
+		return res, c.errHandler(ctx, "model.GetUserByUserIdentifier", err, utils.ErrRetrievingUserByUserIdentifier)
 	}
 
 	return res, nil
 }
 
-func (c *Contract) UpdateUserProfile(db *pgxpool.Pool, ctx context.Context, userIdentifier, firstName, lastName, description, avatarURL string) error {
+func (c *Contract) GetUserByID(db *pgxpool.Pool, ctx context.Context, id int64) (UserEnt, error) {
+	var res UserEnt
+
+	sql := `SELECT id, user_identifier, first_name, last_name, email, avatar_url, description, password, is_verify, created_date, updated_date, deleted_date,
+            two_factor_enabled, two_factor_secret, two_factor_last_step, locale, avatar_file_id,
+            role_id, COALESCE((SELECT role_code FROM roles WHERE id = users.role_id), '')
+            FROM users
+            WHERE id = $1 AND deleted_date IS NULL`
+
+	err := db.QueryRow(ctx, sql, id).Scan(
+		&res.ID,
+		&res.UserIdentifier,
+		&res.FirstName,
+		&res.LastName,
+		&res.Email,
+		&res.AvatarURL,
+		&res.Description,
+		&res.Password,
+		&res.IsVerified,
+		&res.CreatedDate,
+		&res.UpdatedDate,
+		&res.DeletedDate,
+		&res.TwoFactorEnabled,
+		&res.TwoFactorSecret,
+		&res.TwoFactorLastStep,
+		&res.Locale,
+		&res.AvatarFileID,
+		&res.RoleID,
+		&res.Role,
+	)
+
+	if err != nil {
+		return res, c.errHandler(ctx, "model.GetUserByID", err, utils.ErrGettingUserData)
+	}
+
+	return res, nil
+}
+
+// UpdateUserProfile update the profile, an empty locale keeps the current one. avatarFileID
+// is the uploaded file of the avatar, 0 when avatarURL is an external url.
+func (c *Contract) UpdateUserProfile(db *pgxpool.Pool, ctx context.Context, userIdentifier, firstName, lastName, description, avatarURL, locale string, avatarFileID int64) error {
 	sql := `
 		UPDATE users
-		SET avatar_url = $1, first_name = $2, last_name = $3, description = $4 
+		SET avatar_url = $1, first_name = $2, last_name = $3, description = $4, locale = COALESCE(NULLIF($6, ''), locale),
+			avatar_file_id = NULLIF($7, 0)
 		WHERE user_identifier = $5
 	`
 
-	_, err := db.Exec(ctx, sql, avatarURL, firstName, lastName, description, userIdentifier)
+	_, err := db.Exec(ctx, sql, avatarURL, firstName, lastName, description, userIdentifier, locale, avatarFileID)
 	if err != nil {
-		return c.errHandler("model.UpdateUserProfile", err, utils.ErrUpdatingUserProfile)
+		return c.errHandler(ctx, "model.UpdateUserProfile", err, utils.ErrUpdatingUserProfile)
 	}
 
 	return nil
@@ -108,44 +179,60 @@ func (c *Contract) UpdateUserEmail(db *pgxpool.Pool, ctx context.Context, userId
 
 	_, err := db.Exec(ctx, sql, email, userIdentifier)
 	if err != nil {
-		return c.errHandler("model.UpdateUserEmail", err, utils.ErrUpdatingUserEmail)
+		return c.errHandler(ctx, "model.UpdateUserEmail", err, utils.ErrUpdatingUserEmail)
 	}
 
 	return nil
 }
 
-func (c *Contract) UpdatePasswordUser(db *pgxpool.Pool, ctx context.Context, userIdentifier, OldPassword, NewPassword, ConfirmPassword string) error {
+func (c *Contract) UpdatePasswordUser(db *pgxpool.Pool, ctx context.Context, userIdentifier, sessionIdentifier, OldPassword, NewPassword, ConfirmPassword string) error {
 	var (
 		err      error
 		dataUser UserEnt
 	)
 	// Check if new password matches the confirmation
 	if NewPassword != ConfirmPassword {
-		return errors.New(utils.ErrPasswordMismatch)
+		return apperr.New(apperr.Validation, apperr.CodePasswordMismatch, utils.ErrPasswordMismatch)
 	}
 
 	dataUser, err = c.GetUserByUserIdentifier(db, ctx, userIdentifier)
 	if err != nil {
-		return c.errHandler("model.UpdatePasswordUser", err, utils.ErrFetchingUserPassword)
+		return c.errHandler(ctx, "model.UpdatePasswordUser", err, utils.ErrFetchingUserPassword)
 	}
 
 	// Validate old password
 	err = bcrypt.CompareHashAndPassword([]byte(dataUser.Password), []byte(OldPassword))
 	if err != nil {
-		return errors.New("old password is incorrect")
+		return apperr.New(apperr.Validation, apperr.CodeInvalidPassword, utils.ErrOldPasswordIncorrect)
 	}
 
 	// Hash the new password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(NewPassword), bcrypt.DefaultCost)
 	if err != nil {
-		return c.errHandler("model.UpdatePasswordUser", err, utils.ErrHashingPassword)
+		return c.errHandler(ctx, "model.UpdatePasswordUser", err, utils.ErrHashingPassword)
 	}
 
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return c.errHandler(ctx, "model.UpdatePasswordUser", err, utils.ErrBeginningTransaction)
+	}
+	defer tx.Rollback(ctx)
+
 	// Update the user's password in the database
 	sql := "UPDATE users SET password = $1, updated_date = $3 WHERE id = $2"
-	_, err = db.Exec(ctx, sql, string(hashedPassword), dataUser.ID, time.Now().UTC())
+	_, err = tx.Exec(ctx, sql, string(hashedPassword), dataUser.ID, time.Now().UTC())
+	if err != nil {
+		return c.errHandler(ctx, "model.UpdatePasswordUser", err, utils.ErrUpdatingUserPassword)
+	}
+
+	// the other sessions, e.g. of a stolen refresh token, don't survive the new password
+	err = c.revokeOtherSessions(tx, ctx, dataUser.ID, sessionIdentifier)
 	if err != nil {
-		return c.errHandler("model.UpdatePasswordUser", err, utils.ErrUpdatingUserPassword)
+		return c.errHandler(ctx, "model.UpdatePasswordUser", err, utils.ErrRevokingSession)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return c.errHandler(ctx, "model.UpdatePasswordUser", err, utils.ErrCommittingTransaction)
 	}
 
 	return nil
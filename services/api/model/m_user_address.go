@@ -3,7 +3,8 @@ package model
 import (
 	"context"
 	"database/sql"
-	"errors"
+	"go-skeleton/lib/apperr"
+	"go-skeleton/lib/outbox"
 	"go-skeleton/lib/utils"
 	"time"
 
@@ -33,7 +34,7 @@ func (c *Contract) GetUserAddressesByUserID(db *pgxpool.Pool, ctx context.Contex
 	)
 	rows, err := db.Query(ctx, sql, userID)
 	if err != nil {
-		return res, c.errHandler("model.GetUserAddressesByUserID", err, utils.ErrGettingUserAddresses)
+		return res, c.errHandler(ctx, "model.GetUserAddressesByUserID", err, utils.ErrGettingUserAddresses)
 	}
 	defer rows.Close()
 
@@ -44,13 +45,13 @@ func (c *Contract) GetUserAddressesByUserID(db *pgxpool.Pool, ctx context.Contex
 			&address.CreatedDate, &address.UpdatedDate, &address.DeletedDate,
 		)
 		if err != nil {
-			return res, c.errHandler("model.GetUserAddressesByUserID", err, utils.ErrScanningUserAddresses)
+			return res, c.errHandler(ctx, "model.GetUserAddressesByUserID", err, utils.ErrScanningUserAddresses)
 		}
 		res = append(res, address)
 	}
 
 	if err := rows.Err(); err != nil {
-		return res, c.errHandler("model.GetUserAddressesByUserID", err, utils.ErrIteratingUserAddresses)
+		return res, c.errHandler(ctx, "model.GetUserAddressesByUserID", err, utils.ErrIteratingUserAddresses)
 	}
 
 	return res, nil
@@ -72,7 +73,7 @@ func (c *Contract) GetAddressByAddressIdentifier(db *pgxpool.Pool, ctx context.C
 		&res.CreatedDate, &res.UpdatedDate, &res.DeletedDate,
 	)
 	if err != nil {
-		return res, c.errHandler("model.GetAddressByAddressIdentifier", err, utils.ErrScanningUserAddresses)
+		return res, c.errHandler(ctx, "model.GetAddressByAddressIdentifier", err, utils.ErrScanningUserAddresses)
 	}
 
 	return res, nil
@@ -85,9 +86,33 @@ func (c *Contract) InsertUserAddress(db *pgxpool.Pool, ctx context.Context, user
         VALUES($1, $2, $3, $4, $5)
     `
 
-	_, err := db.Exec(ctx, sql, userID, addressIdentifier, title, fullAddress, time.Now().UTC())
+	tx, err := db.Begin(ctx)
 	if err != nil {
-		return c.errHandler("model.InsertUserAddress", err, utils.ErrInsertingUserAddress)
+		return c.errHandler(ctx, "model.InsertUserAddress", err, utils.ErrBeginningTransaction)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, sql, userID, addressIdentifier, title, fullAddress, time.Now().UTC())
+	if err != nil {
+		return c.errHandler(ctx, "model.InsertUserAddress", err, utils.ErrInsertingUserAddress)
+	}
+
+	err = outbox.Add(ctx, tx, outbox.Event{
+		Type:          utils.EventAddressCreated,
+		AggregateType: utils.AggregateAddress,
+		AggregateID:   addressIdentifier,
+		Data: map[string]interface{}{
+			"address_identifier": addressIdentifier,
+			"user_id":            userID,
+			"title":              title,
+		},
+	})
+	if err != nil {
+		return c.errHandler(ctx, "model.InsertUserAddress", err, utils.ErrInsertingUserAddress)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return c.errHandler(ctx, "model.InsertUserAddress", err, utils.ErrCommittingTransaction)
 	}
 
 	return nil
@@ -106,10 +131,10 @@ func (c *Contract) UpdateUserAddress(db *pgxpool.Pool, ctx context.Context, user
 	`
 	err = db.QueryRow(ctx, checkSQL, userID, addressIdentifier).Scan(&count)
 	if err != nil {
-		return c.errHandler("model.UpdateUserAddress", err, utils.ErrCheckingAddressIdentifier)
+		return c.errHandler(ctx, "model.UpdateUserAddress", err, utils.ErrCheckingAddressIdentifier)
 	}
 	if count == 0 {
-		return errors.New(utils.EmptyData)
+		return apperr.New(apperr.NotFound, apperr.CodeEmptyData, utils.EmptyData)
 	}
 
 	updateSQL := `
@@ -120,7 +145,7 @@ func (c *Contract) UpdateUserAddress(db *pgxpool.Pool, ctx context.Context, user
 
 	_, err = db.Exec(ctx, updateSQL, title, fullAddress, userID, addressIdentifier, time.Now().UTC())
 	if err != nil {
-		return c.errHandler("model.UpdateUserAddress", err, utils.ErrUpdatingUserAddress)
+		return c.errHandler(ctx, "model.UpdateUserAddress", err, utils.ErrUpdatingUserAddress)
 	}
 
 	return nil
@@ -136,10 +161,10 @@ func (c *Contract) DeleteUserAddress(db *pgxpool.Pool, ctx context.Context, user
     `
 	err := db.QueryRow(ctx, checkSQL, userID, addressIdentifier).Scan(&count)
 	if err != nil {
-		return c.errHandler("model.DeleteUserAddress", err, utils.ErrCheckingAddressIdentifier)
+		return c.errHandler(ctx, "model.DeleteUserAddress", err, utils.ErrCheckingAddressIdentifier)
 	}
 	if count == 0 {
-		return errors.New(utils.EmptyData)
+		return apperr.New(apperr.NotFound, apperr.CodeEmptyData, utils.EmptyData)
 	}
 
 	deleteSQL := `
@@ -149,7 +174,7 @@ func (c *Contract) DeleteUserAddress(db *pgxpool.Pool, ctx context.Context, user
 
 	_, err = db.Exec(ctx, deleteSQL, userID, addressIdentifier, time.Now().UTC())
 	if err != nil {
-		return c.errHandler("model.DeleteUserAddress", err, utils.ErrDeletingUserAddress)
+		return c.errHandler(ctx, "model.DeleteUserAddress", err, utils.ErrDeletingUserAddress)
 	}
 
 	return nil
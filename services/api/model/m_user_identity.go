@@ -0,0 +1,138 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-skeleton/lib/apperr"
+	"go-skeleton/lib/utils"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type UserIdentityEnt struct {
+	ID              int64          `db:"id"`
+	UserID          int64          `db:"user_id"`
+	Provider        string         `db:"provider"`
+	ProviderSubject string         `db:"provider_subject"`
+	Email           sql.NullString `db:"email"`
+	CreatedDate     time.Time      `db:"created_date"`
+	UpdatedDate     sql.NullTime   `db:"updated_date"`
+}
+
+// SocialProfile user data verified by the sign-in provider
+type SocialProfile struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+	AvatarURL     string
+}
+
+// SocialLogin find the user linked to the provider subject, link it to the user with
+// the same verified email or register a new user, then create the session.
+func (c *Contract) SocialLogin(db *pgxpool.Pool, ctx context.Context, profile SocialProfile) (UserEnt, TokenEnt, error) {
+	var (
+		err    error
+		userID int64
+		user   UserEnt
+		token  TokenEnt
+		now    = time.Now().UTC()
+	)
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return user, token, c.errHandler(ctx, "model.SocialLogin", err, utils.ErrBeginningTransaction)
+	}
+	defer tx.Rollback(ctx)
+
+	identitySQL := `SELECT user_id FROM user_identities WHERE provider = $1 AND provider_subject = $2`
+	err = tx.QueryRow(ctx, identitySQL, profile.Provider, profile.Subject).Scan(&userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return user, token, c.errHandler(ctx, "model.SocialLogin", err, utils.ErrGettingUserIdentity)
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		// link to the existing account only when the provider verified the email
+		userSQL := `SELECT id FROM users WHERE email = $1 AND deleted_date IS NULL`
+		err = tx.QueryRow(ctx, userSQL, profile.Email).Scan(&userID)
+		switch {
+		case err == nil:
+			if !profile.EmailVerified {
+				return user, token, apperr.New(apperr.Conflict, apperr.CodeSocialEmailNotVerified, utils.ErrSocialEmailNotVerified)
+			}
+		case errors.Is(err, pgx.ErrNoRows):
+			userID, err = c.insertSocialUser(tx, ctx, profile)
+			if err != nil {
+				return user, token, c.errHandler(ctx, "model.SocialLogin", err, utils.ErrInsertingUser)
+			}
+		default:
+			return user, token, c.errHandler(ctx, "model.SocialLogin", err, utils.ErrGettingUserByEmail)
+		}
+
+		linkSQL := `INSERT INTO user_identities (user_id, provider, provider_subject, email, created_date)
+			VALUES($1, $2, $3, $4, $5)`
+		_, err = tx.Exec(ctx, linkSQL, userID, profile.Provider, profile.Subject, profile.Email, now)
+		if err != nil {
+			return user, token, c.errHandler(ctx, "model.SocialLogin", err, utils.ErrLinkingUserIdentity)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return user, token, c.errHandler(ctx, "model.SocialLogin", err, utils.ErrCommittingTransaction)
+	}
+
+	user, err = c.GetUserByID(db, ctx, userID)
+	if err != nil {
+		return user, token, err
+	}
+
+	// Create session with access and refresh token, or the 2FA challenge
+	token, err = c.loginToken(db, ctx, user, utils.User)
+	if err != nil {
+		return user, token, err
+	}
+
+	return user, token, nil
+}
+
+// insertSocialUser register a user without a usable password, verified when the provider verified the email
+func (c *Contract) insertSocialUser(tx pgx.Tx, ctx context.Context, profile SocialProfile) (int64, error) {
+	var id int64
+
+	password, err := utils.RandomToken(32)
+	if err != nil {
+		return id, err
+	}
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return id, err
+	}
+
+	firstName := profile.FirstName
+	if len(firstName) == 0 {
+		firstName = profile.Email
+	}
+
+	sql := `INSERT INTO users (user_identifier, first_name, last_name, email, avatar_url, password, is_verify, created_date, role_id)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, (SELECT id FROM roles WHERE role_code = $9)) RETURNING id`
+	err = tx.QueryRow(ctx, sql, utils.GeneratePrefixCode(utils.UserPrefix), truncate(firstName, 50), truncate(profile.LastName, 50),
+		profile.Email, profile.AvatarURL, passwordHash, profile.EmailVerified, time.Now().UTC(), utils.RoleUser).Scan(&id)
+
+	return id, err
+}
+
+// truncate cut the string to the max length of the column
+func truncate(s string, max int) string {
+	r := []rune(s)
+	if len(r) > max {
+		return string(r[:max])
+	}
+
+	return s
+}
@@ -11,6 +11,8 @@ type RegisterUserReq struct {
 	Email           string `json:"email" validate:"required"`
 	Password        string `json:"password" validate:"required"`
 	ConfirmPassword string `json:"confirm_password" validate:"required"`
+	// Locale preferred language of the mails, the Accept-Language header when empty
+	Locale string `json:"locale" validate:"omitempty,oneof=en id"`
 }
 
 type RequestVerifyEmailReq struct {
@@ -27,3 +29,16 @@ type ResetPasswordReq struct {
 	NewPassword     string `json:"new_password" validate:"required"`
 	ConfirmPassword string `json:"confirm_password" validate:"required"`
 }
+
+type RefreshTokenReq struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type SocialLoginReq struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type TwoFactorVerifyReq struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+}
@@ -0,0 +1,70 @@
+package request
+
+import (
+	"go-skeleton/lib/array"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type MailParam struct {
+	Page     int    `json:"page"`
+	Limit    int    `json:"limit"`
+	Offset   int    `json:"offset"`
+	Count    int    `json:"count"`
+	Sort     string `json:"sort"`
+	Order    string `json:"order"`
+	Keyword  string `json:"keyword"`
+	Status   string `json:"status"`
+	Template string `json:"template"`
+}
+
+func (param *MailParam) ParseMail(values url.Values) error {
+	param.Keyword = ""
+	param.Page = 1
+	param.Limit = 10
+	param.Sort = "desc"
+	param.Order = "id"
+	param.Status = ""
+	param.Template = ""
+	param.Offset = 0
+
+	if page, ok := values["page"]; ok && len(page) > 0 {
+		if p, err := strconv.Atoi(page[0]); err == nil && p > 1 {
+			param.Page = p
+		}
+	}
+
+	if sort, ok := values["sort"]; ok && len(sort) > 0 && strings.ToLower(sort[0]) == "asc" {
+		param.Sort = "asc"
+	}
+
+	if order, ok := values["order"]; ok && len(order) > 0 {
+		arrStr := new(array.ArrStr)
+		if exist, _ := arrStr.InArray(order[0], []string{"id", "attempts", "next_attempt_date", "sent_date"}); exist {
+			param.Order = order[0]
+		}
+	}
+
+	if status, ok := values["status"]; ok && len(status) > 0 {
+		param.Status = status[0]
+	}
+
+	if template, ok := values["template"]; ok && len(template) > 0 {
+		param.Template = template[0]
+	}
+
+	if keyword, ok := values["keyword"]; ok && len(keyword) > 0 {
+		param.Keyword = keyword[0]
+	}
+
+	if limit, ok := values["limit"]; ok && len(limit) > 0 {
+		if l, err := strconv.Atoi(limit[0]); err == nil && l > 0 {
+			param.Limit = l
+		}
+	}
+
+	param.Offset = (param.Page - 1) * param.Limit
+
+	return nil
+}
@@ -5,6 +5,9 @@ type UpdateProfileUserReq struct {
 	LastName    string `json:"last_name"`
 	AvatarUrl   string `json:"avatar_url"`
 	Description string `json:"description"`
+	Locale      string `json:"locale" validate:"omitempty,oneof=en id"`
+	// AvatarFileIdentifier a public image uploaded by the user, used instead of avatar_url
+	AvatarFileIdentifier string `json:"avatar_file_identifier"`
 }
 
 type UpdatePasswordReq struct {
@@ -12,3 +15,7 @@ type UpdatePasswordReq struct {
 	NewPassword     string `json:"new_password" validate:"required"`
 	ConfirmPassword string `json:"confirm_password" validate:"required"`
 }
+
+type TwoFactorCodeReq struct {
+	Code string `json:"code" validate:"required"`
+}
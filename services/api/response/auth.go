@@ -1,15 +1,17 @@
 package response
 
 type LoginUserRes struct {
-	Token          string `json:"token"`
-	UserIdentifier string `json:"user_identifier"`
-	AvatarURL      string `json:"avatar_url"`
-	FirstName      string `json:"first_name"`
-	LastName       string `json:"last_name"`
-	Email          string `json:"email"`
-	ExpiredAt      string `json:"expired_at"`
-	ActorType      string `json:"actor_type"`
-	CreatedDate    string `json:"created_date"`
+	Token            string `json:"token"`
+	RefreshToken     string `json:"refresh_token"`
+	UserIdentifier   string `json:"user_identifier"`
+	AvatarURL        string `json:"avatar_url"`
+	FirstName        string `json:"first_name"`
+	LastName         string `json:"last_name"`
+	Email            string `json:"email"`
+	ExpiredAt        string `json:"expired_at"`
+	RefreshExpiredAt string `json:"refresh_expired_at"`
+	ActorType        string `json:"actor_type"`
+	CreatedDate      string `json:"created_date"`
 }
 
 type RegisterUserRes struct {
@@ -17,3 +19,9 @@ type RegisterUserRes struct {
 	Email          string `json:"email"`
 	CreatedDate    string `json:"created_date"`
 }
+
+type TwoFactorChallengeRes struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiredAt         string `json:"expired_at"`
+}
@@ -0,0 +1,29 @@
+package response
+
+import "time"
+
+type FileRes struct {
+	FileIdentifier string           `json:"file_identifier"`
+	OriginalName   string           `json:"original_name"`
+	MimeType       string           `json:"mime_type"`
+	Size           int64            `json:"size"`
+	Visibility     string           `json:"visibility"`
+	Sha256         string           `json:"sha256"`
+	URL            string           `json:"url"`
+	Width          int              `json:"width"`
+	Height         int              `json:"height"`
+	Variants       []FileVariantRes `json:"variants"`
+	CreatedDate    time.Time        `json:"created_date"`
+}
+
+type FileVariantRes struct {
+	Size   int    `json:"size"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+}
+
+type FileURLRes struct {
+	URL         string    `json:"url"`
+	ExpiredDate time.Time `json:"expired_date"`
+}
@@ -0,0 +1,30 @@
+package response
+
+import "time"
+
+type MailRes struct {
+	MailIdentifier  string     `json:"mail_identifier"`
+	Template        string     `json:"template"`
+	Locale          string     `json:"locale"`
+	Recipient       string     `json:"recipient"`
+	Subject         string     `json:"subject"`
+	Status          string     `json:"status"`
+	Attempts        int        `json:"attempts"`
+	MaxAttempts     int        `json:"max_attempts"`
+	LastError       string     `json:"last_error"`
+	NextAttemptDate time.Time  `json:"next_attempt_date"`
+	SentDate        *time.Time `json:"sent_date"`
+	CreatedDate     time.Time  `json:"created_date"`
+}
+
+type MailDetailRes struct {
+	MailRes
+	Deliveries []MailDeliveryRes `json:"deliveries"`
+}
+
+type MailDeliveryRes struct {
+	Attempt     int       `json:"attempt"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error"`
+	CreatedDate time.Time `json:"created_date"`
+}
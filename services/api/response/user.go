@@ -19,9 +19,20 @@ type UserProfileRes struct {
 	LastName       string `json:"last_name"`
 	Email          string `json:"email"`
 	AvatarURL      string `json:"avatar_url"`
-	IsVerified     bool   `json:"is_verify"`
-	CreatedDate    string `json:"created_date"`
-	UpdatedDate    string `json:"updated_date"`
+	// AvatarVariants the thumbnails of an uploaded avatar
+	AvatarVariants   []FileVariantRes `json:"avatar_variants"`
+	IsVerified       bool             `json:"is_verify"`
+	TwoFactorEnabled bool             `json:"two_factor_enabled"`
+	Role             string           `json:"role"`
+	Locale           string           `json:"locale"`
+	CreatedDate      string           `json:"created_date"`
+	UpdatedDate      string           `json:"updated_date"`
+}
+
+type TwoFactorEnrollRes struct {
+	Secret        string   `json:"secret"`
+	OtpauthURI    string   `json:"otpauth_uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
 }
 
 type UserAddressRes struct {
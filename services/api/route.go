@@ -2,18 +2,39 @@ package api
 
 import (
 	"go-skeleton/bootstrap"
+	"go-skeleton/lib/facebook"
+	"go-skeleton/lib/google"
 	"go-skeleton/services/api/handler"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
 
+// request timeout of the routes, overridden with http.timeout.<name> in config
+const (
+	defaultTimeout = 30 * time.Second
+	uploadTimeout  = 5 * time.Minute
+)
+
 // RegisterRoutes all routes for the apps
 func RegisterRoutes(r *chi.Mux, app *bootstrap.App) {
+	r.Get("/.well-known/jwks.json", app.JWKSAction)
+
+	// Kubernetes probes
+	r.Get("/healthz", app.LivenessAction)
+	r.Get("/readyz", app.ReadinessAction)
+
+	// the uploads of the local storage, a proxy or a bucket serves them otherwise
+	if app.Config.GetBool("storage.local.serve") {
+		h := handler.Contract{App: app}
+		r.With(app.Timeout("upload", uploadTimeout)).Get("/storage/*", h.ServeStorageAct)
+	}
+
 	r.Route("/v1", func(r chi.Router) {
 		r.Get("/ping", app.PingAction)
 
 		AppSubsRoute(r, app)
-		// CMSSubsRoute(r, app)
+		CMSSubsRoute(r, app)
 	})
 }
 
@@ -21,22 +42,52 @@ func AppSubsRoute(r chi.Router, app *bootstrap.App) {
 	h := handler.Contract{App: app}
 
 	r.Route("/auths", func(r chi.Router) {
-		r.Post("/login", h.LoginUserAct)
-		r.Post("/register", h.RegisterUserAct)
+		r.Use(app.Timeout("default", defaultTimeout))
+		r.With(app.RateLimit(
+			app.RateLimitPolicy("login_ip", 20, time.Minute, bootstrap.KeyByIP),
+			app.RateLimitPolicy("login_email", 10, 15*time.Minute, bootstrap.KeyByEmail),
+		)).Post("/login", h.LoginUserAct)
+		r.With(app.RateLimit(
+			app.RateLimitPolicy("register_ip", 5, time.Hour, bootstrap.KeyByIP),
+		)).Post("/register", h.RegisterUserAct)
+		// the social logins are served only when the provider is configured
+		if google.Enabled(app) {
+			r.Post("/google", h.GoogleLoginUserAct)
+		}
+		if facebook.Enabled(app) {
+			r.Post("/facebook", h.FacebookLoginUserAct)
+		}
+		r.Post("/refresh", h.RefreshTokenUserAct)
+		r.With(app.RateLimit(
+			app.RateLimitPolicy("two_factor_ip", 10, 5*time.Minute, bootstrap.KeyByIP),
+			app.RateLimitPolicy("two_factor_user", 10, 15*time.Minute, app.KeyByChallengeUser),
+		)).Post("/2fa/verify", h.VerifyTwoFactorUserAct)
+		r.With(app.VerifyJwtTokenUser).Post("/logout", h.LogoutUserAct)
 
 		// Request Token for Registration and ForgotPassword
-		r.Post("/request-token", h.RequestVerifyEmailUserAct)
-		r.Post("/verify-token", h.VerifyTokenUserAct)
+		r.With(app.RateLimit(
+			app.RateLimitPolicy("request_token_ip", 10, time.Hour, bootstrap.KeyByIP),
+			app.RateLimitPolicy("request_token_email", 3, 15*time.Minute, bootstrap.KeyByEmail),
+		)).Post("/request-token", h.RequestVerifyEmailUserAct)
+		r.With(app.RateLimit(
+			app.RateLimitPolicy("verify_token_ip", 10, 15*time.Minute, bootstrap.KeyByIP),
+		)).Post("/verify-token", h.VerifyTokenUserAct)
 		r.With(app.VerifyJwtTokenUser).Post("/reset-password", h.ResetPasswordUserAct)
 	})
 
 	// User
 	r.Route("/users", func(r chi.Router) {
+		r.Use(app.Timeout("default", defaultTimeout))
 		// User Profile
 		r.Route("/profile", func(r chi.Router) {
 			r.Use(app.VerifyJwtTokenUser)
 			r.Get("/", h.GetUserProfileAct)
 			r.Put("/", h.UpdateUserProfileAct)
+
+			// Two-factor authentication
+			r.Post("/2fa", h.EnrollTwoFactorUserAct)
+			r.Post("/2fa/confirm", h.ConfirmTwoFactorUserAct)
+			r.Post("/2fa/disable", h.DisableTwoFactorUserAct)
 		})
 
 		// User Addresses
@@ -49,20 +100,61 @@ func AppSubsRoute(r chi.Router, app *bootstrap.App) {
 			r.Delete("/{code}", h.DeleteUserAddressAct)
 		})
 
-		r.With(app.VerifyJwtTokenUser).Put("/update-password", h.UpdatePasswordUserAct)
+		r.With(app.VerifyJwtTokenUser, app.RateLimit(
+			app.RateLimitPolicy("update_password_user", 5, 15*time.Minute, bootstrap.KeyByUserIdentifier),
+		)).Put("/update-password", h.UpdatePasswordUserAct)
 	})
 
 	// Master Setting
 	r.Route("/settings", func(r chi.Router) {
+		r.Use(app.Timeout("default", defaultTimeout))
 		r.Get("/", h.GetSettingListAct)
 		r.Get("/{code}", h.GetSettingDetailAct)
-		r.With(app.VerifyJwtTokenUser).Post("/", h.AddSettingAct)
-		r.With(app.VerifyJwtTokenUser).Put("/{code}", h.UpdateSettingAct)
 	})
 
 	// Upload
 	r.Route("/uploads", func(r chi.Router) {
+		r.Use(app.Timeout("upload", uploadTimeout))
 		r.Use(app.VerifyJwtTokenUser)
+		r.Get("/", h.GetUploadListAct)
 		r.Post("/", h.UploadFileAct)
+
+		// resumable uploads of the tus protocol
+		r.Route("/tus", func(r chi.Router) {
+			r.Options("/", h.TusOptionsAct)
+			r.Post("/", h.TusCreateAct)
+			r.Head("/{code}", h.TusHeadAct)
+			r.Patch("/{code}", h.TusPatchAct)
+			r.Delete("/{code}", h.TusDeleteAct)
+		})
+		r.Get("/{code}", h.GetUploadAct)
+		r.Get("/{code}/url", h.GetUploadURLAct)
+		r.Delete("/{code}", h.DeleteUploadAct)
+	})
+}
+
+// CMSSubsRoute admin routes, every route requires the cms channel and a permission of the user role
+func CMSSubsRoute(r chi.Router, app *bootstrap.App) {
+	h := handler.Contract{App: app}
+
+	r.Route("/cms", func(r chi.Router) {
+		r.Use(app.Timeout("default", defaultTimeout))
+		r.Use(app.RequireChannel(bootstrap.ChannelCMS))
+		r.Use(app.VerifyJwtTokenUser)
+
+		// Master Setting
+		r.Route("/settings", func(r chi.Router) {
+			r.With(app.RequirePermission("settings:read")).Get("/", h.GetSettingListAct)
+			r.With(app.RequirePermission("settings:read")).Get("/{code}", h.GetSettingDetailAct)
+			r.With(app.RequirePermission("settings:write")).Post("/", h.AddSettingAct)
+			r.With(app.RequirePermission("settings:write")).Put("/{code}", h.UpdateSettingAct)
+		})
+
+		// Mail Queue
+		r.Route("/mails", func(r chi.Router) {
+			r.With(app.RequirePermission("mails:read")).Get("/", h.GetMailListAct)
+			r.With(app.RequirePermission("mails:read")).Get("/{code}", h.GetMailDetailAct)
+			r.With(app.RequirePermission("mails:write")).Post("/{code}/resend", h.ResendMailAct)
+		})
 	})
 }
@@ -4,17 +4,23 @@ import (
 	"context"
 	"fmt"
 	"go-skeleton/bootstrap"
+	"go-skeleton/lib/mail"
+	"go-skeleton/lib/outbox"
+	"go-skeleton/lib/rabbit"
+	"go-skeleton/lib/upload"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/go-chi/valve"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/urfave/cli/v2"
 )
 
@@ -34,9 +40,41 @@ func (boo boot) CommandFlags() []cli.Flag {
 			Value: "127.0.0.1:3000",
 			Usage: "Run API serive with custom host",
 		},
+		&cli.StringFlag{
+			Name:  "admin-host",
+			Usage: "Serve /metrics on a separate admin host, e.g. 127.0.0.1:9090 (default config app.admin_host)",
+		},
 	}
 }
 
+// shutdownDelay time between failing /readyz and closing the server, config app.shutdown_delay (seconds)
+func (b boot) shutdownDelay() time.Duration {
+	delay := b.App.Config.GetInt("app.shutdown_delay")
+	if delay < 0 {
+		delay = 0
+	}
+
+	return time.Duration(delay) * time.Second
+}
+
+// runOutboxRelay publish the events of the outbox until ctx is done, config queue.outbox.*
+func (b boot) runOutboxRelay(ctx context.Context) {
+	exchange := b.App.Config.GetString("queue.outbox.exchange")
+	if len(exchange) == 0 {
+		exchange = outbox.DefaultExchange
+	}
+	publisher := rabbit.NewPublisher(b.App.Config.GetString("queue.rabbitmq.host"), exchange)
+	defer publisher.Close()
+
+	relay := outbox.NewRelay(b.App.DB, publisher, outbox.RelayOptions{
+		Interval:  time.Duration(b.App.Config.GetInt("queue.outbox.interval")) * time.Millisecond,
+		BatchSize: b.App.Config.GetInt("queue.outbox.batch_size"),
+	})
+
+	log.Printf("Outbox Relay -> Publishing to exchange [%v]", exchange)
+	relay.Run(ctx)
+}
+
 // Start main function to run the http host
 func (b boot) Start(c *cli.Context) error {
 	var err error
@@ -57,7 +95,7 @@ func (b boot) Start(c *cli.Context) error {
 	r := chi.NewRouter()
 	cr := cors.New(cors.Options{
 		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "HEAD", "PATCH"},
 		AllowedHeaders: []string{
 			"Accept",
 			"Authorization",
@@ -73,31 +111,103 @@ func (b boot) Start(c *cli.Context) error {
 			"Cache-Control",
 			"Token",
 			"X-Token",
+			"traceparent",
+			bootstrap.RequestIDHeader,
+			upload.HeaderTusResumable,
+			upload.HeaderUploadLength,
+			upload.HeaderUploadOffset,
+			upload.HeaderUploadMeta,
+			upload.HeaderUploadDefer,
+		},
+		ExposedHeaders: []string{
+			"Link",
+			"Retry-After",
+			"RateLimit-Limit",
+			"RateLimit-Remaining",
+			"RateLimit-Reset",
+			"RateLimit-Policy",
+			bootstrap.TraceIDHeader,
+			bootstrap.RequestIDHeader,
+			"Location",
+			upload.HeaderTusResumable,
+			upload.HeaderTusVersion,
+			upload.HeaderTusExtension,
+			upload.HeaderTusMaxSize,
+			upload.HeaderUploadLength,
+			upload.HeaderUploadOffset,
+			upload.HeaderUploadMeta,
+			upload.HeaderUploadExpires,
+			upload.HeaderFileIdentifier,
 		},
-		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	})
 	r.Use(cr.Handler)
-	if b.App.Debug {
-		r.Use(middleware.Logger)
+	// the client IP of the rate limiter is taken from X-Forwarded-For/X-Real-IP
+	// only behind a trusted proxy, otherwise the header can be spoofed
+	if b.App.Config.GetBool("app.trust_proxy") {
+		r.Use(middleware.RealIP)
 	}
+	r.Use(b.App.RequestID)
+	r.Use(b.App.TracingMiddleware)
+	r.Use(b.App.AccessLog)
+	r.Use(b.App.MetricsMiddleware)
 	r.Use(b.App.Recoverer)
 	r.Use(b.App.NotfoundMiddleware)
 
 	// call routes
+	b.App.SetupHealthChecks()
 	RegisterRoutes(r, b.App)
 
+	// metrics are served on the admin host only, so they aren't public
+	adminHost := c.String("admin-host")
+	if len(adminHost) == 0 {
+		adminHost = b.App.Config.GetString("app.admin_host")
+	}
+	var adminSrv *http.Server
+	if len(adminHost) > 0 {
+		b.App.RegisterPoolMetrics()
+
+		adminRouter := chi.NewRouter()
+		adminRouter.Handle("/metrics", promhttp.Handler())
+		adminSrv = &http.Server{Addr: adminHost, Handler: adminRouter}
+
+		go func() {
+			log.Printf("Admin Service -> Serving /metrics at host [%v]", adminHost)
+			if err := adminSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("Admin Service -> %v", err)
+			}
+		}()
+	}
+
+	// the domain events are published by the relay of the instances with queue.outbox.relay,
+	// it's stopped once the server is shut down
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	defer stopRelay()
+	if b.App.Config.GetBool("queue.outbox.relay") {
+		go b.runOutboxRelay(relayCtx)
+	}
+	// the queued mails are sent by the instances with mail.queue.sender
+	if b.App.Config.GetBool("mail.queue.sender") {
+		log.Println("Mail Sender -> Sending the queued mails")
+		go mail.NewSender(b.App).Run(relayCtx)
+	}
+
 	// handle grace full shutdown
 	srv := http.Server{Addr: host, Handler: r}
 	srv.BaseContext = func(_ net.Listener) context.Context {
 		return baseCtx
 	}
 	sng := make(chan os.Signal, 1)
-	signal.Notify(sng, os.Interrupt)
+	signal.Notify(sng, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		for range sng {
 			fmt.Println("shutting down..")
+
+			// fail the readiness probe first and give the load balancer time to
+			// remove this instance before the server stops accepting requests
+			b.App.SetNotReady()
+			time.Sleep(b.shutdownDelay())
 			err = valv.Shutdown(20 * time.Second)
 			if err != nil {
 				log.Println("Can't shutdown this server until all process are done!")
@@ -110,6 +220,10 @@ func (b boot) Start(c *cli.Context) error {
 			if err != nil {
 				log.Println("Can't shutdown this server until all process are done!")
 			}
+			if adminSrv != nil {
+				_ = adminSrv.Shutdown(ctx)
+			}
+			stopRelay()
 			select {
 			case <-time.After(21 * time.Second):
 				fmt.Println("not all connections done")
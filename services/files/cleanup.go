@@ -0,0 +1,301 @@
+package files
+
+import (
+	"context"
+	"go-skeleton/bootstrap"
+	"go-skeleton/lib/psql"
+	"go-skeleton/lib/storage"
+	"go-skeleton/lib/upload"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// prefixes of the uploaded objects, the other objects of the storage aren't files
+var uploadPrefixes = []string{"uploads/", "private/uploads/"}
+
+// batchSize of the file records and the object keys handled by a query
+const batchSize = 500
+
+// CleanupOptions of Cleanup
+type CleanupOptions struct {
+	DryRun bool
+	// Retention a soft deleted file is kept
+	Retention time.Duration
+	// Grace an object without a record is kept, the record of an upload is inserted after
+	// its object is stored
+	Grace time.Duration
+}
+
+// CleanupResult the number of deleted files, orphan objects and expired uploads
+type CleanupResult struct {
+	Files   int
+	Orphans int
+	Uploads int
+}
+
+// Cleanup delete the files soft deleted before the retention period with their object, the
+// expired resumable uploads with their parts, then the objects of the upload prefixes without
+// a file record
+func Cleanup(ctx context.Context, app *bootstrap.App, opts CleanupOptions) (CleanupResult, error) {
+	var res CleanupResult
+
+	// the queries run on a single connection without the statement_timeout of the API
+	conn, err := app.DB.Acquire(ctx)
+	if err != nil {
+		return res, err
+	}
+	defer conn.Release()
+	restore, err := psql.DisableStatementTimeout(ctx, conn)
+	if err != nil {
+		return res, err
+	}
+	defer restore()
+
+	n, err := cleanupDeleted(ctx, app, conn, opts)
+	res.Files = n
+	if err != nil {
+		return res, err
+	}
+
+	n, err = cleanupExpiredUploads(ctx, app, conn, opts)
+	res.Uploads = n
+	if err != nil {
+		return res, err
+	}
+
+	n, err = cleanupOrphans(ctx, app, conn, opts)
+	res.Orphans = n
+
+	return res, err
+}
+
+// cleanupDeleted the soft deleted files, the object is kept while another record uses its key
+func cleanupDeleted(ctx context.Context, app *bootstrap.App, conn *pgxpool.Conn, opts CleanupOptions) (int, error) {
+	var (
+		deleted int
+		lastID  int64
+		before  = time.Now().UTC().Add(-opts.Retention)
+		sql     = `SELECT f.id, f.storage_key,
+			EXISTS (SELECT 1 FROM files o WHERE o.storage_key = f.storage_key AND o.id <> f.id AND o.deleted_date IS NULL),
+			COALESCE((SELECT array_agg(v->>'key') FROM jsonb_array_elements(f.variants) v), '{}')
+		FROM files f
+		WHERE f.deleted_date < $1 AND f.id > $2
+		ORDER BY f.id
+		LIMIT $3`
+	)
+
+	for {
+		type expired struct {
+			id       int64
+			key      string
+			shared   bool
+			variants []string
+		}
+		var batch []expired
+
+		rows, err := conn.Query(ctx, sql, before, lastID, batchSize)
+		if err != nil {
+			return deleted, err
+		}
+		for rows.Next() {
+			var v expired
+			if err = rows.Scan(&v.id, &v.key, &v.shared, &v.variants); err != nil {
+				rows.Close()
+				return deleted, err
+			}
+			batch = append(batch, v)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return deleted, err
+		}
+		if len(batch) == 0 {
+			return deleted, nil
+		}
+
+		for _, v := range batch {
+			lastID = v.id
+			if opts.DryRun {
+				log.Printf("[files] would delete file %d %s", v.id, v.key)
+				deleted++
+				continue
+			}
+
+			if !v.shared {
+				if err = deleteObjects(ctx, app, append([]string{v.key}, v.variants...)); err != nil {
+					log.Printf("[files] delete object %s: %v", v.key, err)
+					continue
+				}
+			}
+			if _, err = conn.Exec(ctx, `DELETE FROM files WHERE id = $1`, v.id); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+	}
+}
+
+// deleteObjects the object of a file and its variants
+func deleteObjects(ctx context.Context, app *bootstrap.App, keys []string) error {
+	for _, key := range keys {
+		if err := app.Storage.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cleanupExpiredUploads the resumable uploads without progress before their expiry, their
+// multipart upload is aborted and their pending objects deleted
+func cleanupExpiredUploads(ctx context.Context, app *bootstrap.App, conn *pgxpool.Conn, opts CleanupOptions) (int, error) {
+	var (
+		deleted int
+		lastID  int64
+		sql     = `SELECT id, upload_identifier, storage_key, multipart_id
+		FROM file_uploads
+		WHERE expires_date < NOW() AND (locked_until IS NULL OR locked_until < NOW()) AND id > $1
+		ORDER BY id
+		LIMIT $2`
+	)
+
+	for {
+		type expired struct {
+			id          int64
+			identifier  string
+			key         string
+			multipartID string
+		}
+		var batch []expired
+
+		rows, err := conn.Query(ctx, sql, lastID, batchSize)
+		if err != nil {
+			return deleted, err
+		}
+		for rows.Next() {
+			var v expired
+			if err = rows.Scan(&v.id, &v.identifier, &v.key, &v.multipartID); err != nil {
+				rows.Close()
+				return deleted, err
+			}
+			batch = append(batch, v)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return deleted, err
+		}
+		if len(batch) == 0 {
+			return deleted, nil
+		}
+
+		for _, v := range batch {
+			lastID = v.id
+			if opts.DryRun {
+				log.Printf("[files] would delete expired upload %s", v.identifier)
+				deleted++
+				continue
+			}
+
+			if mp, ok := app.Storage.(storage.Multipart); ok && len(v.multipartID) > 0 {
+				if err = mp.AbortMultipart(ctx, v.key, v.multipartID); err != nil {
+					log.Printf("[files] abort upload %s: %v", v.identifier, err)
+					continue
+				}
+			}
+			var pending []string
+			err = app.Storage.List(ctx, upload.TusPendingPrefix+v.identifier+"/", func(obj storage.Object) error {
+				pending = append(pending, obj.Key)
+				return nil
+			})
+			if err == nil {
+				err = deleteObjects(ctx, app, pending)
+			}
+			if err != nil {
+				log.Printf("[files] delete pending objects of upload %s: %v", v.identifier, err)
+				continue
+			}
+			if _, err = conn.Exec(ctx, `DELETE FROM file_uploads WHERE id = $1`, v.id); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+	}
+}
+
+// cleanupOrphans the objects older than the grace period without a file record, e.g. the
+// upload failed after its object was stored
+func cleanupOrphans(ctx context.Context, app *bootstrap.App, conn *pgxpool.Conn, opts CleanupOptions) (int, error) {
+	var (
+		deleted int
+		before  = time.Now().Add(-opts.Grace)
+		keys    []string
+	)
+
+	flush := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+
+		known := make(map[string]bool, len(keys))
+		rows, err := conn.Query(ctx, `SELECT storage_key FROM files WHERE storage_key = ANY($1)
+			UNION SELECT v->>'key' FROM files, jsonb_array_elements(variants) v WHERE v->>'key' = ANY($1)`, keys)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var key string
+			if err = rows.Scan(&key); err != nil {
+				rows.Close()
+				return err
+			}
+			known[key] = true
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			if known[key] {
+				continue
+			}
+			if opts.DryRun {
+				log.Printf("[files] would delete orphan object %s", key)
+				deleted++
+				continue
+			}
+			if err = app.Storage.Delete(ctx, key); err != nil {
+				log.Printf("[files] delete orphan object %s: %v", key, err)
+				continue
+			}
+			deleted++
+		}
+		keys = keys[:0]
+
+		return nil
+	}
+
+	for _, prefix := range uploadPrefixes {
+		err := app.Storage.List(ctx, prefix, func(obj storage.Object) error {
+			if obj.ModTime.After(before) {
+				return nil
+			}
+			keys = append(keys, obj.Key)
+			if len(keys) < batchSize {
+				return nil
+			}
+
+			return flush()
+		})
+		if err != nil {
+			return deleted, err
+		}
+		if err = flush(); err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
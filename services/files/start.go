@@ -0,0 +1,83 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"go-skeleton/bootstrap"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+const usage = `usage: files [--dry-run] [--retention days] [--grace hours] <command>
+
+commands:
+  cleanup     delete the files soft deleted before the retention period, the expired
+              resumable uploads and the storage objects without a file record`
+
+// defaults of the cleanup when upload.cleanup.* is empty
+const (
+	defaultRetention = 30 * 24 * time.Hour
+	defaultGrace     = 24 * time.Hour
+)
+
+// Boot ...
+type boot struct {
+	App *bootstrap.App
+}
+
+func Booting(app *bootstrap.App) bootstrap.Service {
+	return &boot{App: app}
+}
+
+func (boo boot) CommandFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Print what would be deleted without deleting it",
+		},
+		&cli.IntFlag{
+			Name:  "retention",
+			Usage: "Days a soft deleted file is kept (default config upload.cleanup.retention_days or 30)",
+		},
+		&cli.IntFlag{
+			Name:  "grace",
+			Usage: "Hours before an object without a file record is an orphan (default config upload.cleanup.orphan_grace_hours or 24)",
+		},
+	}
+}
+
+// Start run the files command against app.DB and app.Storage
+func (b boot) Start(c *cli.Context) error {
+	opts := CleanupOptions{
+		DryRun:    c.Bool("dry-run"),
+		Retention: defaultRetention,
+		Grace:     defaultGrace,
+	}
+	if days := c.Int("retention"); days > 0 {
+		opts.Retention = time.Duration(days) * 24 * time.Hour
+	} else if days = b.App.Config.GetInt("upload.cleanup.retention_days"); days > 0 {
+		opts.Retention = time.Duration(days) * 24 * time.Hour
+	}
+	if hours := c.Int("grace"); hours > 0 {
+		opts.Grace = time.Duration(hours) * time.Hour
+	} else if hours = b.App.Config.GetInt("upload.cleanup.orphan_grace_hours"); hours > 0 {
+		opts.Grace = time.Duration(hours) * time.Hour
+	}
+
+	// stop between two deletions on interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch c.Args().First() {
+	case "cleanup":
+		res, err := Cleanup(ctx, b.App, opts)
+		fmt.Printf("deleted files: %d, expired uploads: %d, orphan objects: %d\n", res.Files, res.Uploads, res.Orphans)
+		return err
+	}
+
+	return fmt.Errorf("%s", usage)
+}
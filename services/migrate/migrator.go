@@ -0,0 +1,362 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-skeleton/lib/psql"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// schemaTable is compatible with the table used by golang-migrate, so
+	// databases migrated by hand with the migrate CLI keep their version.
+	schemaTable = "schema_migrations"
+
+	// advisoryLockID is the key of the postgres advisory lock that is held
+	// while migrating, so two instances can't migrate at the same time.
+	advisoryLockID int64 = 7291534601
+
+	// NilVersion is the version of a database without any applied migration
+	NilVersion int64 = -1
+)
+
+var fileRegex = regexp.MustCompile(`^([0-9]+)_(.*)\.(up|down)\.sql$`)
+
+// Migration is a pair of numbered up/down sql files
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrator apply the migration files into the database
+type Migrator struct {
+	db         *pgxpool.Pool
+	path       string
+	migrations []Migration
+}
+
+// NewMigrator read all migration files from the path
+func NewMigrator(db *pgxpool.Pool, path string) (*Migrator, error) {
+	m := &Migrator{db: db, path: path}
+
+	files, err := os.ReadDir(path)
+	if err != nil {
+		return m, err
+	}
+
+	index := map[int64]*Migration{}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+
+		match := fileRegex.FindStringSubmatch(f.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return m, fmt.Errorf("invalid migration version %s: %v", f.Name(), err)
+		}
+
+		mig, ok := index[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: match[2]}
+			index[version] = mig
+		}
+
+		fPath := filepath.Join(path, f.Name())
+		switch match[3] {
+		case "up":
+			if len(mig.Up) > 0 {
+				return m, fmt.Errorf("duplicate up migration for version %d", version)
+			}
+			mig.Up = fPath
+		case "down":
+			if len(mig.Down) > 0 {
+				return m, fmt.Errorf("duplicate down migration for version %d", version)
+			}
+			mig.Down = fPath
+		}
+	}
+
+	for _, mig := range index {
+		m.migrations = append(m.migrations, *mig)
+	}
+	sort.Slice(m.migrations, func(i, j int) bool {
+		return m.migrations[i].Version < m.migrations[j].Version
+	})
+
+	return m, nil
+}
+
+// Migrations list of the migration files sorted by version
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// session run fn on a single connection that holds the migration advisory lock
+func (m *Migrator) session(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	// a migration can run longer than the statement_timeout of the API queries
+	restore, err := psql.DisableStatementTimeout(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	if _, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", advisoryLockID); err != nil {
+		return fmt.Errorf("can't acquire migration lock: %v", err)
+	}
+	defer func() {
+		_, _ = conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", advisoryLockID)
+	}()
+
+	sql := `CREATE TABLE IF NOT EXISTS ` + schemaTable + ` (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)`
+	if _, err = conn.Exec(ctx, sql); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// version get the current version of the database
+func (m *Migrator) version(ctx context.Context, conn *pgxpool.Conn) (int64, bool, error) {
+	var (
+		version int64
+		dirty   bool
+	)
+
+	err := conn.QueryRow(ctx, `SELECT version, dirty FROM `+schemaTable+` LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return NilVersion, false, nil
+		}
+		return NilVersion, false, err
+	}
+
+	return version, dirty, nil
+}
+
+// setVersion replace the stored version of the database
+func setVersion(ctx context.Context, tx pgx.Tx, version int64, dirty bool) error {
+	if _, err := tx.Exec(ctx, `TRUNCATE `+schemaTable); err != nil {
+		return err
+	}
+
+	if version == NilVersion {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, `INSERT INTO `+schemaTable+` (version, dirty) VALUES ($1, $2)`, version, dirty)
+	return err
+}
+
+// Version get the current version of the database
+func (m *Migrator) Version(ctx context.Context) (int64, bool, error) {
+	var (
+		version int64
+		dirty   bool
+	)
+
+	err := m.session(ctx, func(conn *pgxpool.Conn) error {
+		var err error
+		version, dirty, err = m.version(ctx, conn)
+		return err
+	})
+
+	return version, dirty, err
+}
+
+// Up apply the next n pending migrations, or all of them when n < 1
+func (m *Migrator) Up(ctx context.Context, n int) error {
+	return m.session(ctx, func(conn *pgxpool.Conn) error {
+		current, dirty, err := m.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("database is dirty at version %d, fix it and use force", current)
+		}
+
+		applied := 0
+		for _, mig := range m.migrations {
+			if mig.Version <= current {
+				continue
+			}
+			if n > 0 && applied >= n {
+				break
+			}
+
+			if err = m.run(ctx, conn, mig.Up, mig.Version); err != nil {
+				return fmt.Errorf("migration %d_%s up: %v", mig.Version, mig.Name, err)
+			}
+			fmt.Printf("%d/u %s\n", mig.Version, mig.Name)
+			applied++
+		}
+
+		if applied == 0 {
+			fmt.Println("no change")
+		}
+
+		return nil
+	})
+}
+
+// Down roll back the last n applied migrations, or all of them when n < 1
+func (m *Migrator) Down(ctx context.Context, n int) error {
+	return m.session(ctx, func(conn *pgxpool.Conn) error {
+		current, dirty, err := m.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("database is dirty at version %d, fix it and use force", current)
+		}
+
+		rolled := 0
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mig := m.migrations[i]
+			if mig.Version > current {
+				continue
+			}
+			if n > 0 && rolled >= n {
+				break
+			}
+
+			if err = m.run(ctx, conn, mig.Down, m.previous(i)); err != nil {
+				return fmt.Errorf("migration %d_%s down: %v", mig.Version, mig.Name, err)
+			}
+			fmt.Printf("%d/d %s\n", mig.Version, mig.Name)
+			rolled++
+		}
+
+		if rolled == 0 {
+			fmt.Println("no change")
+		}
+
+		return nil
+	})
+}
+
+// Goto migrate up or down until the database is at the given version
+func (m *Migrator) Goto(ctx context.Context, version int64) error {
+	if version != NilVersion && m.index(version) < 0 {
+		return fmt.Errorf("migration version %d doesn't exists", version)
+	}
+
+	return m.session(ctx, func(conn *pgxpool.Conn) error {
+		current, dirty, err := m.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("database is dirty at version %d, fix it and use force", current)
+		}
+
+		for _, mig := range m.migrations {
+			if mig.Version <= current || mig.Version > version {
+				continue
+			}
+			if err = m.run(ctx, conn, mig.Up, mig.Version); err != nil {
+				return fmt.Errorf("migration %d_%s up: %v", mig.Version, mig.Name, err)
+			}
+			fmt.Printf("%d/u %s\n", mig.Version, mig.Name)
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mig := m.migrations[i]
+			if mig.Version > current || mig.Version <= version {
+				continue
+			}
+			if err = m.run(ctx, conn, mig.Down, m.previous(i)); err != nil {
+				return fmt.Errorf("migration %d_%s down: %v", mig.Version, mig.Name, err)
+			}
+			fmt.Printf("%d/d %s\n", mig.Version, mig.Name)
+		}
+
+		return nil
+	})
+}
+
+// Force set the database version without running any migration and clear the dirty flag
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	return m.session(ctx, func(conn *pgxpool.Conn) error {
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		if err = setVersion(ctx, tx, version, false); err != nil {
+			return err
+		}
+
+		return tx.Commit(ctx)
+	})
+}
+
+// run execute a migration file and store the new version in one transaction
+func (m *Migrator) run(ctx context.Context, conn *pgxpool.Conn, file string, version int64) error {
+	if len(file) == 0 {
+		return errors.New("migration file doesn't exists")
+	}
+
+	body, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// without arguments pgx use the simple protocol, so one file may contain many statements
+	if _, err = tx.Exec(ctx, string(body)); err != nil {
+		return err
+	}
+
+	if err = setVersion(ctx, tx, version, false); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// index find the position of a version in the sorted migrations
+func (m *Migrator) index(version int64) int {
+	for i, mig := range m.migrations {
+		if mig.Version == version {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// previous get the version before the migration at position i
+func (m *Migrator) previous(i int) int64 {
+	if i < 1 {
+		return NilVersion
+	}
+
+	return m.migrations[i-1].Version
+}
@@ -0,0 +1,145 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"go-skeleton/bootstrap"
+	"os"
+	"os/signal"
+	"strconv"
+
+	"github.com/urfave/cli/v2"
+)
+
+const usage = `usage: migrate [--path dir] <command> [arg]
+
+commands:
+  up [N]      apply all or N pending migrations
+  down N      roll back N applied migrations
+  goto V      migrate up or down to version V
+  force V     set version V without running any migration
+  status      show the applied and pending migrations
+  version     print the current migration version`
+
+// Boot ...
+type boot struct {
+	App *bootstrap.App
+}
+
+func Booting(app *bootstrap.App) bootstrap.Service {
+	return &boot{App: app}
+}
+
+func (boo boot) CommandFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "path",
+			Value: "",
+			Usage: "Directory of the migration files (default: config migration_path)",
+		},
+	}
+}
+
+// Start run the migration command against app.DB
+func (b boot) Start(c *cli.Context) error {
+	path := c.String("path")
+	if len(path) == 0 {
+		path = b.App.Config.GetString("migration_path")
+	}
+	if len(path) == 0 {
+		path = "./resources/migrations"
+	}
+
+	m, err := NewMigrator(b.App.DB, path)
+	if err != nil {
+		return err
+	}
+
+	// cancel the running migration on interrupt, the transaction will be rolled back
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	switch c.Args().First() {
+	case "up":
+		n, err := intArg(c, false)
+		if err != nil {
+			return err
+		}
+		return m.Up(ctx, int(n))
+	case "down":
+		n, err := intArg(c, true)
+		if err != nil {
+			return err
+		}
+		if n < 1 {
+			return fmt.Errorf("N must be greater than 0\n%s", usage)
+		}
+		return m.Down(ctx, int(n))
+	case "goto":
+		v, err := intArg(c, true)
+		if err != nil {
+			return err
+		}
+		return m.Goto(ctx, v)
+	case "force":
+		v, err := intArg(c, true)
+		if err != nil {
+			return err
+		}
+		return m.Force(ctx, v)
+	case "status":
+		return status(ctx, m)
+	case "version":
+		version, dirty, err := m.Version(ctx)
+		if err != nil {
+			return err
+		}
+		if version == NilVersion {
+			fmt.Println("no migration")
+			return nil
+		}
+		fmt.Printf("%d (dirty: %v)\n", version, dirty)
+		return nil
+	}
+
+	return fmt.Errorf("%s", usage)
+}
+
+// status print every migration file with its state
+func status(ctx context.Context, m *Migrator) error {
+	version, dirty, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, mig := range m.Migrations() {
+		state := "pending"
+		switch {
+		case mig.Version == version && dirty:
+			state = "dirty"
+		case mig.Version <= version:
+			state = "applied"
+		}
+		fmt.Printf("%-8s %06d_%s\n", state, mig.Version, mig.Name)
+	}
+
+	return nil
+}
+
+// intArg parse the second argument of the command as a number
+func intArg(c *cli.Context, required bool) (int64, error) {
+	arg := c.Args().Get(1)
+	if len(arg) == 0 {
+		if required {
+			return 0, fmt.Errorf("missing argument\n%s", usage)
+		}
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid argument %q\n%s", arg, usage)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,55 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"go-skeleton/bootstrap"
+	"go-skeleton/lib/logger"
+	"go-skeleton/lib/outbox"
+	"go-skeleton/lib/rabbit"
+	"go-skeleton/lib/utils"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/sirupsen/logrus"
+)
+
+// registry the handler of each routing key consumed by the worker
+func registry(app *bootstrap.App) map[string]rabbit.HandlerFunc {
+	h := handler{app}
+
+	return map[string]rabbit.HandlerFunc{
+		utils.EventUserRegistered:    h.logEvent,
+		utils.EventUserEmailVerified: h.logEvent,
+		utils.EventAddressCreated:    h.logEvent,
+		utils.EventSettingUpdated:    h.logEvent,
+	}
+}
+
+type handler struct {
+	*bootstrap.App
+}
+
+// decodeEvent the envelope of a domain event published by the outbox relay
+func decodeEvent(d amqp.Delivery) (outbox.Envelope, error) {
+	var ev outbox.Envelope
+	err := json.Unmarshal(d.Body, &ev)
+
+	return ev, err
+}
+
+// logEvent write the domain event in the log, the audit trail of the events
+func (h handler) logEvent(ctx context.Context, d amqp.Delivery) error {
+	ev, err := decodeEvent(d)
+	if err != nil {
+		return err
+	}
+
+	logger.FromContext(ctx).WithFields(logrus.Fields{
+		"event_id":       ev.ID,
+		"event_type":     ev.Type,
+		"aggregate_type": ev.AggregateType,
+		"aggregate_id":   ev.AggregateID,
+	}).Info("domain event")
+
+	return nil
+}
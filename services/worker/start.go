@@ -0,0 +1,121 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"go-skeleton/bootstrap"
+	"go-skeleton/lib/mail"
+	"go-skeleton/lib/outbox"
+	"go-skeleton/lib/rabbit"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// defaultQueue consumed when neither --queues nor queue.worker.queues is set
+const defaultQueue = "worker"
+
+// Boot ...
+type boot struct {
+	App *bootstrap.App
+}
+
+func Booting(app *bootstrap.App) bootstrap.Service {
+	return &boot{App: app}
+}
+
+func (boo boot) CommandFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "queues",
+			Usage: "Comma separated queues to consume (default config queue.worker.queues)",
+		},
+	}
+}
+
+// queueOptions the options of a queue from queue.consumers.<name>.*
+func (b boot) queueOptions(name string) rabbit.ConsumerOptions {
+	conf := b.App.Config
+	prefix := fmt.Sprintf("queue.consumers.%s.", name)
+
+	exchange := conf.GetString("queue.worker.exchange")
+	if len(exchange) == 0 {
+		exchange = outbox.DefaultExchange
+	}
+
+	return rabbit.ConsumerOptions{
+		Queue:          name,
+		Exchange:       exchange,
+		BindingKeys:    splitList(conf.GetString(prefix + "bindings")),
+		Prefetch:       conf.GetInt(prefix + "prefetch"),
+		MaxAttempts:    conf.GetInt(prefix + "max_attempts"),
+		RetryDelay:     time.Duration(conf.GetInt(prefix+"retry_delay")) * time.Second,
+		HandlerTimeout: time.Duration(conf.GetInt(prefix+"timeout")) * time.Second,
+	}
+}
+
+// Start consume the queues until SIGTERM, the messages in progress are finished first
+func (b boot) Start(c *cli.Context) error {
+	queues := splitList(c.String("queues"))
+	if len(queues) == 0 {
+		queues = splitList(b.App.Config.GetString("queue.worker.queues"))
+	}
+	if len(queues) == 0 {
+		queues = []string{defaultQueue}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	host := b.App.Config.GetString("queue.rabbitmq.host")
+	handlers := registry(b.App)
+
+	var wg sync.WaitGroup
+	// the worker can send the queued mails instead of the api instances
+	if b.App.Config.GetBool("mail.queue.sender") {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			log.Println("Worker Service -> Sending the queued mails")
+			mail.NewSender(b.App).Run(ctx)
+		}()
+	}
+
+	for _, queue := range queues {
+		consumer := rabbit.NewConsumer(host, b.queueOptions(queue))
+		for key, handler := range handlers {
+			consumer.Handle(key, handler)
+		}
+
+		wg.Add(1)
+		go func(queue string) {
+			defer wg.Done()
+			log.Printf("Worker Service -> Consuming queue [%v]", queue)
+			if err := consumer.Run(ctx); err != nil {
+				log.Printf("Worker Service -> queue %s: %v", queue, err)
+			}
+		}(queue)
+	}
+
+	wg.Wait()
+	fmt.Println("worker stopped")
+
+	return nil
+}
+
+func splitList(s string) []string {
+	var res []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}